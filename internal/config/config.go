@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sync"
+	"sync/atomic"
 
 	"github.com/danger-dream/ebpf-firewall/internal/utils"
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 )
 
@@ -16,11 +19,63 @@ type SecurityConfig struct {
 	ErrorWindow int `mapstructure:"error-window"`
 }
 
+// RouteLimitConfig overrides the default token-bucket parameters for requests whose path
+// starts with Prefix. The longest matching prefix wins.
+type RouteLimitConfig struct {
+	Prefix    string  `mapstructure:"prefix"`
+	Rate      float64 `mapstructure:"rate"`
+	Burst     int     `mapstructure:"burst"`
+	CIDRLenV4 int     `mapstructure:"cidr-len-v4"`
+	CIDRLenV6 int     `mapstructure:"cidr-len-v6"`
+}
+
 type RateLimitConfig struct {
-	// Maximum number of requests allowed per interval
-	RateLimitRequest int `mapstructure:"request"`
-	// Rate limit time interval in seconds
-	RateLimitInterval int `mapstructure:"interval"`
+	// default tokens refilled per second for a key with no matching route rule
+	Rate float64 `mapstructure:"rate"`
+	// default bucket capacity / max burst size
+	Burst int `mapstructure:"burst"`
+	// IPv4 addresses are masked to this prefix length before bucketing
+	CIDRLenV4 int `mapstructure:"cidr-len-v4"`
+	// IPv6 addresses are masked to this prefix length before bucketing, so e.g. a whole /64
+	// is treated as one client instead of an unbounded set of addresses
+	CIDRLenV6 int `mapstructure:"cidr-len-v6"`
+	// per route-prefix overrides, longest matching prefix wins
+	Routes []RouteLimitConfig `mapstructure:"routes"`
+	// CIDRs (or bare IPs) of reverse proxies trusted to supply X-Real-IP/X-Forwarded-For
+	TrustedProxies []string `mapstructure:"trusted-proxies"`
+}
+
+// NotifySinkConfig describes a single outbound webhook target
+type NotifySinkConfig struct {
+	// sink type: "generic" or "splunk_hec"
+	Type string `mapstructure:"type"`
+	// destination URL
+	URL string `mapstructure:"url"`
+	// auth token, used as the Splunk HEC token for splunk_hec sinks
+	Token string `mapstructure:"token"`
+	// event types this sink receives ("block", "threat_intel", "match"); empty means all
+	EventTypes []string `mapstructure:"event-types"`
+	// number of events batched per delivery
+	BatchSize int `mapstructure:"batch-size"`
+	// per-request HTTP timeout in seconds
+	TimeoutSeconds int `mapstructure:"timeout"`
+}
+
+type NotifyConfig struct {
+	Sinks []NotifySinkConfig `mapstructure:"sinks"`
+}
+
+// LoggingConfig controls the process-wide structured logger built by internal/logging.New and
+// threaded through every component as an explicit dependency.
+type LoggingConfig struct {
+	// Level is one of logrus's level names: "debug", "info", "warn", "error".
+	Level string `mapstructure:"level"`
+	// Format is "json" or "text".
+	Format string `mapstructure:"format"`
+	// Output is "stdout", "file" or "syslog".
+	Output string `mapstructure:"output"`
+	// FilePath is where log lines are written when Output is "file".
+	FilePath string `mapstructure:"file-path"`
 }
 
 // Config holds all application configuration parameters
@@ -30,6 +85,14 @@ type Config struct {
 	Auth string `mapstructure:"auth"`
 	// network interface name to monitor (e.g., eth0, ens33)
 	Interface string `mapstructure:"interface"`
+	// Interfaces, when set, attaches the XDP program to several interfaces instead of just
+	// Interface; Interface remains the single-interface config surface and is used to populate
+	// Interfaces when it's left empty.
+	Interfaces []string `mapstructure:"interfaces"`
+	// PerInterfacePool gives each interface in Interfaces its own ElasticPool instead of
+	// multiplexing every interface's events into one shared pool, so a traffic burst on one NIC
+	// can't starve packet processing for another.
+	PerInterfacePool bool `mapstructure:"per-interface-pool"`
 	// HTTP server listening address and port (e.g., :5678, 127.0.0.1:5678)
 	Addr string `mapstructure:"addr"`
 
@@ -48,11 +111,13 @@ type Config struct {
 	Security SecurityConfig `mapstructure:"security"`
 
 	RateLimit RateLimitConfig `mapstructure:"rate-limit"`
+
+	Notify NotifyConfig `mapstructure:"notify"`
+
+	Logging LoggingConfig `mapstructure:"logging"`
 }
 
-var (
-	appConfig Config
-)
+var configVal atomic.Pointer[Config]
 
 func Init() error {
 	viper.SetDefault("version", "0.0.0")
@@ -65,8 +130,13 @@ func Init() error {
 	viper.SetDefault("retention-hours", 720)
 	viper.SetDefault("security.ip-error-threshold", 10)
 	viper.SetDefault("security.error-window", 86400)
-	viper.SetDefault("rate-limit.request", 120)
-	viper.SetDefault("rate-limit.interval", 60)
+	viper.SetDefault("rate-limit.rate", 2)
+	viper.SetDefault("rate-limit.burst", 120)
+	viper.SetDefault("rate-limit.cidr-len-v4", 32)
+	viper.SetDefault("rate-limit.cidr-len-v6", 64)
+	viper.SetDefault("logging.level", "info")
+	viper.SetDefault("logging.format", "text")
+	viper.SetDefault("logging.output", "stdout")
 
 	viper.SetConfigName("config")
 	viper.AddConfigPath(".")
@@ -82,6 +152,7 @@ func Init() error {
 		}
 	}
 
+	var appConfig Config
 	if err := viper.Unmarshal(&appConfig); err != nil {
 		return fmt.Errorf("failed to unmarshal config: %w", err)
 	}
@@ -89,6 +160,7 @@ func Init() error {
 	if err := validateConfig(&appConfig); err != nil {
 		return fmt.Errorf("invalid config: %w", err)
 	}
+	configVal.Store(&appConfig)
 	return nil
 }
 
@@ -108,6 +180,16 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("invalid interface: %s", config.Interface)
 	}
 
+	if len(config.Interfaces) == 0 {
+		config.Interfaces = []string{config.Interface}
+	} else {
+		for _, iface := range config.Interfaces {
+			if !utils.ValidateInterface(iface) {
+				return fmt.Errorf("invalid interface: %s", iface)
+			}
+		}
+	}
+
 	if config.DataDir == "" {
 		config.DataDir = "./data"
 		log.Printf("No data directory provided, using default data directory: %s", config.DataDir)
@@ -118,9 +200,110 @@ func validateConfig(config *Config) error {
 			return fmt.Errorf("failed to create data directory: %w", err)
 		}
 	}
+
+	switch config.Logging.Format {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("invalid logging.format: %s", config.Logging.Format)
+	}
+	switch config.Logging.Output {
+	case "", "stdout", "file", "syslog":
+	default:
+		return fmt.Errorf("invalid logging.output: %s", config.Logging.Output)
+	}
+	if config.Logging.Output == "file" && config.Logging.FilePath == "" {
+		return fmt.Errorf("logging.file-path is required when logging.output is \"file\"")
+	}
 	return nil
 }
 
 func GetConfig() *Config {
-	return &appConfig
+	return configVal.Load()
+}
+
+// Change carries the previous and newly-loaded Config across a WatchConfig-triggered reload, so
+// a subscriber can diff the fields it cares about itself, the same shape
+// processor.ConfigChangeCallback uses for processor.json reloads.
+type Change struct {
+	Old *Config
+	New *Config
+}
+
+// changeSubsMu guards changeSubs; Subscribe and publishChange are the only accessors.
+var (
+	changeSubsMu sync.Mutex
+	changeSubs   []chan Change
+)
+
+// Subscribe returns a channel that receives a Change after every reload WatchConfig applies. The
+// channel is buffered; a subscriber that falls behind drops events rather than blocking the
+// watcher goroutine - callers that need every change should drain promptly.
+func Subscribe() <-chan Change {
+	ch := make(chan Change, 4)
+	changeSubsMu.Lock()
+	changeSubs = append(changeSubs, ch)
+	changeSubsMu.Unlock()
+	return ch
+}
+
+func publishChange(old, new *Config) {
+	changeSubsMu.Lock()
+	subs := append([]chan Change(nil), changeSubs...)
+	changeSubsMu.Unlock()
+
+	change := Change{Old: old, New: new}
+	for _, ch := range subs {
+		select {
+		case ch <- change:
+		default:
+		}
+	}
+}
+
+// restartRequiredFieldsChanged reports whether old and new disagree on a field that nothing in
+// this process currently knows how to apply without restarting: the XDP attach point(s) and the
+// HTTP listener address are set up once at startup, and DataDir is baked into paths several
+// subsystems resolved when they were constructed.
+func restartRequiredFieldsChanged(old, new *Config) bool {
+	if old.Interface != new.Interface || old.Addr != new.Addr || old.DataDir != new.DataDir {
+		return true
+	}
+	if len(old.Interfaces) != len(new.Interfaces) {
+		return true
+	}
+	for i := range old.Interfaces {
+		if old.Interfaces[i] != new.Interfaces[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// WatchConfig begins watching the config file via viper's fsnotify-backed watcher and, after
+// every write, re-unmarshals and validates it. A reload that changes interface(s), addr or
+// data-dir is rejected with a logged error and left on the previously loaded config, since
+// nothing currently re-attaches the XDP program or HTTP listener on a live reload; every other
+// field is swapped in and published to every Subscribe()'d channel. Call after Init.
+func WatchConfig() {
+	viper.OnConfigChange(func(_ fsnotify.Event) {
+		var newConfig Config
+		if err := viper.Unmarshal(&newConfig); err != nil {
+			log.Printf("config reload: failed to unmarshal: %v", err)
+			return
+		}
+		if err := validateConfig(&newConfig); err != nil {
+			log.Printf("config reload: invalid config: %v", err)
+			return
+		}
+
+		old := GetConfig()
+		if restartRequiredFieldsChanged(old, &newConfig) {
+			log.Printf("config reload: interface, addr and data-dir changes require a restart; ignoring reload")
+			return
+		}
+
+		configVal.Store(&newConfig)
+		publishChange(old, &newConfig)
+	})
+	viper.WatchConfig()
 }
@@ -3,14 +3,22 @@ package ebpf
 import (
 	"bytes"
 	"errors"
+	"io"
+	"math/rand"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"encoding/binary"
 	"fmt"
-	"log"
+	"hash/fnv"
 	"net"
+	"net/netip"
 	"os"
 
+	"github.com/sirupsen/logrus"
+
 	"github.com/danger-dream/ebpf-firewall/internal/config"
 	"github.com/danger-dream/ebpf-firewall/internal/types"
 	"github.com/danger-dream/ebpf-firewall/internal/utils"
@@ -20,152 +28,549 @@ import (
 	"github.com/cilium/ebpf/rlimit"
 )
 
+const (
+	// maxRestartBackoff caps the exponential backoff between reattach attempts.
+	maxRestartBackoff = 30 * time.Second
+	// restartWindow and maxRestartsInWindow define the restart circuit breaker: an interface
+	// that needs more than maxRestartsInWindow restarts within restartWindow is considered
+	// flapping, and restartInterface stops retrying it rather than spinning forever.
+	restartWindow       = 60 * time.Second
+	maxRestartsInWindow = 5
+	// decodeFailureThreshold is how many consecutive binary.Read failures on one interface's
+	// perf reader trigger a restart, on the theory that a wire-format mismatch or corrupted
+	// ring buffer won't self-heal and is better treated the same as the reader closing outright.
+	decodeFailureThreshold = 50
+)
+
+// RestartHooks lets a caller rebuild state that depends on an interface's eBPF maps after
+// EBPFManager reattaches it - e.g. replaying the current rule set into the fresh maps, or
+// resetting per-interface metrics that assumed the old attachment was still live.
+type RestartHooks interface {
+	OnInterfaceRestart(iface string) error
+}
+
+// restartState tracks an interface's recent restart attempts across however many times its
+// ifaceState has been replaced by attachInterface, so the circuit breaker's window survives
+// reattachment instead of resetting every time the interface comes back up.
+type restartState struct {
+	mu       sync.Mutex
+	attempts []time.Time
+	open     bool
+	lastErr  error
+}
+
+// recordAttempt appends now to rs's attempt history, drops anything older than window, and
+// reports whether the interface is still within its restart budget. Once an attempt pushes the
+// count past limit, open latches true and stays true for the rest of the window.
+func (rs *restartState) recordAttempt(limit int, window time.Duration) bool {
+	now := time.Now()
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	cutoff := now.Add(-window)
+	kept := rs.attempts[:0]
+	for _, t := range rs.attempts {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	rs.attempts = append(kept, now)
+	rs.open = len(rs.attempts) > limit
+	return !rs.open
+}
+
+func (rs *restartState) setLastErr(err error) {
+	rs.mu.Lock()
+	rs.lastErr = err
+	rs.mu.Unlock()
+}
+
+// snapshot returns the number of restarts currently counted within the window, the most recent
+// restart error (nil if the last attempt succeeded), and whether the circuit breaker is open.
+func (rs *restartState) snapshot() (restarts int, lastErr error, open bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return len(rs.attempts), rs.lastErr, rs.open
+}
+
+// restartBackoff computes the delay before the (attempt+1)th reattach try: base doubled once per
+// prior attempt and capped at maxRestartBackoff, plus up to 20% jitter so several interfaces
+// restarting at once don't all retry in lockstep.
+func restartBackoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		base = 10 * time.Millisecond
+	}
+	if attempt > 16 {
+		attempt = 16 // avoid overflowing the shift for a pathologically long retry run
+	}
+	backoff := base << uint(attempt)
+	if backoff <= 0 || backoff > maxRestartBackoff {
+		backoff = maxRestartBackoff
+	}
+	return backoff + time.Duration(rand.Int63n(int64(backoff)/5+1))
+}
+
+// ifaceState is everything EBPFManager owns for a single attached interface: its own eBPF object
+// set (program + maps), XDP link, perf reader and, when PerInterfacePool is on, its own pool.
+// Loading a fresh xdpObjects per interface rather than sharing one across every attachment is
+// what lets AddRuleOnInterface scope a rule to just one NIC's maps.
+type ifaceState struct {
+	name     string
+	objects  *xdpObjects
+	link     *link.Link
+	linkType string
+	reader   *perf.Reader
+	pool     *utils.ElasticPool[*types.PacketInfo]
+	done     chan struct{}
+	// decodeFailures counts consecutive binary.Read failures on this attachment's perf reader;
+	// readInterface resets it on every successful decode and restarts the interface once it
+	// crosses decodeFailureThreshold.
+	decodeFailures atomic.Int64
+}
+
 type EBPFManager struct {
-	interfaceName string
-	objects       *xdpObjects
-	link          *link.Link
-	reader        *perf.Reader
-	pool          *utils.ElasticPool[*types.PacketInfo]
-	done          chan struct{}
-	linkType      string
+	mu               sync.RWMutex
+	ifaces           map[string]*ifaceState
+	restarts         map[string]*restartState
+	sharedPool       *utils.ElasticPool[*types.PacketInfo]
+	perInterfacePool bool
+	hooks            RestartHooks
+	threatIntel      threatIntelState
+	logger           logrus.FieldLogger
+}
+
+func NewEBPFManager(pool *utils.ElasticPool[*types.PacketInfo], logger logrus.FieldLogger) *EBPFManager {
+	return &EBPFManager{
+		sharedPool: pool,
+		restarts:   make(map[string]*restartState),
+		logger:     logger.WithField("component", "ebpf"),
+	}
+}
+
+// SetRestartHooks registers hooks run after each successful interface restart. Safe to call
+// before or after Start; nil disables hooks (the default).
+func (em *EBPFManager) SetRestartHooks(hooks RestartHooks) {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+	em.hooks = hooks
 }
 
-func NewEBPFManager(pool *utils.ElasticPool[*types.PacketInfo]) *EBPFManager {
-	return &EBPFManager{pool: pool}
+// restartStateFor returns the persistent restart history for name, creating it on first use.
+func (em *EBPFManager) restartStateFor(name string) *restartState {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+	rs, ok := em.restarts[name]
+	if !ok {
+		rs = &restartState{}
+		em.restarts[name] = rs
+	}
+	return rs
 }
 
+// Start attaches the XDP program to every configured interface (config.Interfaces, falling back
+// to config.Interface when unset) and begins delivering decoded packets to either one shared pool
+// (the default) or one pool per interface, depending on config.PerInterfacePool. It returns an
+// error if every interface failed to attach, or if a per-interface pool fails to start; other
+// per-interface attach failures are logged and the rest proceed.
 func (em *EBPFManager) Start() error {
-	config := config.GetConfig()
-	iface, err := net.InterfaceByName(config.Interface)
-	if err != nil {
-		return fmt.Errorf("failed to get interface %s: %s", config.Interface, err)
+	cfg := config.GetConfig()
+	interfaces := cfg.Interfaces
+	if len(interfaces) == 0 {
+		interfaces = []string{cfg.Interface}
+	}
+	em.perInterfacePool = cfg.PerInterfacePool
+
+	em.mu.Lock()
+	em.ifaces = make(map[string]*ifaceState, len(interfaces))
+	em.mu.Unlock()
+
+	var errs []string
+	for _, name := range interfaces {
+		if err := em.attachInterface(name); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", name, err.Error()))
+		}
+	}
+	em.mu.RLock()
+	started := len(em.ifaces)
+	em.mu.RUnlock()
+	if started == 0 {
+		return fmt.Errorf("failed to start eBPF on any interface: %s", strings.Join(errs, "; "))
+	}
+	for _, msg := range errs {
+		em.logger.Warnf("interface failed to start: %s", msg)
 	}
-	em.interfaceName = config.Interface
 
+	if em.perInterfacePool {
+		em.mu.RLock()
+		states := make([]*ifaceState, 0, len(em.ifaces))
+		for _, st := range em.ifaces {
+			states = append(states, st)
+		}
+		em.mu.RUnlock()
+		for _, st := range states {
+			st := st
+			st.pool.SetKeyedProducer(func(submit func(*types.PacketInfo, uint64)) {
+				em.readInterface(st, submit)
+			})
+			if err := st.pool.Start(); err != nil {
+				return fmt.Errorf("failed to start pool for interface %s: %w", st.name, err)
+			}
+		}
+	} else {
+		em.sharedPool.SetKeyedProducer(em.monitorEvents)
+	}
+	return nil
+}
+
+// attachInterface loads a fresh eBPF object set and attaches it to name, registering the result
+// in em.ifaces. In PerInterfacePool mode it also constructs that interface's own pool, cloning
+// the shared pool's config; per-interface pools don't inherit the shared pool's object pooling,
+// since the newFn/reset pair passed to WithObjectPool isn't recoverable from an existing pool.
+func (em *EBPFManager) attachInterface(name string) error {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return fmt.Errorf("failed to get interface: %s", err)
+	}
 	if err := rlimit.RemoveMemlock(); err != nil {
-		log.Printf("failed to remove memlock: %s", err.Error())
+		em.logger.Warnf("failed to remove memlock: %s", err.Error())
 	}
 	var ebpfObj xdpObjects
 	if err := loadXdpObjects(&ebpfObj, nil); err != nil {
 		return fmt.Errorf("failed to load eBPF objects: %s", err.Error())
 	}
-	em.objects = &ebpfObj
-	err = em.attachXDP(iface.Index)
+	st := &ifaceState{name: name, objects: &ebpfObj, done: make(chan struct{})}
+
+	linkType, l, err := em.attachXDP(&ebpfObj, iface.Index)
 	if err != nil {
-		em.Close()
+		ebpfObj.Close()
 		return err
 	}
-	em.reader, err = perf.NewReader(em.objects.Events, os.Getpagesize())
+	st.link = l
+	st.linkType = linkType
+	em.logger.WithField("interface", name).WithField("mode", linkType).Info("XDP program attached successfully")
+
+	reader, err := perf.NewReader(ebpfObj.Events, os.Getpagesize())
 	if err != nil {
-		em.Close()
+		(*l).Close()
+		ebpfObj.Close()
 		return fmt.Errorf("failed to create perf event reader: %s", err.Error())
 	}
-	em.done = make(chan struct{})
-	em.pool.SetProducer(em.monitorEvents)
+	st.reader = reader
+
+	if em.perInterfacePool {
+		st.pool = utils.NewElasticPool[*types.PacketInfo](em.sharedPool.Config())
+		st.pool.SetProcessor(em.sharedPool.Processor())
+	} else {
+		st.pool = em.sharedPool
+	}
+
+	em.mu.Lock()
+	em.ifaces[name] = st
+	em.mu.Unlock()
 	return nil
 }
 
-func (em *EBPFManager) attachXDP(index int) error {
+func (em *EBPFManager) attachXDP(objects *xdpObjects, index int) (linkType string, l *link.Link, err error) {
 	flagNames := []string{"offload", "driver", "generic"}
-	errs := []string{}
+	var errs []string
 	for i, mode := range []link.XDPAttachFlags{link.XDPOffloadMode, link.XDPDriverMode, link.XDPGenericMode} {
 		flagName := flagNames[i]
-		l, err := link.AttachXDP(link.XDPOptions{
-			Program:   em.objects.XdpProg,
+		attached, attachErr := link.AttachXDP(link.XDPOptions{
+			Program:   objects.XdpProg,
 			Interface: index,
 			Flags:     mode,
 		})
-		if err == nil {
-			em.linkType = flagName
-			em.link = &l
-			log.Printf("XDP program attached successfully, current mode: %s", flagName)
-			return nil
+		if attachErr == nil {
+			return flagName, &attached, nil
 		}
-		errs = append(errs, fmt.Sprintf("failed to attach XDP program with %s mode: %s", flagName, err.Error()))
+		errs = append(errs, fmt.Sprintf("failed to attach XDP program with %s mode: %s", flagName, attachErr.Error()))
+	}
+	return "", nil, errors.New(strings.Join(errs, "\n"))
+}
+
+// monitorEvents is the shared-pool producer: it fans the events from every attached interface's
+// own perf reader into the single submit callback the pool gives it, and blocks until all of them
+// stop (on Close, or if every one of them restarts itself away - see readInterface).
+func (em *EBPFManager) monitorEvents(submit func(*types.PacketInfo, uint64)) {
+	em.mu.RLock()
+	states := make([]*ifaceState, 0, len(em.ifaces))
+	for _, st := range em.ifaces {
+		states = append(states, st)
+	}
+	em.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, st := range states {
+		st := st
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			em.readInterface(st, submit)
+		}()
 	}
-	return errors.New(strings.Join(errs, "\n"))
+	wg.Wait()
 }
 
-func (em *EBPFManager) monitorEvents(submit func(*types.PacketInfo)) {
+// readInterface drains st's perf reader until it's closed or st.done fires, submitting each
+// decoded packet tagged with st.name. If the reader closes unexpectedly it reattaches just this
+// interface and resumes reading on its replacement, without disturbing any other interface.
+func (em *EBPFManager) readInterface(st *ifaceState, submit func(*types.PacketInfo, uint64)) {
 	for {
 		select {
-		case <-em.done:
+		case <-st.done:
 			return
 		default:
-			record, err := em.reader.Read()
-			if err != nil {
-				if err == perf.ErrClosed {
-					log.Printf("perf event reader closed, trying to restart eBPF")
-					em.Close()
-					if err := em.Start(); err != nil {
-						log.Fatalf("failed to restart eBPF: %s", err.Error())
-					} else {
-						log.Printf("eBPF restarted successfully")
-					}
+		}
+		record, err := st.reader.Read()
+		if err != nil {
+			if err == perf.ErrClosed {
+				select {
+				case <-st.done:
 					return
+				default:
 				}
-				continue
+				em.logger.WithField("interface", st.name).Warn("perf event reader closed, trying to restart eBPF")
+				em.restartInterface(st, submit)
+				return
 			}
-			var pi types.PacketInfo
-			if err := binary.Read(bytes.NewReader(record.RawSample), binary.LittleEndian, &pi); err != nil {
-				continue
+			continue
+		}
+		// Pulled from the pool's object pool rather than allocated fresh, to keep per-packet GC
+		// pressure flat under high event rates. The processor must be done with pi by the time
+		// it returns, since the pool resets and reuses it for a later packet as soon as that
+		// task completes.
+		pi := st.pool.Get()
+		if err := binary.Read(bytes.NewReader(record.RawSample), binary.LittleEndian, &pi.PacketWire); err != nil {
+			if st.decodeFailures.Add(1) >= decodeFailureThreshold {
+				em.logger.WithField("interface", st.name).Warnf("%d consecutive decode failures, restarting eBPF", decodeFailureThreshold)
+				em.restartInterface(st, submit)
+				return
 			}
-			submit(&pi)
+			continue
 		}
+		st.decodeFailures.Store(0)
+		pi.Interface = st.name
+		submit(pi, flowHashKey(pi))
 	}
 }
 
-func (em *EBPFManager) Close() error {
-	if em.done != nil {
-		close(em.done)
+// restartInterface is st's supervised recovery loop: it retries reattaching st's interface with
+// exponential backoff (base st.pool.Config().BackoffTime, capped at maxRestartBackoff, with
+// jitter) until it succeeds or the circuit breaker trips - more than maxRestartsInWindow restarts
+// within restartWindow - at which point it logs and leaves the interface down rather than
+// spinning forever. Other interfaces managed by em are unaffected. On success it runs em.hooks,
+// if any, so callers can rebuild state (e.g. replay rules) that depended on the replaced maps.
+func (em *EBPFManager) restartInterface(st *ifaceState, submit func(*types.PacketInfo, uint64)) {
+	em.closeInterfaceState(st)
+	rs := em.restartStateFor(st.name)
+	basePool := st.pool
+
+	for attempt := 0; ; attempt++ {
+		if !rs.recordAttempt(maxRestartsInWindow, restartWindow) {
+			err := fmt.Errorf("more than %d restarts in %s", maxRestartsInWindow, restartWindow)
+			rs.setLastErr(err)
+			em.logger.WithField("interface", st.name).Errorf("circuit breaker open, giving up on restart: %s", err.Error())
+			return
+		}
+
+		backoff := restartBackoff(basePool.Config().BackoffTime, attempt)
+		em.logger.WithField("interface", st.name).Warnf("reattaching eBPF in %s (attempt %d)", backoff, attempt+1)
+		time.Sleep(backoff)
+
+		if err := em.attachInterface(st.name); err != nil {
+			rs.setLastErr(err)
+			em.logger.WithField("interface", st.name).Errorf("failed to restart eBPF: %s", err.Error())
+			continue
+		}
+		rs.setLastErr(nil)
+		em.logger.WithField("interface", st.name).Info("eBPF restarted successfully")
+
+		em.mu.RLock()
+		newSt := em.ifaces[st.name]
+		hooks := em.hooks
+		em.mu.RUnlock()
+
+		if hooks != nil {
+			if err := hooks.OnInterfaceRestart(st.name); err != nil {
+				em.logger.WithField("interface", st.name).Errorf("restart hook failed: %s", err.Error())
+			}
+		}
+
+		if em.perInterfacePool {
+			// attachInterface built newSt a fresh pool; it needs its own producer wired up and
+			// started, the same way Start does for the initial attachment.
+			newSt.pool.SetKeyedProducer(func(s func(*types.PacketInfo, uint64)) {
+				em.readInterface(newSt, s)
+			})
+			if err := newSt.pool.Start(); err != nil {
+				em.logger.WithField("interface", st.name).Errorf("failed to start pool after restart: %s", err.Error())
+			}
+			return
+		}
+		em.readInterface(newSt, submit)
+		return
 	}
-	if em.reader != nil {
-		em.reader.Close()
+}
+
+// Health reports every restart circuit breaker currently open across the interfaces that have
+// ever needed a restart, joined into one error, or nil if none is open. Intended for an operator-facing readiness check, not
+// the hot packet path.
+func (em *EBPFManager) Health() error {
+	em.mu.RLock()
+	restarts := make(map[string]*restartState, len(em.restarts))
+	for name, rs := range em.restarts {
+		restarts[name] = rs
 	}
-	if em.link != nil {
-		(*em.link).Close()
+	em.mu.RUnlock()
+
+	var errs []string
+	for name, rs := range restarts {
+		if count, lastErr, open := rs.snapshot(); open {
+			errs = append(errs, fmt.Sprintf("%s: circuit breaker open after %d restarts in %s, last error: %v", name, count, restartWindow, lastErr))
+		}
 	}
-	if em.objects != nil {
-		em.objects.Close()
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
 	}
 	return nil
 }
 
-func (em *EBPFManager) GetLinkType() string {
-	return em.linkType
+// WritePrometheus renders per-interface restart counters and circuit breaker state in
+// Prometheus text exposition format, following the same hand-rolled style as
+// metrics.MetricsCollector.WritePrometheus.
+func (em *EBPFManager) WritePrometheus(w io.Writer) error {
+	em.mu.RLock()
+	restarts := make(map[string]*restartState, len(em.restarts))
+	for name, rs := range em.restarts {
+		restarts[name] = rs
+	}
+	em.mu.RUnlock()
+
+	fmt.Fprintln(w, "# HELP ebpf_firewall_interface_restarts Restarts within the current circuit breaker window, by interface.")
+	fmt.Fprintln(w, "# TYPE ebpf_firewall_interface_restarts gauge")
+	for name, rs := range restarts {
+		count, _, _ := rs.snapshot()
+		fmt.Fprintf(w, "ebpf_firewall_interface_restarts{interface=%q} %d\n", name, count)
+	}
+
+	fmt.Fprintln(w, "# HELP ebpf_firewall_interface_circuit_open Whether an interface's restart circuit breaker is open (1) or closed (0).")
+	fmt.Fprintln(w, "# TYPE ebpf_firewall_interface_circuit_open gauge")
+	for name, rs := range restarts {
+		_, _, open := rs.snapshot()
+		v := 0
+		if open {
+			v = 1
+		}
+		fmt.Fprintf(w, "ebpf_firewall_interface_circuit_open{interface=%q} %d\n", name, v)
+	}
+	return nil
+}
+
+// flowHashKey hashes a packet's 5-tuple so the pool routes every packet of the same flow to the
+// same shard, preserving per-flow processing order.
+func flowHashKey(pi *types.PacketInfo) uint64 {
+	h := fnv.New64a()
+	h.Write(pi.SrcIP[:])
+	h.Write(pi.DstIP[:])
+	h.Write(pi.SrcIPv6[:])
+	h.Write(pi.DstIPv6[:])
+	var portAndProto [6]byte
+	binary.BigEndian.PutUint16(portAndProto[0:2], pi.SrcPort)
+	binary.BigEndian.PutUint16(portAndProto[2:4], pi.DstPort)
+	binary.BigEndian.PutUint16(portAndProto[4:6], uint16(pi.IPProto))
+	h.Write(portAndProto[:])
+	return h.Sum64()
+}
+
+// closeInterfaceState tears down a single interface's link, reader and eBPF objects, signaling
+// its done channel first so readInterface's loop notices and stops before the reader closes out
+// from under it.
+func (em *EBPFManager) closeInterfaceState(st *ifaceState) {
+	close(st.done)
+	if st.reader != nil {
+		st.reader.Close()
+	}
+	if st.link != nil {
+		(*st.link).Close()
+	}
+	if st.objects != nil {
+		st.objects.Close()
+	}
+}
+
+// Close tears down every attached interface, continuing past any individual failure so the rest
+// are still cleaned up, and returns the first error encountered, if any.
+func (em *EBPFManager) Close() error {
+	em.mu.Lock()
+	states := make([]*ifaceState, 0, len(em.ifaces))
+	for _, st := range em.ifaces {
+		states = append(states, st)
+	}
+	em.ifaces = nil
+	em.mu.Unlock()
+
+	var firstErr error
+	for _, st := range states {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					if firstErr == nil {
+						firstErr = fmt.Errorf("panic closing interface %s: %v", st.name, r)
+					}
+					em.logger.WithField("interface", st.name).Errorf("panic while closing interface: %v", r)
+				}
+			}()
+			em.closeInterfaceState(st)
+		}()
+		if em.perInterfacePool && st.pool != nil {
+			st.pool.Close()
+		}
+	}
+	return firstErr
+}
+
+// GetLinkTypes reports the XDP attach mode ("offload", "driver" or "generic") each attached
+// interface ended up using, keyed by interface name.
+func (em *EBPFManager) GetLinkTypes() map[string]string {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+	linkTypes := make(map[string]string, len(em.ifaces))
+	for name, st := range em.ifaces {
+		linkTypes[name] = st.linkType
+	}
+	return linkTypes
 }
 
-func (em *EBPFManager) updateMap(iptype utils.IPType, value []byte, add bool) (err error) {
+func (em *EBPFManager) updateMap(objects *xdpObjects, iptype utils.IPType, value []byte, add bool) (err error) {
 	switch iptype {
 	case utils.IPTypeIPv4:
 		if add {
-			err = em.objects.Ipv4List.Put(value, 1)
+			err = objects.Ipv4List.Put(value, 1)
 		} else {
-			err = em.objects.Ipv4List.Delete(value)
+			err = objects.Ipv4List.Delete(value)
 		}
 	case utils.IPTypeIPV4CIDR:
 		if add {
-			err = em.objects.Ipv4CidrTrie.Put(value, 1)
+			err = objects.Ipv4CidrTrie.Put(value, 1)
 		} else {
-			err = em.objects.Ipv4CidrTrie.Delete(value)
+			err = objects.Ipv4CidrTrie.Delete(value)
 		}
 	case utils.IPTypeIPv6:
 		if add {
-			err = em.objects.Ipv6List.Put(value, 1)
+			err = objects.Ipv6List.Put(value, 1)
 		} else {
-			err = em.objects.Ipv6List.Delete(value)
+			err = objects.Ipv6List.Delete(value)
 		}
 	case utils.IPTypeIPv6CIDR:
 		if add {
-			err = em.objects.Ipv6CidrTrie.Put(value, 1)
+			err = objects.Ipv6CidrTrie.Put(value, 1)
 		} else {
-			err = em.objects.Ipv6CidrTrie.Delete(value)
+			err = objects.Ipv6CidrTrie.Delete(value)
 		}
 	case utils.IPTypeMAC:
 		if add {
-			err = em.objects.MacList.Put(value, 1)
+			err = objects.MacList.Put(value, 1)
 		} else {
-			err = em.objects.MacList.Delete(value)
+			err = objects.MacList.Delete(value)
 		}
 	default:
 		return fmt.Errorf("unsupported match type: %v", iptype)
@@ -173,18 +578,182 @@ func (em *EBPFManager) updateMap(iptype utils.IPType, value []byte, add bool) (e
 	return err
 }
 
+// AddRule adds value to every attached interface's maps, so the rule applies firewall-wide.
 func (em *EBPFManager) AddRule(value string) error {
-	bytes, iptype, err := utils.ParseValueToBytes(value)
+	b, iptype, err := utils.ParseValueToBytes(value)
 	if err != nil {
 		return err
 	}
-	return em.updateMap(iptype, bytes, true)
+	return em.forEachInterface(func(st *ifaceState) error {
+		return em.updateMap(st.objects, iptype, b, true)
+	})
 }
 
+// DeleteRule removes value from every attached interface's maps.
 func (em *EBPFManager) DeleteRule(value string) error {
-	bytes, iptype, err := utils.ParseValueToBytes(value)
+	b, iptype, err := utils.ParseValueToBytes(value)
+	if err != nil {
+		return err
+	}
+	return em.forEachInterface(func(st *ifaceState) error {
+		return em.updateMap(st.objects, iptype, b, false)
+	})
+}
+
+// AddRuleOnInterface adds value to iface's maps only, leaving every other attached interface's
+// blocklist untouched.
+func (em *EBPFManager) AddRuleOnInterface(iface, value string) error {
+	b, iptype, err := utils.ParseValueToBytes(value)
+	if err != nil {
+		return err
+	}
+	st, err := em.interfaceState(iface)
+	if err != nil {
+		return err
+	}
+	return em.updateMap(st.objects, iptype, b, true)
+}
+
+// DeleteRuleOnInterface removes value from iface's maps only.
+func (em *EBPFManager) DeleteRuleOnInterface(iface, value string) error {
+	b, iptype, err := utils.ParseValueToBytes(value)
+	if err != nil {
+		return err
+	}
+	st, err := em.interfaceState(iface)
+	if err != nil {
+		return err
+	}
+	return em.updateMap(st.objects, iptype, b, false)
+}
+
+// threatIntelState is what SyncThreatIntel last mirrored into every interface's kernel
+// threat-intel maps, kept independently of ifaceState since a restart replaces that object but
+// the kernel-side set should carry over unchanged. Tracking it lets SyncThreatIntel diff against
+// the previous run and only issue the Put/Delete calls the difference actually requires, instead
+// of flushing and reinserting the whole indicator set on every aggregator pass.
+type threatIntelState struct {
+	mu sync.Mutex
+	v4 map[netip.Prefix]struct{}
+	v6 map[netip.Prefix]struct{}
+}
+
+// diff reports which of prefixes aren't yet tracked (added) and which previously tracked entries
+// are no longer present (removed), and records prefixes as the new tracked set.
+func (s *threatIntelState) diff(prefixes []netip.Prefix, v4 bool) (added, removed []netip.Prefix) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current := s.v4
+	if !v4 {
+		current = s.v6
+	}
+	next := make(map[netip.Prefix]struct{}, len(prefixes))
+	for _, p := range prefixes {
+		next[p] = struct{}{}
+		if _, ok := current[p]; !ok {
+			added = append(added, p)
+		}
+	}
+	for p := range current {
+		if _, ok := next[p]; !ok {
+			removed = append(removed, p)
+		}
+	}
+	if v4 {
+		s.v4 = next
+	} else {
+		s.v6 = next
+	}
+	return added, removed
+}
+
+// SyncThreatIntel mirrors the threat-intel aggregator's current indicator set into every attached
+// interface's kernel BPF_MAP_TYPE_LPM_TRIE threat-intel maps (separate v4 and v6), so XDP can drop
+// a matching packet before it ever reaches userspace. It's wired up as the aggregator's
+// OnAggregated callback when processor.ProcessorConfig's ThreatIntel.KernelDrop is enabled, and diffs v4/v6 against
+// what was last synced so only entries that actually changed are pushed down to the kernel.
+func (em *EBPFManager) SyncThreatIntel(v4, v6 []netip.Prefix) error {
+	addedV4, removedV4 := em.threatIntel.diff(v4, true)
+	addedV6, removedV6 := em.threatIntel.diff(v6, false)
+	if len(addedV4)+len(removedV4)+len(addedV6)+len(removedV6) == 0 {
+		return nil
+	}
+
+	return em.forEachInterface(func(st *ifaceState) error {
+		for _, p := range removedV4 {
+			if err := st.objects.ThreatIntelV4.Delete(utils.PrefixToKeyBytes(p)); err != nil {
+				return fmt.Errorf("delete threat-intel v4 %s: %w", p, err)
+			}
+		}
+		for _, p := range addedV4 {
+			if err := st.objects.ThreatIntelV4.Put(utils.PrefixToKeyBytes(p), uint8(1)); err != nil {
+				return fmt.Errorf("put threat-intel v4 %s: %w", p, err)
+			}
+		}
+		for _, p := range removedV6 {
+			if err := st.objects.ThreatIntelV6.Delete(utils.PrefixToKeyBytes(p)); err != nil {
+				return fmt.Errorf("delete threat-intel v6 %s: %w", p, err)
+			}
+		}
+		for _, p := range addedV6 {
+			if err := st.objects.ThreatIntelV6.Put(utils.PrefixToKeyBytes(p), uint8(1)); err != nil {
+				return fmt.Errorf("put threat-intel v6 %s: %w", p, err)
+			}
+		}
+		return nil
+	})
+}
+
+// SyncThreatIntelToInterface mirrors the full v4/v6 indicator set into iface's kernel maps only,
+// unconditionally - unlike SyncThreatIntel it doesn't diff against threatIntelState, since iface's
+// maps are assumed empty (a fresh attach or a post-restart reattach) and diffing against the
+// globally-last-synced set would skip every indicator that hasn't changed since then, leaving
+// iface with none of them. Callers that already have a live interface should use SyncThreatIntel
+// instead, so an unrelated interface's restart doesn't cost every other interface a full re-Put.
+func (em *EBPFManager) SyncThreatIntelToInterface(iface string, v4, v6 []netip.Prefix) error {
+	st, err := em.interfaceState(iface)
 	if err != nil {
 		return err
 	}
-	return em.updateMap(iptype, bytes, false)
+	for _, p := range v4 {
+		if err := st.objects.ThreatIntelV4.Put(utils.PrefixToKeyBytes(p), uint8(1)); err != nil {
+			return fmt.Errorf("put threat-intel v4 %s: %w", p, err)
+		}
+	}
+	for _, p := range v6 {
+		if err := st.objects.ThreatIntelV6.Put(utils.PrefixToKeyBytes(p), uint8(1)); err != nil {
+			return fmt.Errorf("put threat-intel v6 %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+func (em *EBPFManager) interfaceState(iface string) (*ifaceState, error) {
+	em.mu.RLock()
+	defer em.mu.RUnlock()
+	st, ok := em.ifaces[iface]
+	if !ok {
+		return nil, fmt.Errorf("interface %s is not attached", iface)
+	}
+	return st, nil
+}
+
+func (em *EBPFManager) forEachInterface(fn func(*ifaceState) error) error {
+	em.mu.RLock()
+	states := make([]*ifaceState, 0, len(em.ifaces))
+	for _, st := range em.ifaces {
+		states = append(states, st)
+	}
+	em.mu.RUnlock()
+
+	var errs []string
+	for _, st := range states {
+		if err := fn(st); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", st.name, err.Error()))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
 }
@@ -0,0 +1,190 @@
+// Package events provides a small in-process pub/sub fan-out used to push live updates (flow
+// samples, threat-intel hits, blacklist changes, metric deltas) to connected SSE clients. It is
+// deliberately separate from notify.Notifier, which batches and retries delivery to external
+// sinks (webhooks) - this bus instead favors low latency over a bounded number of local
+// subscribers and drops rather than retries when one falls behind.
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Topic names a category of event a client can subscribe to.
+const (
+	TopicFlow        = "flow"
+	TopicThreatIntel = "threatintel"
+	TopicBlacklist   = "blacklist"
+	TopicMetrics     = "metrics"
+)
+
+// ringSize bounds how many recently-published events are kept for Last-Event-ID resume; enough
+// for a client to reconnect after a brief network blip without missing anything.
+const ringSize = 256
+
+// defaultQueueSize is the per-subscriber buffered channel capacity before events start dropping.
+const defaultQueueSize = 64
+
+// Event is a single frame published onto the bus and, from there, to every matching subscriber.
+type Event struct {
+	ID        int64  `json:"id"`
+	Topic     string `json:"topic"`
+	Timestamp int64  `json:"timestamp"`
+	Data      any    `json:"data"`
+}
+
+// Subscription is a single client's view onto the bus: a filtered, buffered stream of events
+// plus a counter of how many were dropped because the client fell behind.
+type Subscription struct {
+	topics  map[string]bool // nil means "all topics"
+	ch      chan Event
+	dropped atomic.Int64
+	bus     *EventBus
+	closeMu sync.Once
+}
+
+// Events returns the channel of events matching this subscription's topic filter.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Dropped returns the number of events dropped so far because the client's queue was full.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close unregisters the subscription from its bus. Safe to call more than once.
+func (s *Subscription) Close() {
+	s.closeMu.Do(func() {
+		s.bus.unsubscribe(s)
+		close(s.ch)
+	})
+}
+
+func (s *Subscription) matches(topic string) bool {
+	return s.topics == nil || s.topics[topic]
+}
+
+// EventBus fans published events out to every subscription whose topic filter matches, and
+// keeps a fixed-size ring of recent events so a reconnecting client can resume from a
+// Last-Event-ID instead of missing whatever happened while it was disconnected.
+type EventBus struct {
+	mu      sync.RWMutex
+	subs    map[*Subscription]struct{}
+	ring    []Event
+	head    int
+	count   int
+	nextID  atomic.Int64
+	dropped atomic.Int64
+}
+
+// NewEventBus creates an empty EventBus ready to accept subscribers and publishers.
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subs: make(map[*Subscription]struct{}),
+		ring: make([]Event, ringSize),
+		head: -1,
+	}
+}
+
+// Publish assigns the next event ID, records the event in the resume ring, and fans it out to
+// every current subscription whose topic filter matches. A subscriber whose queue is full has
+// the event dropped rather than blocking the publisher; the subscriber's own Dropped counter
+// is what the SSE handler surfaces back to that client as a "dropped" frame.
+func (b *EventBus) Publish(topic string, timestamp int64, data any) {
+	event := Event{
+		ID:        b.nextID.Add(1),
+		Topic:     topic,
+		Timestamp: timestamp,
+		Data:      data,
+	}
+
+	b.mu.Lock()
+	b.head = (b.head + 1) % len(b.ring)
+	b.ring[b.head] = event
+	if b.count < len(b.ring) {
+		b.count++
+	}
+	subs := make([]*Subscription, 0, len(b.subs))
+	for sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	b.mu.Unlock()
+
+	for _, sub := range subs {
+		if !sub.matches(topic) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			sub.dropped.Add(1)
+			b.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribe registers a new subscription filtered to topics (nil or empty means all topics),
+// replays any ring-buffered events with ID > lastEventID so a reconnecting client (one that
+// sent a Last-Event-ID header) doesn't miss what happened while it was away, then returns the
+// subscription for the caller to read from until it calls Close.
+func (b *EventBus) Subscribe(topics []string, lastEventID int64) *Subscription {
+	var filter map[string]bool
+	if len(topics) > 0 {
+		filter = make(map[string]bool, len(topics))
+		for _, t := range topics {
+			filter[t] = true
+		}
+	}
+	sub := &Subscription{
+		topics: filter,
+		ch:     make(chan Event, defaultQueueSize),
+	}
+
+	b.mu.Lock()
+	backlog := b.eventsSinceLocked(lastEventID)
+	sub.bus = b
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	for _, event := range backlog {
+		if !sub.matches(event.Topic) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			sub.dropped.Add(1)
+			b.dropped.Add(1)
+		}
+	}
+	return sub
+}
+
+// eventsSinceLocked returns ring-buffered events with ID > lastEventID, oldest first. Callers
+// must hold at least a read lock on b.mu.
+func (b *EventBus) eventsSinceLocked(lastEventID int64) []Event {
+	if lastEventID <= 0 || b.head < 0 {
+		return nil
+	}
+	out := make([]Event, 0, b.count)
+	for steps := b.count - 1; steps >= 0; steps-- {
+		idx := (b.head - steps + len(b.ring)) % len(b.ring)
+		if b.ring[idx].ID > lastEventID {
+			out = append(out, b.ring[idx])
+		}
+	}
+	return out
+}
+
+func (b *EventBus) unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	delete(b.subs, sub)
+	b.mu.Unlock()
+}
+
+// DroppedEvents returns the number of events dropped so far across every subscriber due to a
+// full per-subscriber queue.
+func (b *EventBus) DroppedEvents() int64 {
+	return b.dropped.Load()
+}
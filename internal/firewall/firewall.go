@@ -0,0 +1,241 @@
+// Package firewall layers port/proto/direction-aware rule matching on top of iptrie's
+// longest-prefix index, modeled on Nebula's AllowList: a rule set is keyed by source CIDR and
+// resolved to a bucket of candidate rules via one trie lookup, then the bucket is evaluated
+// linearly (first match wins) against the packet's protocol, port and direction. The processor's
+// existing binary block-list (see processor.BlockRule) is the degenerate case of this model where
+// every rule matches any proto/port/direction.
+package firewall
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"github.com/danger-dream/ebpf-firewall/internal/threatintel/iptrie"
+	"github.com/danger-dream/ebpf-firewall/internal/types"
+)
+
+// Direction scopes a Rule to the flow direction a packet was observed in. DirectionAny matches
+// both.
+type Direction string
+
+const (
+	DirectionInbound  Direction = "inbound"
+	DirectionOutbound Direction = "outbound"
+	DirectionAny      Direction = "any"
+)
+
+// Common IP protocol numbers, for constructing PortRange-bearing rules against TCP/UDP traffic.
+// types.IPProtocol carries no symbolic names of its own (see types.go), so these mirror the IANA
+// assigned numbers a Rule.Proto is compared against.
+const (
+	ProtoTCP  types.IPProtocol = 6
+	ProtoUDP  types.IPProtocol = 17
+	ProtoICMP types.IPProtocol = 1
+)
+
+// PortRange matches a single port or an inclusive range. The zero value matches any port, so a
+// Rule that doesn't care about ports can simply omit Ports entirely.
+type PortRange struct {
+	From uint16 `json:"from"`
+	To   uint16 `json:"to"` // zero means "same as From", i.e. a single-port range
+}
+
+// contains reports whether port falls within the range. The zero PortRange matches every port.
+func (r PortRange) contains(port uint16) bool {
+	if r.From == 0 && r.To == 0 {
+		return true
+	}
+	to := r.To
+	if to == 0 {
+		to = r.From
+	}
+	return port >= r.From && port <= to
+}
+
+// Rule is one ACL entry: CIDR narrows which source addresses it applies to ("" matches any
+// address, the same convention iptrie uses for a default route), Proto/Ports/Direction/Interface
+// narrow the match further, and all of them must agree for the rule to apply. There is no
+// separate deny action - a Rule that matches is always an allow, the same positive-exception
+// model processor.AllowRule uses; traffic that matches nothing is left for the caller's own
+// default (e.g. the processor's block-list) to decide.
+type Rule struct {
+	ID   string `json:"id"`
+	CIDR string `json:"cidr"` // "" matches any source address
+	// Proto is an IANA protocol number (see ProtoTCP/ProtoUDP/ProtoICMP); zero matches any
+	// protocol.
+	Proto types.IPProtocol `json:"proto"`
+	// Ports is evaluated as an OR: the rule matches if the packet's port falls in any entry. A
+	// nil/empty slice matches any port.
+	Ports      []PortRange `json:"ports"`
+	Direction  Direction   `json:"direction"`
+	Interface  string      `json:"interface"` // "" matches any interface
+	Note       string      `json:"note"`
+	CreateTime int64       `json:"create_time"`
+	Enabled    bool        `json:"enabled"`
+}
+
+// Packet is the subset of a flow a Firewall matches against. It's deliberately smaller than
+// types.Packet (which carries MAC addresses, geo fields and match bookkeeping the ACL layer has
+// no use for) and, unlike types.Packet, carries Direction, which types.Packet has no field for.
+type Packet struct {
+	RemoteAddr netip.Addr
+	Port       uint16
+	Proto      types.IPProtocol
+	Direction  Direction
+	Interface  string
+}
+
+// matches reports whether rule applies to pkt, given that the trie lookup has already confirmed
+// rule's CIDR covers pkt.RemoteAddr.
+func (rule *Rule) matches(pkt Packet) bool {
+	if !rule.Enabled {
+		return false
+	}
+	if rule.Direction != DirectionAny && rule.Direction != pkt.Direction {
+		return false
+	}
+	if rule.Interface != "" && rule.Interface != pkt.Interface {
+		return false
+	}
+	if rule.Proto != 0 && rule.Proto != pkt.Proto {
+		return false
+	}
+	if len(rule.Ports) == 0 {
+		return true
+	}
+	for _, pr := range rule.Ports {
+		if pr.contains(pkt.Port) {
+			return true
+		}
+	}
+	return false
+}
+
+// bucket indexes every Rule sharing a CIDR (including the "" any-address CIDR) for lookup,
+// mirroring processor.allowBucket: CIDRs go into an iptrie for O(log n) longest-match, byPrefix
+// recovers which rules a trie hit came from since iptrie.IPTrie itself only tracks presence.
+type bucket struct {
+	trie     *iptrie.IPTrie
+	byPrefix map[string][]*Rule
+	any      []*Rule // rules with CIDR == "", consulted when no narrower CIDR matches
+}
+
+func newBucket() *bucket {
+	return &bucket{trie: iptrie.NewIPTrie(), byPrefix: make(map[string][]*Rule)}
+}
+
+func (b *bucket) add(rule *Rule) error {
+	if rule.CIDR == "" {
+		b.any = append(b.any, rule)
+		return nil
+	}
+	prefix, err := parseRuleCIDR(rule.CIDR)
+	if err != nil {
+		return fmt.Errorf("rule %s: %v", rule.ID, err)
+	}
+	key := prefix.String()
+	if _, exists := b.byPrefix[key]; !exists {
+		if err := b.trie.InsertAddr(prefix); err != nil {
+			return fmt.Errorf("rule %s: %v", rule.ID, err)
+		}
+	}
+	b.byPrefix[key] = append(b.byPrefix[key], rule)
+	return nil
+}
+
+// lookup returns the most specific CIDR bucket covering addr, if any.
+func (b *bucket) lookup(addr netip.Addr) ([]*Rule, bool) {
+	prefix, found := b.trie.LongestMatch(addr)
+	if !found {
+		return nil, false
+	}
+	rules, ok := b.byPrefix[prefix.String()]
+	return rules, ok
+}
+
+// parseRuleCIDR parses value the same way iptrie does internally (bare addresses become host
+// prefixes), so the string form of the resulting netip.Prefix matches what iptrie.LongestMatch
+// hands back and can be used as a byPrefix lookup key.
+func parseRuleCIDR(value string) (netip.Prefix, error) {
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP or CIDR: %s", value)
+	}
+	bits := 32
+	if addr.Is6() {
+		bits = 128
+	}
+	return netip.PrefixFrom(addr, bits), nil
+}
+
+// Firewall is a compiled, read-only Rule set, built once by Compile and then queried concurrently
+// by Allow.
+type Firewall struct {
+	bucket *bucket
+}
+
+// Compile builds a Firewall from rules. Rules are kept in the order they were given: Allow
+// evaluates the candidates a trie hit returns in that same order, so the first enabled rule that
+// also matches proto/port/direction/interface wins. A rule with an invalid CIDR is reported in
+// the returned error and otherwise skipped, so one bad entry doesn't prevent every other rule
+// from loading.
+func Compile(rules []Rule) (*Firewall, error) {
+	b := newBucket()
+	var errs []error
+	for i := range rules {
+		rule := &rules[i]
+		if err := b.add(rule); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return &Firewall{bucket: b}, errors.Join(errs...)
+}
+
+// Allow reports whether pkt matches any rule, and which one. The most specific CIDR bucket
+// covering pkt.RemoteAddr is tried first; if none of its rules match pkt's proto/port/direction,
+// Allow falls back to the CIDR-less ("any source") rules rather than widening to a less specific
+// covering CIDR, the same no-fallback-through-less-specific convention processor.allowBucket.
+// lookupIP uses.
+func (f *Firewall) Allow(pkt Packet) (bool, *Rule) {
+	if f == nil {
+		return false, nil
+	}
+	if rules, ok := f.bucket.lookup(pkt.RemoteAddr); ok {
+		for _, rule := range rules {
+			if rule.matches(pkt) {
+				return true, rule
+			}
+		}
+	}
+	for _, rule := range f.bucket.any {
+		if rule.matches(pkt) {
+			return true, rule
+		}
+	}
+	return false, nil
+}
+
+// Validate reports every structural problem with rule (an invalid CIDR, an invalid direction),
+// the same way processor.validateAllowRule does for AllowRule, so a config validation pass can
+// collect every error in one round-trip instead of failing at the first one found.
+func Validate(rule Rule, add func(field, format string, args ...any)) {
+	if rule.CIDR != "" {
+		if _, err := parseRuleCIDR(rule.CIDR); err != nil {
+			add("cidr", "must be a valid IP or CIDR: %v", err)
+		}
+	}
+	switch rule.Direction {
+	case DirectionInbound, DirectionOutbound, DirectionAny:
+	default:
+		add("direction", "must be one of %q, %q, %q", DirectionInbound, DirectionOutbound, DirectionAny)
+	}
+	for i, pr := range rule.Ports {
+		if pr.To != 0 && pr.To < pr.From {
+			add(fmt.Sprintf("ports[%d]", i), "to must not be less than from")
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package firewall
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestFirewall_Allow_MostSpecificCIDRWins(t *testing.T) {
+	fw, err := Compile([]Rule{
+		{ID: "broad", CIDR: "10.0.0.0/8", Direction: DirectionAny, Enabled: true},
+		{ID: "narrow", CIDR: "10.0.0.0/24", Proto: ProtoTCP, Ports: []PortRange{{From: 443}}, Direction: DirectionAny, Enabled: true},
+	})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	allowed, rule := fw.Allow(Packet{
+		RemoteAddr: netip.MustParseAddr("10.0.0.1"),
+		Port:       443,
+		Proto:      ProtoTCP,
+		Direction:  DirectionInbound,
+	})
+	if !allowed || rule == nil || rule.ID != "narrow" {
+		t.Fatalf("Allow() = (%v, %v), want the narrow rule to win", allowed, rule)
+	}
+}
+
+func TestFirewall_Allow_NoFallbackToBroaderCIDR(t *testing.T) {
+	fw, err := Compile([]Rule{
+		{ID: "broad", CIDR: "10.0.0.0/8", Direction: DirectionAny, Enabled: true},
+		{ID: "narrow", CIDR: "10.0.0.0/24", Proto: ProtoUDP, Direction: DirectionAny, Enabled: true},
+	})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	// The narrow /24 bucket matches first but only allows UDP; a TCP packet should not fall
+	// back to the broader /8, which would otherwise have allowed it.
+	allowed, _ := fw.Allow(Packet{
+		RemoteAddr: netip.MustParseAddr("10.0.0.1"),
+		Port:       22,
+		Proto:      ProtoTCP,
+		Direction:  DirectionInbound,
+	})
+	if allowed {
+		t.Fatal("Allow() = true, want false (narrow bucket shouldn't fall back to the broader CIDR)")
+	}
+}
+
+func TestFirewall_Allow_AnyCIDRFallback(t *testing.T) {
+	fw, err := Compile([]Rule{
+		{ID: "any-source", Proto: ProtoTCP, Ports: []PortRange{{From: 80}}, Direction: DirectionAny, Enabled: true},
+	})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	allowed, rule := fw.Allow(Packet{
+		RemoteAddr: netip.MustParseAddr("203.0.113.5"),
+		Port:       80,
+		Proto:      ProtoTCP,
+		Direction:  DirectionInbound,
+	})
+	if !allowed || rule == nil || rule.ID != "any-source" {
+		t.Fatalf("Allow() = (%v, %v), want the any-source rule to match", allowed, rule)
+	}
+}
+
+func TestFirewall_Allow_DisabledRuleIgnored(t *testing.T) {
+	fw, err := Compile([]Rule{
+		{ID: "disabled", CIDR: "10.0.0.0/24", Direction: DirectionAny, Enabled: false},
+	})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	allowed, _ := fw.Allow(Packet{RemoteAddr: netip.MustParseAddr("10.0.0.1"), Direction: DirectionInbound})
+	if allowed {
+		t.Fatal("Allow() = true, want false for a disabled rule")
+	}
+}
+
+func TestFirewall_Allow_DirectionAndInterfaceScoping(t *testing.T) {
+	fw, err := Compile([]Rule{
+		{ID: "eth0-inbound", CIDR: "10.0.0.0/24", Direction: DirectionInbound, Interface: "eth0", Enabled: true},
+	})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	allowed, _ := fw.Allow(Packet{
+		RemoteAddr: netip.MustParseAddr("10.0.0.1"),
+		Direction:  DirectionOutbound,
+		Interface:  "eth0",
+	})
+	if allowed {
+		t.Fatal("Allow() = true, want false: wrong direction")
+	}
+
+	allowed, _ = fw.Allow(Packet{
+		RemoteAddr: netip.MustParseAddr("10.0.0.1"),
+		Direction:  DirectionInbound,
+		Interface:  "eth1",
+	})
+	if allowed {
+		t.Fatal("Allow() = true, want false: wrong interface")
+	}
+
+	allowed, rule := fw.Allow(Packet{
+		RemoteAddr: netip.MustParseAddr("10.0.0.1"),
+		Direction:  DirectionInbound,
+		Interface:  "eth0",
+	})
+	if !allowed || rule == nil || rule.ID != "eth0-inbound" {
+		t.Fatalf("Allow() = (%v, %v), want eth0-inbound to match", allowed, rule)
+	}
+}
+
+func TestCompile_InvalidCIDRReported(t *testing.T) {
+	_, err := Compile([]Rule{{ID: "bad", CIDR: "not-a-cidr", Enabled: true}})
+	if err == nil {
+		t.Fatal("Compile() error = nil, want an error reporting the invalid CIDR")
+	}
+}
+
+func TestPortRange_Contains(t *testing.T) {
+	tests := []struct {
+		name string
+		pr   PortRange
+		port uint16
+		want bool
+	}{
+		{"zero value matches any port", PortRange{}, 12345, true},
+		{"single port match", PortRange{From: 443}, 443, true},
+		{"single port mismatch", PortRange{From: 443}, 8443, false},
+		{"range match", PortRange{From: 1000, To: 2000}, 1500, true},
+		{"range boundary", PortRange{From: 1000, To: 2000}, 2000, true},
+		{"range miss", PortRange{From: 1000, To: 2000}, 2001, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pr.contains(tt.port); got != tt.want {
+				t.Errorf("contains(%d) = %v, want %v", tt.port, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var errs []string
+	add := func(field, format string, args ...any) {
+		errs = append(errs, field)
+	}
+
+	Validate(Rule{CIDR: "not-a-cidr", Direction: "sideways"}, add)
+	if len(errs) != 2 {
+		t.Fatalf("Validate() reported %d errors, want 2 (cidr, direction): %v", len(errs), errs)
+	}
+
+	errs = nil
+	Validate(Rule{CIDR: "10.0.0.0/24", Direction: DirectionAny, Ports: []PortRange{{From: 100, To: 50}}}, add)
+	if len(errs) != 1 || errs[0] != "ports[0]" {
+		t.Fatalf("Validate() = %v, want a single ports[0] error", errs)
+	}
+}
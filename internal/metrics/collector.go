@@ -2,12 +2,15 @@ package metrics
 
 import (
 	"fmt"
-	"log"
 	"sort"
 	"sync"
 	"time"
 
+	"github.com/sirupsen/logrus"
+
 	"github.com/danger-dream/ebpf-firewall/internal/config"
+	"github.com/danger-dream/ebpf-firewall/internal/events"
+	"github.com/danger-dream/ebpf-firewall/internal/notify"
 	"github.com/danger-dream/ebpf-firewall/internal/types"
 	"github.com/danger-dream/ebpf-firewall/internal/utils"
 )
@@ -23,6 +26,15 @@ const (
 	dimensionEthType = "eth_type"
 	dimensionIPProto = "ip_proto"
 	dimensionMatch   = "match"
+	dimensionAllow   = "allow_reason"
+)
+
+// Verdict labels for RecordVerdict / ebpf_firewall_verdicts_total. Exported so callers outside
+// this package (the processor's final allow/drop decision) can record one without hardcoding
+// the label string.
+const (
+	VerdictAllow = "allow"
+	VerdictDrop  = "drop"
 )
 
 // geo location of a packet
@@ -101,14 +113,21 @@ type MetricsSummary struct {
 
 // MetricsCollector handles the collection and aggregation of network metrics
 type MetricsCollector struct {
-	summary MetricsSummary
-	mu      sync.RWMutex
-	done    chan struct{}
-	storage *MetricsStorage
+	summary      MetricsSummary
+	verdictAllow int64
+	verdictDrop  int64
+	mu           sync.RWMutex
+	done         chan struct{}
+	storage      *MetricsStorage
+	ring         *snapshotRing
+	sizes        *sizeHistogram
+	notifier     *notify.Notifier
+	bus          *events.EventBus
+	logger       logrus.FieldLogger
 }
 
 // NewMetricsCollector creates and initializes a new metrics collector instance
-func NewMetricsCollector() *MetricsCollector {
+func NewMetricsCollector(notifier *notify.Notifier, bus *events.EventBus, logger logrus.FieldLogger) *MetricsCollector {
 	storage := NewMetricsStorage(config.GetConfig().DataDir)
 
 	var summary MetricsSummary
@@ -123,13 +142,19 @@ func NewMetricsCollector() *MetricsCollector {
 	}
 
 	metricsCollector := &MetricsCollector{
-		summary: summary,
-		done:    make(chan struct{}),
-		storage: storage,
+		summary:  summary,
+		done:     make(chan struct{}),
+		storage:  storage,
+		ring:     newSnapshotRing(snapshotRingSize),
+		sizes:    newSizeHistogram(),
+		notifier: notifier,
+		bus:      bus,
+		logger:   logger.WithField("component", "metrics"),
 	}
 
 	go metricsCollector.autoCleanup()
 	go metricsCollector.autoPersist()
+	go metricsCollector.autoSnapshot()
 	return metricsCollector
 }
 
@@ -143,7 +168,7 @@ func (mc *MetricsCollector) autoPersist() {
 			return
 		case <-ticker.C:
 			if err := mc.storage.Save(&mc.summary); err != nil {
-				log.Printf("保存指标数据失败: %v", err)
+				mc.logger.Errorf("failed to persist metrics: %v", err)
 			}
 		}
 	}
@@ -187,6 +212,33 @@ func (mc *MetricsCollector) CollectPacket(packet *types.Packet) {
 	mc.updateSummaryMetrics(packet)
 	mc.updateDimensionMetrics(packet)
 	mc.updateSourceMetrics(packet)
+	mc.sizes.observe(int64(packet.Size))
+
+	if packet.MatchType != types.NoMatch && mc.notifier != nil {
+		mc.notifier.Publish(notify.Event{
+			Type:      "match",
+			Timestamp: time.Now().Unix(),
+			IP:        packet.SrcIP,
+			Message:   fmt.Sprintf("packet matched rule type %d", packet.MatchType),
+		})
+	}
+	if mc.bus != nil {
+		mc.bus.Publish(events.TopicFlow, time.Now().Unix(), packet)
+	}
+}
+
+// RecordVerdict tallies a packet's final allow/drop decision for ebpf_firewall_verdicts_total.
+// It's a separate call from CollectPacket because the verdict (allow-list, policy rules,
+// threat-intel) is only known once the processor has walked the rest of its pipeline, well
+// after CollectPacket records the packet itself.
+func (mc *MetricsCollector) RecordVerdict(verdict string) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if verdict == VerdictDrop {
+		mc.verdictDrop++
+	} else {
+		mc.verdictAllow++
+	}
 }
 
 func (mc *MetricsCollector) updateSummaryMetrics(packet *types.Packet) {
@@ -221,6 +273,9 @@ func (mc *MetricsCollector) updateDimensionMetrics(packet *types.Packet) {
 		}
 		mc.updateMetrics(dimensionMatch, key, packet.Size)
 	}
+	if packet.AllowReason != "" {
+		mc.updateMetrics(dimensionAllow, packet.AllowReason, packet.Size)
+	}
 }
 
 func (mc *MetricsCollector) updateSourceMetrics(packet *types.Packet) {
@@ -311,10 +366,11 @@ func (mc *MetricsCollector) updateMetrics(dimension string, key string, size uin
 
 // summary report of collected metrics
 type MetricsReport struct {
-	TotalPackets int64                   `json:"total_packets"`
-	TotalBytes   int64                   `json:"total_bytes"`
-	Day          []Statistics            `json:"day"`
-	Dimension    map[string][]Statistics `json:"dimension"`
+	TotalPackets         int64                   `json:"total_packets"`
+	TotalBytes           int64                   `json:"total_bytes"`
+	Day                  []Statistics            `json:"day"`
+	Dimension            map[string][]Statistics `json:"dimension"`
+	DroppedNotifications int64                   `json:"dropped_notifications"`
 }
 
 // GenerateReport creates a summary report of collected metrics
@@ -326,6 +382,9 @@ func (mc *MetricsCollector) GenerateReport(top int) MetricsReport {
 		TotalPackets: mc.summary.TotalPackets,
 		TotalBytes:   mc.summary.TotalBytes,
 	}
+	if mc.notifier != nil {
+		result.DroppedNotifications = mc.notifier.DroppedEvents()
+	}
 
 	// collect day statistics
 	dayList := make([]Statistics, 0, len(mc.summary.Day))
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// maximum number of distinct label values exposed per dimension; the remainder is folded
+// into an "_other" bucket so a feed with high-cardinality keys (e.g. source IPs) can't
+// blow up Prometheus's label cardinality
+const prometheusTopN = 20
+
+var packetSizeBuckets = []float64{64, 128, 256, 512, 1024, 1500, 9000}
+
+// cumulative histogram of packet sizes, tracked alongside the existing dimension counters
+type sizeHistogram struct {
+	mu      sync.Mutex
+	buckets []int64
+	count   int64
+	sum     int64
+}
+
+func newSizeHistogram() *sizeHistogram {
+	return &sizeHistogram{buckets: make([]int64, len(packetSizeBuckets))}
+}
+
+func (h *sizeHistogram) observe(size int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.count++
+	h.sum += size
+	for i, bound := range packetSizeBuckets {
+		if float64(size) <= bound {
+			h.buckets[i]++
+		}
+	}
+}
+
+func (h *sizeHistogram) snapshot() (buckets []int64, count, sum int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	buckets = make([]int64, len(h.buckets))
+	copy(buckets, h.buckets)
+	return buckets, h.count, h.sum
+}
+
+// WritePrometheus renders the collector's state in Prometheus text exposition format.
+// Callers must not hold mc.mu; the dimension maps are read under RLock so a slow scraper
+// cannot block the packet-processing path for longer than a snapshot copy takes.
+func (mc *MetricsCollector) WritePrometheus(w io.Writer) error {
+	mc.mu.RLock()
+	dimension := make(map[string]map[string]*Statistics, len(mc.summary.Statistics))
+	for category, stats := range mc.summary.Statistics {
+		inner := make(map[string]*Statistics, len(stats))
+		for key, stat := range stats {
+			s := *stat
+			inner[key] = &s
+		}
+		dimension[category] = inner
+	}
+	sources := len(mc.summary.Source)
+	verdictAllow, verdictDrop := mc.verdictAllow, mc.verdictDrop
+	mc.mu.RUnlock()
+
+	fmt.Fprintln(w, "# HELP ebpf_firewall_packets_total Total packets observed, broken down by dimension and value.")
+	fmt.Fprintln(w, "# TYPE ebpf_firewall_packets_total counter")
+	for category, stats := range dimension {
+		writeCappedCounter(w, "ebpf_firewall_packets_total", category, stats, func(s *Statistics) int64 { return s.TotalPackets })
+	}
+
+	fmt.Fprintln(w, "# HELP ebpf_firewall_bytes_total Total bytes observed, broken down by dimension and value.")
+	fmt.Fprintln(w, "# TYPE ebpf_firewall_bytes_total counter")
+	for category, stats := range dimension {
+		writeCappedCounter(w, "ebpf_firewall_bytes_total", category, stats, func(s *Statistics) int64 { return s.TotalBytes })
+	}
+
+	if matches, ok := dimension[dimensionMatch]; ok {
+		fmt.Fprintln(w, "# HELP ebpf_firewall_matches_total Total packets matched by a rule/feed, by key.")
+		fmt.Fprintln(w, "# TYPE ebpf_firewall_matches_total counter")
+		writeCappedCounter(w, "ebpf_firewall_matches_total", dimensionMatch, matches, func(s *Statistics) int64 { return s.TotalPackets })
+	}
+
+	fmt.Fprintln(w, "# HELP ebpf_firewall_verdicts_total Total packets by final firewall verdict.")
+	fmt.Fprintln(w, "# TYPE ebpf_firewall_verdicts_total counter")
+	fmt.Fprintf(w, "ebpf_firewall_verdicts_total{verdict=%q} %d\n", VerdictAllow, verdictAllow)
+	fmt.Fprintf(w, "ebpf_firewall_verdicts_total{verdict=%q} %d\n", VerdictDrop, verdictDrop)
+
+	fmt.Fprintln(w, "# HELP ebpf_firewall_sources Number of distinct traffic sources currently tracked.")
+	fmt.Fprintln(w, "# TYPE ebpf_firewall_sources gauge")
+	fmt.Fprintf(w, "ebpf_firewall_sources %d\n", sources)
+
+	buckets, count, sum := mc.sizes.snapshot()
+	fmt.Fprintln(w, "# HELP ebpf_firewall_packet_size_bytes Distribution of observed packet sizes.")
+	fmt.Fprintln(w, "# TYPE ebpf_firewall_packet_size_bytes histogram")
+	for i, bound := range packetSizeBuckets {
+		fmt.Fprintf(w, "ebpf_firewall_packet_size_bytes_bucket{le=\"%g\"} %d\n", bound, buckets[i])
+	}
+	fmt.Fprintf(w, "ebpf_firewall_packet_size_bytes_bucket{le=\"+Inf\"} %d\n", count)
+	fmt.Fprintf(w, "ebpf_firewall_packet_size_bytes_sum %d\n", sum)
+	fmt.Fprintf(w, "ebpf_firewall_packet_size_bytes_count %d\n", count)
+	return nil
+}
+
+// writeCappedCounter emits one series per key up to prometheusTopN, folding the remainder
+// into a single "_other" series so cardinality stays bounded regardless of dataset size.
+func writeCappedCounter(w io.Writer, metric, dimension string, stats map[string]*Statistics, value func(*Statistics) int64) {
+	keys := make([]string, 0, len(stats))
+	for key := range stats {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return value(stats[keys[i]]) > value(stats[keys[j]])
+	})
+
+	var other int64
+	for i, key := range keys {
+		if i >= prometheusTopN {
+			other += value(stats[key])
+			continue
+		}
+		fmt.Fprintf(w, "%s{dimension=%q,value=%q} %d\n", metric, dimension, key, value(stats[key]))
+	}
+	if other > 0 {
+		fmt.Fprintf(w, "%s{dimension=%q,value=\"_other\"} %d\n", metric, dimension, other)
+	}
+}
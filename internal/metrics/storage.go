@@ -1,39 +1,95 @@
 package metrics
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 )
 
+const (
+	storageVersion    = 1
+	currentFileName   = "metrics.json.gz"
+	dayFilePrefix     = "metrics-"
+	sourceFilePrefix  = "source-"
+	storageFileSuffix = ".json.gz"
+	sourceShardCount  = 16
+)
+
+// fileEnvelope wraps every on-disk blob with a version and a checksum over the payload so a
+// file left half-written by a crash is detected on Load and skipped instead of corrupting the
+// in-memory summary it would otherwise be merged into.
+type fileEnvelope struct {
+	Version  int             `json:"version"`
+	Checksum uint32          `json:"checksum"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// currentSnapshot holds everything that isn't naturally keyed by day or by source: the
+// lifetime totals and the dimension breakdowns.
+type currentSnapshot struct {
+	TotalPackets int64                             `json:"total_packets"`
+	TotalBytes   int64                             `json:"total_bytes"`
+	Statistics   map[string]map[string]*Statistics `json:"statistics"`
+}
+
 type MetricsStorage struct {
-	filePath string
-	mu       sync.RWMutex
+	dataDir string
+	mu      sync.RWMutex
 }
 
 func NewMetricsStorage(dataDir string) *MetricsStorage {
 	return &MetricsStorage{
-		filePath: filepath.Join(dataDir, "metrics.json"),
+		dataDir: dataDir,
 	}
 }
 
+// Save writes the current summary as a rolling, gzip-compressed layout: one file for today's
+// day bucket, one file per source shard, and a current blob for the lifetime totals and
+// dimension statistics. Older day files outside the retention window are pruned on write
+// instead of accumulating forever.
 func (ms *MetricsStorage) Save(metrics *MetricsSummary) error {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
 
-	data, err := json.Marshal(metrics)
-	if err != nil {
-		return err
+	if err := ms.writeFile(currentFileName, currentSnapshot{
+		TotalPackets: metrics.TotalPackets,
+		TotalBytes:   metrics.TotalBytes,
+		Statistics:   metrics.Statistics,
+	}); err != nil {
+		return fmt.Errorf("failed to save current snapshot: %v", err)
+	}
+
+	today := time.Now().Format(DayFormat)
+	if dayStats, ok := metrics.Day[today]; ok {
+		if err := ms.writeFile(dayFileName(today), dayStats); err != nil {
+			return fmt.Errorf("failed to save day bucket %s: %v", today, err)
+		}
 	}
-	return os.WriteFile(ms.filePath, data, 0644)
+
+	for shard, sources := range shardSources(metrics.Source) {
+		if err := ms.writeFile(sourceFileName(shard), sources); err != nil {
+			return fmt.Errorf("failed to save source shard %d: %v", shard, err)
+		}
+	}
+
+	return ms.pruneStaleDayFiles()
 }
 
+// Load reconstructs a MetricsSummary from the current blob, every day bucket still within
+// retention and every source shard, merging them back into a single in-memory snapshot.
 func (ms *MetricsStorage) Load() (*MetricsSummary, error) {
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
 
-	data, err := os.ReadFile(ms.filePath)
+	entries, err := os.ReadDir(ms.dataDir)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, nil
@@ -41,15 +97,208 @@ func (ms *MetricsStorage) Load() (*MetricsSummary, error) {
 		return nil, err
 	}
 
-	var metrics MetricsSummary
-	if err := json.Unmarshal(data, &metrics); err != nil {
-		return nil, err
+	summary := &MetricsSummary{
+		Day:        make(map[string]Statistics),
+		Statistics: make(map[string]map[string]*Statistics),
+		Source:     make(map[string]SourceStatistic),
 	}
-	return &metrics, nil
+	found := false
+
+	var current currentSnapshot
+	if ok, err := ms.readFile(currentFileName, &current); err == nil && ok {
+		found = true
+		summary.TotalPackets = current.TotalPackets
+		summary.TotalBytes = current.TotalBytes
+		if current.Statistics != nil {
+			summary.Statistics = current.Statistics
+		}
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -DefaultRetentionDays)
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case strings.HasPrefix(name, dayFilePrefix):
+			day := strings.TrimSuffix(strings.TrimPrefix(name, dayFilePrefix), storageFileSuffix)
+			dayTime, err := time.Parse(DayFormat, day)
+			if err != nil || dayTime.Before(cutoff) {
+				continue
+			}
+			var stats Statistics
+			if ok, err := ms.readFile(name, &stats); err == nil && ok {
+				found = true
+				summary.Day[day] = stats
+			}
+		case strings.HasPrefix(name, sourceFilePrefix):
+			var sources map[string]SourceStatistic
+			if ok, err := ms.readFile(name, &sources); err == nil && ok {
+				found = true
+				for key, source := range sources {
+					summary.Source[key] = source
+				}
+			}
+		}
+	}
+
+	if !found {
+		return nil, nil
+	}
+	return summary, nil
+}
+
+// pruneStaleDayFiles removes day buckets that have fallen outside the retention window so
+// disk usage tracks active days instead of growing forever.
+func (ms *MetricsStorage) pruneStaleDayFiles() error {
+	entries, err := os.ReadDir(ms.dataDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	cutoff := time.Now().AddDate(0, 0, -DefaultRetentionDays)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, dayFilePrefix) {
+			continue
+		}
+		day := strings.TrimSuffix(strings.TrimPrefix(name, dayFilePrefix), storageFileSuffix)
+		dayTime, err := time.Parse(DayFormat, day)
+		if err != nil {
+			continue
+		}
+		if dayTime.Before(cutoff) {
+			os.Remove(filepath.Join(ms.dataDir, name))
+		}
+	}
+	return nil
 }
 
 func (ms *MetricsStorage) DeleteMetrics() error {
 	ms.mu.Lock()
 	defer ms.mu.Unlock()
-	return os.Remove(ms.filePath)
+
+	entries, err := os.ReadDir(ms.dataDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == currentFileName || strings.HasPrefix(name, dayFilePrefix) || strings.HasPrefix(name, sourceFilePrefix) {
+			if err := os.Remove(filepath.Join(ms.dataDir, name)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeFile gzip-compresses payload wrapped in a version/checksum envelope and atomically
+// replaces the target file via a temp file + rename, so a crash mid-write never leaves a
+// truncated file in the final path.
+func (ms *MetricsStorage) writeFile(name string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	envelope := fileEnvelope{
+		Version:  storageVersion,
+		Checksum: crc32.ChecksumIEEE(data),
+		Data:     data,
+	}
+	raw, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(ms.dataDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(ms.dataDir, ".tmp-"+name+"-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	gz := gzip.NewWriter(tmp)
+	if _, err := gz.Write(raw); err != nil {
+		gz.Close()
+		tmp.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filepath.Join(ms.dataDir, name))
+}
+
+// readFile decompresses and validates a stored blob. It returns ok=false (with no error) when
+// the file does not exist yet, and an error when the file exists but is corrupt or truncated,
+// so callers can decide whether to skip it rather than trust a partially-written file.
+func (ms *MetricsStorage) readFile(name string, out any) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(ms.dataDir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return false, fmt.Errorf("corrupt metrics file %s: %v", name, err)
+	}
+	defer gz.Close()
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(gz); err != nil {
+		return false, fmt.Errorf("corrupt metrics file %s: %v", name, err)
+	}
+
+	var envelope fileEnvelope
+	if err := json.Unmarshal(buf.Bytes(), &envelope); err != nil {
+		return false, fmt.Errorf("corrupt metrics file %s: %v", name, err)
+	}
+	if envelope.Checksum != crc32.ChecksumIEEE(envelope.Data) {
+		return false, fmt.Errorf("checksum mismatch in metrics file %s, skipping", name)
+	}
+	if err := json.Unmarshal(envelope.Data, out); err != nil {
+		return false, fmt.Errorf("failed to decode metrics file %s: %v", name, err)
+	}
+	return true, nil
+}
+
+func dayFileName(day string) string {
+	return dayFilePrefix + day + storageFileSuffix
+}
+
+func sourceFileName(shard int) string {
+	return fmt.Sprintf("%s%03d%s", sourceFilePrefix, shard, storageFileSuffix)
+}
+
+// shardSources partitions the source map by key hash into sourceShardCount shards, one file
+// each. Save rewrites every shard on each call, including shards whose sources did not change.
+func shardSources(sources map[string]SourceStatistic) map[int]map[string]SourceStatistic {
+	shards := make(map[int]map[string]SourceStatistic, sourceShardCount)
+	for i := 0; i < sourceShardCount; i++ {
+		shards[i] = make(map[string]SourceStatistic)
+	}
+	for key, source := range sources {
+		shards[shardIndex(key)][key] = source
+	}
+	return shards
+}
+
+func shardIndex(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % sourceShardCount)
 }
@@ -0,0 +1,225 @@
+package metrics
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/danger-dream/ebpf-firewall/internal/events"
+)
+
+// number of 1s snapshots retained, enough to compute deltas over a 5 minute window
+const snapshotRingSize = 300
+
+// point-in-time copy of the cumulative counters, used to compute per-interval deltas
+type Snapshot struct {
+	Timestamp    int64
+	TotalPackets int64
+	TotalBytes   int64
+	Dimension    map[string]map[string]TrafficMetrics
+}
+
+// fixed-size circular buffer of snapshots
+type snapshotRing struct {
+	mu    sync.RWMutex
+	buf   []Snapshot
+	head  int
+	count int
+}
+
+func newSnapshotRing(capacity int) *snapshotRing {
+	return &snapshotRing{buf: make([]Snapshot, capacity), head: -1}
+}
+
+func (r *snapshotRing) push(s Snapshot) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.head = (r.head + 1) % len(r.buf)
+	r.buf[r.head] = s
+	if r.count < len(r.buf) {
+		r.count++
+	}
+}
+
+// at returns the snapshot `steps` pushes before the latest one
+func (r *snapshotRing) at(steps int) (Snapshot, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.head < 0 || steps >= r.count {
+		return Snapshot{}, false
+	}
+	idx := (r.head - steps + len(r.buf)) % len(r.buf)
+	return r.buf[idx], true
+}
+
+func (r *snapshotRing) latest() (Snapshot, bool) {
+	return r.at(0)
+}
+
+// which dimensions a stream "types" filter maps to; blocks currently surfaces the same
+// match dimension as matches since the collector has no dedicated blocklist dimension yet
+var typeDimensions = map[string][]string{
+	"traffic": {dimensionCountry, dimensionCity, dimensionPort, dimensionEthType, dimensionIPProto},
+	"matches": {dimensionMatch},
+	"blocks":  {dimensionMatch},
+}
+
+func dimensionsForTypes(types []string) []string {
+	if len(types) == 0 {
+		return []string{dimensionCountry, dimensionCity, dimensionPort, dimensionEthType, dimensionIPProto, dimensionMatch}
+	}
+	seen := make(map[string]bool)
+	categories := make([]string, 0)
+	for _, t := range types {
+		for _, category := range typeDimensions[t] {
+			if !seen[category] {
+				seen[category] = true
+				categories = append(categories, category)
+			}
+		}
+	}
+	return categories
+}
+
+// per-interval delta computed from two ring snapshots
+type MetricsDelta struct {
+	Timestamp       int64                   `json:"timestamp"`
+	IntervalSeconds int                     `json:"interval_seconds"`
+	PacketsPerSec   float64                 `json:"packets_per_sec"`
+	BytesPerSec     float64                 `json:"bytes_per_sec"`
+	Dimension       map[string][]Statistics `json:"dimension,omitempty"`
+}
+
+// takes a snapshot of the current cumulative counters into the ring buffer
+func (mc *MetricsCollector) snapshot() {
+	mc.mu.RLock()
+	defer mc.mu.RUnlock()
+	dim := make(map[string]map[string]TrafficMetrics, len(mc.summary.Statistics))
+	for category, stats := range mc.summary.Statistics {
+		inner := make(map[string]TrafficMetrics, len(stats))
+		for key, stat := range stats {
+			inner[key] = stat.TrafficMetrics
+		}
+		dim[category] = inner
+	}
+	mc.ring.push(Snapshot{
+		Timestamp:    time.Now().Unix(),
+		TotalPackets: mc.summary.TotalPackets,
+		TotalBytes:   mc.summary.TotalBytes,
+		Dimension:    dim,
+	})
+
+	if mc.bus != nil {
+		if delta, ok := mc.computeDelta(1, dimensionsForTypes(nil)); ok {
+			mc.bus.Publish(events.TopicMetrics, delta.Timestamp, delta)
+		}
+	}
+}
+
+// periodically records a snapshot for the streaming API
+func (mc *MetricsCollector) autoSnapshot() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-mc.done:
+			return
+		case <-ticker.C:
+			mc.snapshot()
+		}
+	}
+}
+
+func (mc *MetricsCollector) computeDelta(steps int, categories []string) (MetricsDelta, bool) {
+	latest, ok := mc.ring.latest()
+	if !ok {
+		return MetricsDelta{}, false
+	}
+	prev, ok := mc.ring.at(steps)
+	if !ok {
+		return MetricsDelta{}, false
+	}
+	elapsed := latest.Timestamp - prev.Timestamp
+	if elapsed <= 0 {
+		return MetricsDelta{}, false
+	}
+	delta := MetricsDelta{
+		Timestamp:       latest.Timestamp,
+		IntervalSeconds: int(elapsed),
+		PacketsPerSec:   float64(latest.TotalPackets-prev.TotalPackets) / float64(elapsed),
+		BytesPerSec:     float64(latest.TotalBytes-prev.TotalBytes) / float64(elapsed),
+		Dimension:       make(map[string][]Statistics, len(categories)),
+	}
+	for _, category := range categories {
+		curStats := latest.Dimension[category]
+		prevStats := prev.Dimension[category]
+		list := make([]Statistics, 0, len(curStats))
+		for key, cur := range curStats {
+			old := prevStats[key]
+			packets := cur.TotalPackets - old.TotalPackets
+			bytes := cur.TotalBytes - old.TotalBytes
+			if packets == 0 && bytes == 0 {
+				continue
+			}
+			list = append(list, Statistics{
+				Key: key,
+				TrafficMetrics: TrafficMetrics{
+					TotalPackets: packets,
+					TotalBytes:   bytes,
+					FirstSeenAt:  cur.FirstSeenAt,
+					LastSeenAt:   cur.LastSeenAt,
+				},
+			})
+		}
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].TotalPackets > list[j].TotalPackets
+		})
+		delta.Dimension[category] = list
+	}
+	return delta, true
+}
+
+// StreamDeltas emits one MetricsDelta per interval computed from the snapshot ring buffer,
+// rather than the cumulative counters returned by GenerateReport. It stops and closes the
+// returned channel when ctx is cancelled (e.g. client disconnect), n samples have been sent
+// (n <= 0 means unbounded), or the collector itself is closed. types filters which dimensions
+// are included; an empty slice includes all of them.
+func (mc *MetricsCollector) StreamDeltas(ctx context.Context, interval time.Duration, n int, types []string) <-chan MetricsDelta {
+	if interval < time.Second {
+		interval = time.Second
+	}
+	steps := int(interval / time.Second)
+	categories := dimensionsForTypes(types)
+
+	out := make(chan MetricsDelta)
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		sent := 0
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-mc.done:
+				return
+			case <-ticker.C:
+				delta, ok := mc.computeDelta(steps, categories)
+				if !ok {
+					continue
+				}
+				select {
+				case out <- delta:
+				case <-ctx.Done():
+					return
+				}
+				sent++
+				if n > 0 && sent >= n {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBatchSize  = 20
+	defaultQueueSize  = 1024
+	flushInterval     = 5 * time.Second
+	maxSendAttempts   = 5
+	initialBackoff    = time.Second
+	maxBackoffFactor  = 16
+)
+
+// route pairs a sink with its own bounded queue and event-type filter so a slow sink cannot
+// starve the others and cannot block Publish.
+type route struct {
+	sink       Sink
+	eventTypes map[string]bool // nil means "all types"
+	batchSize  int
+	queue      chan Event
+}
+
+// Notifier fans events out to a set of registered sinks, batching per sink and retrying
+// failed sends with exponential backoff.
+type Notifier struct {
+	routes  []*route
+	dropped atomic.Int64
+	done    chan struct{}
+	logger  logrus.FieldLogger
+}
+
+func NewNotifier(logger logrus.FieldLogger) *Notifier {
+	return &Notifier{done: make(chan struct{}), logger: logger.WithField("component", "notify")}
+}
+
+// AddSink registers a sink, filtered to eventTypes (empty means all types), and starts its
+// dispatch goroutine. Not safe to call concurrently with Publish.
+func (n *Notifier) AddSink(sink Sink, eventTypes []string, batchSize, queueSize int) {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	var filter map[string]bool
+	if len(eventTypes) > 0 {
+		filter = make(map[string]bool, len(eventTypes))
+		for _, t := range eventTypes {
+			filter[t] = true
+		}
+	}
+	r := &route{sink: sink, eventTypes: filter, batchSize: batchSize, queue: make(chan Event, queueSize)}
+	n.routes = append(n.routes, r)
+	go n.run(r)
+}
+
+// Publish fans the event out to every matching sink without blocking the caller; a full
+// per-sink queue drops the event and increments the shared dropped-event counter instead of
+// stalling packet processing.
+func (n *Notifier) Publish(event Event) {
+	for _, r := range n.routes {
+		if r.eventTypes != nil && !r.eventTypes[event.Type] {
+			continue
+		}
+		select {
+		case r.queue <- event:
+		default:
+			n.dropped.Add(1)
+		}
+	}
+}
+
+// DroppedEvents returns the number of events dropped so far due to a full sink queue.
+func (n *Notifier) DroppedEvents() int64 {
+	return n.dropped.Load()
+}
+
+func (n *Notifier) Close() {
+	close(n.done)
+}
+
+func (n *Notifier) run(r *route) {
+	batch := make([]Event, 0, r.batchSize)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		backoff := initialBackoff
+		for attempt := 1; attempt <= maxSendAttempts; attempt++ {
+			if err := r.sink.Send(batch); err != nil {
+				n.logger.WithFields(logrus.Fields{
+					"sink":    r.sink.Name(),
+					"attempt": attempt,
+					"max":     maxSendAttempts,
+				}).Warnf("sink send failed: %v", err)
+				select {
+				case <-time.After(backoff):
+				case <-n.done:
+					batch = batch[:0]
+					return
+				}
+				if backoff < initialBackoff*maxBackoffFactor {
+					backoff *= 2
+				}
+				continue
+			}
+			break
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-n.done:
+			send()
+			return
+		case e := <-r.queue:
+			batch = append(batch, e)
+			if len(batch) >= r.batchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		}
+	}
+}
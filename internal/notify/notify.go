@@ -0,0 +1,19 @@
+// Package notify fans out firewall events (blocks, threat-intel hits, rule matches) to
+// configurable outbound webhooks without letting a slow or unreachable endpoint block the
+// packet-processing path.
+package notify
+
+// Event is a single notification fanned out to every sink whose event-type filter matches.
+type Event struct {
+	Type      string         `json:"type"` // "block", "threat_intel", "match"
+	Timestamp int64          `json:"timestamp"`
+	IP        string         `json:"ip,omitempty"`
+	Message   string         `json:"message"`
+	Extra     map[string]any `json:"extra,omitempty"`
+}
+
+// Sink delivers a batch of events to a single destination.
+type Sink interface {
+	Name() string
+	Send(events []Event) error
+}
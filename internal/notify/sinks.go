@@ -0,0 +1,81 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// GenericSink posts a JSON array of events to an arbitrary HTTP endpoint.
+type GenericSink struct {
+	url    string
+	client *http.Client
+}
+
+func NewGenericSink(url string, timeout time.Duration) *GenericSink {
+	return &GenericSink{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (g *GenericSink) Name() string { return "generic:" + g.url }
+
+func (g *GenericSink) Send(events []Event) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	resp, err := g.client.Post(g.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("sink %s returned %s", g.url, resp.Status)
+	}
+	return nil
+}
+
+// SplunkHECSink posts events to a Splunk HTTP Event Collector endpoint, one event-wrapper
+// object per line as HEC expects.
+type SplunkHECSink struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func NewSplunkHECSink(url, token string, timeout time.Duration) *SplunkHECSink {
+	return &SplunkHECSink{url: url, token: token, client: &http.Client{Timeout: timeout}}
+}
+
+func (s *SplunkHECSink) Name() string { return "splunk_hec:" + s.url }
+
+type splunkEvent struct {
+	Event Event `json:"event"`
+	Time  int64 `json:"time"`
+}
+
+func (s *SplunkHECSink) Send(events []Event) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range events {
+		if err := enc.Encode(splunkEvent{Event: e, Time: e.Timestamp}); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Splunk "+s.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("sink %s returned %s", s.url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,401 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/danger-dream/ebpf-firewall/internal/threatintel/iptrie"
+	"github.com/danger-dream/ebpf-firewall/internal/utils"
+)
+
+const (
+	ptrCacheTTL         = time.Hour
+	ptrNegativeCacheTTL = 5 * time.Minute
+	// ptrResolverWorkers bounds how many reverse-DNS lookups run concurrently. Without this,
+	// resolvePTR's cache-miss path would spawn one goroutine per distinct, never-before-seen
+	// source IP with no upper bound, which a scan sweeping through a large address range could
+	// turn into an unbounded goroutine pile-up.
+	ptrResolverWorkers = 8
+)
+
+// AllowRule is an exception consulted before any block decision. A rule matches either by
+// address (Value, an IP or CIDR) or by reverse-DNS name (Name, a regex matched against the
+// PTR records resolved for the source IP) — exactly one of the two is set. Interface scopes the
+// rule to traffic seen on a given netdev; empty means it applies regardless of interface.
+type AllowRule struct {
+	ID         string `json:"id"`
+	Value      string `json:"value"` // IP/CIDR; mutually exclusive with Name
+	Name       string `json:"name"`  // reverse-DNS PTR regex, e.g. `.*\.googlebot\.com$`
+	Interface  string `json:"interface"`
+	Note       string `json:"note"`
+	CreateTime int64  `json:"create_time"`
+	Enabled    bool   `json:"enabled"`
+}
+
+// ScopedAllowList is an AllowList that only applies to traffic whose destination falls inside
+// InsideCIDR, modeled on Nebula's RemoteAllowList: an operator can allow different externals
+// depending on which internal network the traffic is destined for.
+type ScopedAllowList struct {
+	InsideCIDR string      `json:"inside_cidr"`
+	Rules      []AllowRule `json:"rules"`
+}
+
+// AllowVerdict reports whether a source address is covered by an allow rule and, if so, which
+// one, so callers (and metrics) can distinguish "passed because allowed" from "passed because no
+// rule matched at all".
+type AllowVerdict struct {
+	Allowed bool
+	Rule    *AllowRule
+	Reason  string // "allow_ip", "allow_name", or "" when nothing matched
+}
+
+// nameAllowRule is an AllowRule with its Name already compiled, so the hot path never pays for
+// regexp.Compile.
+type nameAllowRule struct {
+	rule *AllowRule
+	re   *regexp.Regexp
+}
+
+// allowBucket indexes one AllowList (global or scoped) for lookup: plain IP/CIDR rules go into
+// an iptrie for O(log n) longest-match, grouped by Interface so a rule scoped to a netdev never
+// matches traffic on another one; byPrefix recovers which rule a trie hit came from, since
+// iptrie.IPTrie itself only tracks presence.
+type allowBucket struct {
+	tries    map[string]*iptrie.IPTrie     // keyed by Interface, "" meaning every interface
+	byPrefix map[string]map[string]*AllowRule // interface -> prefix string -> rule
+	names    []nameAllowRule
+}
+
+func newAllowBucket() *allowBucket {
+	return &allowBucket{
+		tries:    make(map[string]*iptrie.IPTrie),
+		byPrefix: make(map[string]map[string]*AllowRule),
+	}
+}
+
+func (b *allowBucket) addIPRule(rule *AllowRule, logger logrus.FieldLogger) {
+	prefix, err := parseAllowPrefix(rule.Value)
+	if err != nil {
+		logger.WithField("rule_id", rule.ID).Errorf("allow-list rule: %v", err)
+		return
+	}
+	trie, ok := b.tries[rule.Interface]
+	if !ok {
+		trie = iptrie.NewIPTrie()
+		b.tries[rule.Interface] = trie
+		b.byPrefix[rule.Interface] = make(map[string]*AllowRule)
+	}
+	if err := trie.Insert(rule.Value); err != nil {
+		logger.WithField("rule_id", rule.ID).Errorf("allow-list rule: %v", err)
+		return
+	}
+	b.byPrefix[rule.Interface][prefix.String()] = rule
+}
+
+func (b *allowBucket) lookupIP(srcIP, iface string) (*AllowRule, bool) {
+	addr, err := netip.ParseAddr(srcIP)
+	if err != nil {
+		return nil, false
+	}
+	keys := []string{""}
+	if iface != "" {
+		keys = []string{iface, ""}
+	}
+	for _, key := range keys {
+		trie, ok := b.tries[key]
+		if !ok {
+			continue
+		}
+		prefix, found := trie.LongestMatch(addr)
+		if !found {
+			continue
+		}
+		if rule, ok := b.byPrefix[key][prefix.String()]; ok {
+			return rule, true
+		}
+	}
+	return nil, false
+}
+
+func (b *allowBucket) lookupName(hostnames []string, iface string) (*AllowRule, bool) {
+	for i := range b.names {
+		nr := &b.names[i]
+		if nr.rule.Interface != "" && nr.rule.Interface != iface {
+			continue
+		}
+		for _, host := range hostnames {
+			if nr.re.MatchString(host) {
+				return nr.rule, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// parseAllowPrefix parses value the same way iptrie does internally (bare addresses become host
+// prefixes), so the string form of the resulting netip.Prefix matches what iptrie.LongestMatch
+// hands back and can be used as a lookup key.
+func parseAllowPrefix(value string) (netip.Prefix, error) {
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP or CIDR: %s", value)
+	}
+	bits := 32
+	if addr.Is6() {
+		bits = 128
+	}
+	return netip.PrefixFrom(addr, bits), nil
+}
+
+func validateAllowRule(field string, rule AllowRule, add func(field, format string, args ...any)) {
+	if rule.Value == "" && rule.Name == "" {
+		add(field, "must set either value or name")
+		return
+	}
+	if rule.Value != "" && rule.Name != "" {
+		add(field, "must not set both value and name")
+		return
+	}
+	if rule.Value != "" {
+		if _, err := parseAllowPrefix(rule.Value); err != nil {
+			add(field+".value", "must be a valid IP or CIDR: %v", err)
+		}
+	}
+	if rule.Name != "" {
+		if _, err := regexp.Compile(rule.Name); err != nil {
+			add(field+".name", "must be a valid regular expression: %v", err)
+		}
+	}
+}
+
+func buildAllowBucket(rules []AllowRule, logger logrus.FieldLogger) *allowBucket {
+	b := newAllowBucket()
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.Enabled {
+			continue
+		}
+		if rule.Value != "" {
+			b.addIPRule(rule, logger)
+			continue
+		}
+		re, err := regexp.Compile(rule.Name)
+		if err != nil {
+			logger.WithField("rule_id", rule.ID).Errorf("allow-list rule: invalid name pattern: %v", err)
+			continue
+		}
+		b.names = append(b.names, nameAllowRule{rule: rule, re: re})
+	}
+	return b
+}
+
+// allowIndex is the built form of ProcessorConfig.AllowList, rebuilt on every load/update/reload
+// so the hot path never parses CIDRs or compiles regexes itself.
+type allowIndex struct {
+	global *allowBucket
+	scoped []scopedAllowBucket
+}
+
+type scopedAllowBucket struct {
+	prefix netip.Prefix
+	bucket *allowBucket
+}
+
+func buildAllowIndex(config *ProcessorConfig, logger logrus.FieldLogger) *allowIndex {
+	idx := &allowIndex{global: buildAllowBucket(config.AllowList.Rules, logger)}
+	for _, scope := range config.AllowList.Scoped {
+		prefix, err := netip.ParsePrefix(scope.InsideCIDR)
+		if err != nil {
+			logger.WithField("inside_cidr", scope.InsideCIDR).Errorf("allow-list scope: %v", err)
+			continue
+		}
+		idx.scoped = append(idx.scoped, scopedAllowBucket{prefix: prefix, bucket: buildAllowBucket(scope.Rules, logger)})
+	}
+	// longest (most specific) inside-CIDR first, so an operator can layer a broad allow-list
+	// under a narrower one without the broad scope shadowing it.
+	sort.Slice(idx.scoped, func(i, j int) bool {
+		return idx.scoped[i].prefix.Bits() > idx.scoped[j].prefix.Bits()
+	})
+	return idx
+}
+
+func (p *Processor) rebuildAllowIndex(config *ProcessorConfig) {
+	p.allowIdx.Store(buildAllowIndex(config, p.logger))
+}
+
+func (p *Processor) getAllowIndex() *allowIndex {
+	idx, _ := p.allowIdx.Load().(*allowIndex)
+	return idx
+}
+
+// IsAllowed is consulted before any block decision in the hot path. insideIP is the packet's
+// destination address: if it falls inside a configured ScopedAllowList.InsideCIDR, that scope is
+// checked (most specific inside-CIDR wins) before falling back to the global allow-list. iface is
+// the netdev the packet was seen on; pass "" if unknown, in which case only interface-unscoped
+// rules can match.
+func (p *Processor) IsAllowed(srcIP, insideIP, iface string) AllowVerdict {
+	idx := p.getAllowIndex()
+	if idx == nil {
+		return AllowVerdict{}
+	}
+
+	if addr, err := netip.ParseAddr(insideIP); err == nil {
+		for _, scope := range idx.scoped {
+			if !scope.prefix.Contains(addr) {
+				continue
+			}
+			if v := p.checkAllowBucket(scope.bucket, srcIP, iface); v.Allowed {
+				return v
+			}
+			break
+		}
+	}
+	return p.checkAllowBucket(idx.global, srcIP, iface)
+}
+
+func (p *Processor) checkAllowBucket(b *allowBucket, srcIP, iface string) AllowVerdict {
+	if b == nil {
+		return AllowVerdict{}
+	}
+	if rule, ok := b.lookupIP(srcIP, iface); ok {
+		return AllowVerdict{Allowed: true, Rule: rule, Reason: "allow_ip"}
+	}
+	if len(b.names) == 0 {
+		return AllowVerdict{}
+	}
+	hostnames := p.resolvePTR(srcIP)
+	if len(hostnames) == 0 {
+		return AllowVerdict{}
+	}
+	if rule, ok := b.lookupName(hostnames, iface); ok {
+		return AllowVerdict{Allowed: true, Rule: rule, Reason: "allow_name"}
+	}
+	return AllowVerdict{}
+}
+
+// ptrCacheEntry caches the result of a reverse-DNS lookup, positive or negative, so a hostile
+// source can't turn every name-rule check into a live DNS round trip.
+type ptrCacheEntry struct {
+	hostnames []string
+	expiresAt int64
+}
+
+// resolvePTR returns the cached PTR names for ip, if any, and kicks off an asynchronous refresh
+// when the cache is missing or stale. It never waits for a DNS lookup to finish, but submitting
+// the refresh to ptrPool blocks while that pool's queue is full.
+func (p *Processor) resolvePTR(ip string) []string {
+	now := time.Now().Unix()
+	if val, ok := p.ptrCache.Load(ip); ok {
+		entry := val.(*ptrCacheEntry)
+		if entry.expiresAt > now {
+			return entry.hostnames
+		}
+	}
+
+	if _, inFlight := p.ptrInFlight.LoadOrStore(ip, struct{}{}); !inFlight {
+		_, wait := p.ptrPool.SubmitTask(context.Background(), ip, 0)
+		go func() {
+			defer p.ptrInFlight.Delete(ip)
+			res := wait()
+			if res.Err != nil || res.PanicVal != nil {
+				p.ptrCache.Store(ip, &ptrCacheEntry{expiresAt: time.Now().Add(ptrNegativeCacheTTL).Unix()})
+				return
+			}
+			p.ptrCache.Store(ip, &ptrCacheEntry{hostnames: res.Value, expiresAt: time.Now().Add(ptrCacheTTL).Unix()})
+		}()
+	}
+
+	if val, ok := p.ptrCache.Load(ip); ok {
+		return val.(*ptrCacheEntry).hostnames
+	}
+	return nil
+}
+
+func (p *Processor) GetAllowRules() []AllowRule {
+	return append([]AllowRule(nil), p.getConfig().AllowList.Rules...)
+}
+
+func (p *Processor) AddAllowRule(rule *AllowRule) error {
+	rule.ID = utils.GenerateUUID()
+	return p.updateConfig(func(config *ProcessorConfig) error {
+		config.AllowList.Rules = append(config.AllowList.Rules, *rule)
+		return nil
+	})
+}
+
+func (p *Processor) UpdateAllowRule(id string, rule AllowRule) error {
+	return p.updateConfig(func(config *ProcessorConfig) error {
+		for i := range config.AllowList.Rules {
+			if config.AllowList.Rules[i].ID == id {
+				rule.ID = id
+				config.AllowList.Rules[i] = rule
+				return nil
+			}
+		}
+		return fmt.Errorf("allow rule not found: %s", id)
+	})
+}
+
+func (p *Processor) DeleteAllowRule(id string) error {
+	return p.updateConfig(func(config *ProcessorConfig) error {
+		for i := range config.AllowList.Rules {
+			if config.AllowList.Rules[i].ID == id {
+				config.AllowList.Rules = append(config.AllowList.Rules[:i], config.AllowList.Rules[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("allow rule not found: %s", id)
+	})
+}
+
+func (p *Processor) GetScopedAllowLists() []ScopedAllowList {
+	return append([]ScopedAllowList(nil), p.getConfig().AllowList.Scoped...)
+}
+
+// AddScopedAllowRule adds rule to the ScopedAllowList for insideCIDR, creating that scope if it
+// doesn't exist yet.
+func (p *Processor) AddScopedAllowRule(insideCIDR string, rule *AllowRule) error {
+	rule.ID = utils.GenerateUUID()
+	return p.updateConfig(func(config *ProcessorConfig) error {
+		for i := range config.AllowList.Scoped {
+			if config.AllowList.Scoped[i].InsideCIDR == insideCIDR {
+				config.AllowList.Scoped[i].Rules = append(config.AllowList.Scoped[i].Rules, *rule)
+				return nil
+			}
+		}
+		config.AllowList.Scoped = append(config.AllowList.Scoped, ScopedAllowList{
+			InsideCIDR: insideCIDR,
+			Rules:      []AllowRule{*rule},
+		})
+		return nil
+	})
+}
+
+func (p *Processor) DeleteScopedAllowRule(insideCIDR, id string) error {
+	return p.updateConfig(func(config *ProcessorConfig) error {
+		for i := range config.AllowList.Scoped {
+			if config.AllowList.Scoped[i].InsideCIDR != insideCIDR {
+				continue
+			}
+			rules := config.AllowList.Scoped[i].Rules
+			for j := range rules {
+				if rules[j].ID == id {
+					config.AllowList.Scoped[i].Rules = append(rules[:j], rules[j+1:]...)
+					return nil
+				}
+			}
+			return fmt.Errorf("allow rule not found: %s", id)
+		}
+		return fmt.Errorf("scoped allow list not found: %s", insideCIDR)
+	})
+}
@@ -0,0 +1,77 @@
+package processor
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/danger-dream/ebpf-firewall/internal/threatintel/iptrie"
+)
+
+// blocklistIndex mirrors ProcessorConfig.Blocklist.Rules in an iptrie so IsBlocked can answer in
+// O(prefix-length) instead of the linear scan AddBlockRule/UpdateBlockRule/DeleteBlockRule use to
+// find a rule by ID. It only indexes rules that are enabled, not expired, and parse as an
+// IP/CIDR - a MAC-valued BlockRule has no address to index and is matched by the kernel's
+// MacList only. Rebuilt wholesale on every config change, the same way allowIndex is.
+type blocklistIndex struct {
+	trie     *iptrie.IPTrie
+	byPrefix map[netip.Prefix]*BlockRule
+}
+
+func buildBlocklistIndex(rules []BlockRule) *blocklistIndex {
+	idx := &blocklistIndex{
+		trie:     iptrie.NewIPTrie(),
+		byPrefix: make(map[netip.Prefix]*BlockRule),
+	}
+	now := time.Now().Unix()
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.Enabled || (rule.ExpireTime > 0 && rule.ExpireTime <= now) {
+			continue
+		}
+		prefix, ok := rule.Prefix()
+		if !ok {
+			continue
+		}
+		if err := idx.trie.InsertAddr(prefix); err != nil {
+			continue
+		}
+		idx.byPrefix[prefix] = rule
+	}
+	return idx
+}
+
+func (p *Processor) rebuildBlocklistIndex(config *ProcessorConfig) {
+	p.blockIdx.Store(buildBlocklistIndex(config.Blocklist.Rules))
+}
+
+func (p *Processor) getBlocklistIndex() *blocklistIndex {
+	idx, _ := p.blockIdx.Load().(*blocklistIndex)
+	return idx
+}
+
+// BlockExplainResult is the response shape for ExplainBlack, mirroring FeedMatch's role for the
+// threat-intel explain endpoint.
+type BlockExplainResult struct {
+	Blocked bool       `json:"blocked"`
+	Rule    *BlockRule `json:"rule"`
+}
+
+// IsBlocked reports whether ip falls under a currently-enabled BlockRule, and which one, using
+// longest-prefix-match the same way the kernel's CIDR tries do. Unlike GetBlockRules, this never
+// scans the full rule list.
+func (p *Processor) IsBlocked(ip string) (*BlockRule, bool) {
+	idx := p.getBlocklistIndex()
+	if idx == nil {
+		return nil, false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, false
+	}
+	prefix, found := idx.trie.LongestMatch(addr)
+	if !found {
+		return nil, false
+	}
+	rule, ok := idx.byPrefix[prefix]
+	return rule, ok
+}
@@ -1,34 +1,50 @@
 package processor
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"net/netip"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
+	"github.com/robfig/cron/v3"
+	"golang.org/x/exp/maps"
+
+	"github.com/danger-dream/ebpf-firewall/internal/firewall"
 	"github.com/danger-dream/ebpf-firewall/internal/threatintel"
+	"github.com/danger-dream/ebpf-firewall/pkg/promptclient"
 )
 
 const (
 	defaultCleanupInterval = time.Second * 15
 	defaultBlockDuration   = time.Hour * 24 * 7
 	defaultConfigFile      = "processor.json"
+	configWatchDebounce    = 200 * time.Millisecond
+	defaultPromptTimeout   = 30 * time.Second
 )
 
 type BlockSourceType uint8
 
 const (
-	BlockSourceTypeUser BlockSourceType = 1
+	BlockSourceTypeUser BlockSourceType = iota + 1
 	BlockSourceTypeIntel
 	BlockSourceTypeAnalyzer
+	BlockSourceTypePolicy
 )
 
 type MatchActionMode uint8
 
 const (
-	MatchActionModeMonitor MatchActionMode = 1
+	MatchActionModeMonitor MatchActionMode = iota + 1
 	MatchActionModeBlock
 	MatchActionModeThreshold
+	MatchActionModePrompt
 )
 
 type BlockRule struct {
@@ -40,6 +56,18 @@ type BlockRule struct {
 	Enabled    bool            `json:"enabled"`
 	ExpireTime int64           `json:"expire_time"` // Ignore when it's zero.
 	Extra      map[string]any  `json:"extra"`
+
+	// prefix is the parsed form of Value, cached alongside it so repeated lookups (the kernel
+	// sync path, the iptrie-backed matchers) don't reparse the same string. It is populated by
+	// validateProcessorConfig, which runs on every path that stores a BlockRule, and is left
+	// zero-value for rules whose Value is a MAC address rather than an IP/CIDR.
+	prefix netip.Prefix
+}
+
+// Prefix returns the parsed netip.Prefix form of Value. ok is false for rules whose Value isn't
+// an IP or CIDR (e.g. a MAC-address rule) or that haven't been validated yet.
+func (r *BlockRule) Prefix() (prefix netip.Prefix, ok bool) {
+	return r.prefix, r.prefix.IsValid()
 }
 
 type ProcessorConfig struct {
@@ -60,7 +88,195 @@ type ProcessorConfig struct {
 		// The duration for which the IP is blocked after it is matched.
 		BlockDuration time.Duration                       `json:"block_duration"`
 		Feeds         map[string]threatintel.FeedMetadata `json:"feeds"`
+
+		// KernelDrop mirrors the aggregated indicator set into a kernel BPF_MAP_TYPE_LPM_TRIE map
+		// so XDP drops matching packets itself, instead of only flagging them for the userspace
+		// match-mode handling below. Disabled by default: userspace-only detection has no kernel
+		// attack surface and is cheaper to reconfigure live.
+		KernelDrop bool `json:"kernel_drop"`
+
+		// Prompt configures MatchActionModePrompt: instead of deciding automatically, a match is
+		// sent to every client connected to SocketPath and the first reply decides the outcome.
+		// See prompt.go.
+		Prompt struct {
+			SocketPath string `json:"socket_path"`
+			// Timeout bounds how long handleThreatIntelMatch blocks waiting for a client to
+			// reply before falling back to DefaultAction.
+			Timeout time.Duration `json:"timeout"`
+			// DefaultAction is applied when no client is connected, or none replies within
+			// Timeout.
+			DefaultAction promptclient.Action `json:"default_action"`
+		} `json:"prompt"`
 	} `json:"threat_intel"`
+
+	// AllowList is consulted before any block decision. Rules is the global allow-list; Scoped
+	// lets an operator say "from 10.0.0.0/8, allow these externally, but from
+	// 192.168.0.0/16, allow those" by keying an additional AllowList off the packet's inside
+	// (destination) CIDR, mirroring Nebula's AllowList/RemoteAllowList split.
+	AllowList struct {
+		Rules  []AllowRule       `json:"rules"`
+		Scoped []ScopedAllowList `json:"scoped"`
+	} `json:"allow_list"`
+
+	// Policy rules are evaluated in order, before the threat-intel check, and the first one
+	// whose Expr matches the packet wins; see rules.go.
+	Policy struct {
+		Rules []PolicyRule `json:"rules"`
+	} `json:"policy"`
+
+	// Firewall rules are a port/proto/direction-aware alternative to AllowList: see
+	// firewall.go and internal/firewall's package doc for how they're compiled and matched.
+	Firewall struct {
+		Rules []firewall.Rule `json:"rules"`
+	} `json:"firewall"`
+}
+
+// ValidationError reports a single invalid field, identified by its JSON path, so callers can
+// surface a structured list instead of a single opaque error string.
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors collects every ValidationError found in one validation pass, so a config with
+// several problems can be fixed in one round-trip instead of one error at a time.
+type ValidationErrors struct {
+	Errors []ValidationError `json:"errors"`
+}
+
+func (e *ValidationErrors) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, ve := range e.Errors {
+		msgs[i] = fmt.Sprintf("%s: %s", ve.Field, ve.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// validateProcessorConfig enforces the same constraints described by ProcessorConfigSchema. It
+// is the runtime counterpart of that schema: the schema lets operators and tooling validate a
+// proposed config up front, this is what actually gates every load and update.
+func validateProcessorConfig(config *ProcessorConfig) error {
+	var errs []ValidationError
+	add := func(field, format string, args ...any) {
+		errs = append(errs, ValidationError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if config.CleanupInterval <= 0 {
+		add("cleanup_interval", "must be greater than zero")
+	}
+	if config.Blocklist.DefaultBlockDuration < 0 {
+		add("blocklist.default_block_duration", "must not be negative")
+	}
+	for i := range config.Blocklist.Rules {
+		rule := &config.Blocklist.Rules[i]
+		field := fmt.Sprintf("blocklist.rules[%d]", i)
+		if rule.Value == "" {
+			add(field+".value", "is required")
+		} else if prefix, err := parseAllowPrefix(rule.Value); err == nil {
+			// Rules may also hold a bare MAC address (see BlockRule.Value's doc comment), so a
+			// parse failure here isn't itself an error - it just leaves Prefix() unset.
+			rule.prefix = prefix
+		}
+		switch rule.Source {
+		case BlockSourceTypeUser, BlockSourceTypeIntel, BlockSourceTypeAnalyzer, BlockSourceTypePolicy:
+		default:
+			add(field+".source", "must be one of %d, %d, %d, %d", BlockSourceTypeUser, BlockSourceTypeIntel, BlockSourceTypeAnalyzer, BlockSourceTypePolicy)
+		}
+	}
+
+	switch config.ThreatIntel.MatchMode {
+	case MatchActionModeMonitor, MatchActionModeBlock, MatchActionModeThreshold, MatchActionModePrompt:
+	default:
+		add("threat_intel.match_mode", "must be one of %d, %d, %d, %d", MatchActionModeMonitor, MatchActionModeBlock, MatchActionModeThreshold, MatchActionModePrompt)
+	}
+	if config.ThreatIntel.MatchMode == MatchActionModeThreshold {
+		if config.ThreatIntel.MatchThreshold < 1 {
+			add("threat_intel.match_threshold", "must be at least 1 when match_mode is threshold")
+		}
+		if config.ThreatIntel.MatchWindow <= 0 {
+			add("threat_intel.match_window", "must be greater than zero when match_mode is threshold")
+		}
+	}
+	if config.ThreatIntel.MatchMode == MatchActionModePrompt {
+		if config.ThreatIntel.Prompt.SocketPath == "" {
+			add("threat_intel.prompt.socket_path", "is required when match_mode is prompt")
+		}
+		if config.ThreatIntel.Prompt.Timeout <= 0 {
+			add("threat_intel.prompt.timeout", "must be greater than zero when match_mode is prompt")
+		}
+		switch config.ThreatIntel.Prompt.DefaultAction {
+		case promptclient.ActionAllow, promptclient.ActionDeny:
+		default:
+			add("threat_intel.prompt.default_action", "must be one of %q, %q", promptclient.ActionAllow, promptclient.ActionDeny)
+		}
+	}
+	if config.ThreatIntel.BlockDuration < 0 {
+		add("threat_intel.block_duration", "must not be negative")
+	}
+	for name, feed := range config.ThreatIntel.Feeds {
+		if feed.Enabled && feed.Schedule != "" {
+			if _, err := cron.ParseStandard(feed.Schedule); err != nil {
+				add(fmt.Sprintf("threat_intel.feeds[%s].schedule", name), "invalid cron expression: %v", err)
+			}
+		}
+	}
+
+	for i, rule := range config.AllowList.Rules {
+		validateAllowRule(fmt.Sprintf("allow_list.rules[%d]", i), rule, add)
+	}
+	for i, scope := range config.AllowList.Scoped {
+		field := fmt.Sprintf("allow_list.scoped[%d]", i)
+		if _, err := netip.ParsePrefix(scope.InsideCIDR); err != nil {
+			add(field+".inside_cidr", "must be a valid CIDR: %v", err)
+		}
+		for j, rule := range scope.Rules {
+			validateAllowRule(fmt.Sprintf("%s.rules[%d]", field, j), rule, add)
+		}
+	}
+
+	for i := range config.Policy.Rules {
+		rule := &config.Policy.Rules[i]
+		field := fmt.Sprintf("policy.rules[%d]", i)
+		switch rule.Action {
+		case RuleActionAllow, RuleActionBlock, RuleActionLog, RuleActionThreshold, RuleActionNotify:
+		default:
+			add(field+".action", "must be one of %q, %q, %q, %q, %q", RuleActionAllow, RuleActionBlock, RuleActionLog, RuleActionThreshold, RuleActionNotify)
+		}
+		if rule.TTL < 0 {
+			add(field+".ttl", "must not be negative")
+		}
+		if rule.Expr == "" {
+			add(field+".expr", "is required")
+			continue
+		}
+		if err := compilePolicyRule(rule); err != nil {
+			add(field+".expr", "%v", err)
+		}
+	}
+
+	for i, rule := range config.Firewall.Rules {
+		field := fmt.Sprintf("firewall.rules[%d]", i)
+		firewall.Validate(rule, func(suffix, format string, args ...any) {
+			add(field+"."+suffix, format, args...)
+		})
+	}
+
+	if len(errs) > 0 {
+		return &ValidationErrors{Errors: errs}
+	}
+	return nil
+}
+
+// decodeProcessorConfig parses data as a ProcessorConfig, rejecting any field not present in the
+// struct so a typo or a stale key from an old release fails loudly instead of being ignored.
+func decodeProcessorConfig(data []byte) (*ProcessorConfig, error) {
+	config := &ProcessorConfig{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(config); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %v", err)
+	}
+	return config, nil
 }
 
 func (p *Processor) getDefaultConfig() *ProcessorConfig {
@@ -77,6 +293,15 @@ func (p *Processor) getDefaultConfig() *ProcessorConfig {
 	config.ThreatIntel.MatchWindow = time.Hour * 24
 	config.ThreatIntel.BlockDuration = time.Hour * 24 * 7
 	config.ThreatIntel.Feeds = p.threatAggregator.GenerateFeedsMetadata()
+	config.ThreatIntel.Prompt.Timeout = defaultPromptTimeout
+	config.ThreatIntel.Prompt.DefaultAction = promptclient.ActionDeny
+
+	config.AllowList.Rules = make([]AllowRule, 0)
+	config.AllowList.Scoped = make([]ScopedAllowList, 0)
+
+	config.Policy.Rules = make([]PolicyRule, 0)
+
+	config.Firewall.Rules = make([]firewall.Rule, 0)
 	return config
 }
 
@@ -84,12 +309,24 @@ func (p *Processor) getConfig() *ProcessorConfig {
 	return p.config.Load().(*ProcessorConfig)
 }
 
+// updateConfig applies updater to a copy of the current config, validates the result and, only
+// if it's valid, swaps it in. configMu serializes read-modify-store rounds so two concurrent
+// updates can't race and silently drop one of them.
 func (p *Processor) updateConfig(updater func(*ProcessorConfig) error) error {
+	p.configMu.Lock()
+	defer p.configMu.Unlock()
+
 	newConfig := *p.getConfig()
 	if err := updater(&newConfig); err != nil {
 		return err
 	}
+	if err := validateProcessorConfig(&newConfig); err != nil {
+		return err
+	}
 	p.config.Store(&newConfig)
+	p.rebuildAllowIndex(&newConfig)
+	p.rebuildBlocklistIndex(&newConfig)
+	p.rebuildFirewallIndex(&newConfig)
 	return nil
 }
 
@@ -99,6 +336,9 @@ func (p *Processor) loadConfig() error {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		config := p.getDefaultConfig()
 		p.config.Store(config)
+		p.rebuildAllowIndex(config)
+		p.rebuildBlocklistIndex(config)
+		p.rebuildFirewallIndex(config)
 		if err := p.saveConfig(); err != nil {
 			return err
 		}
@@ -110,20 +350,206 @@ func (p *Processor) loadConfig() error {
 		return err
 	}
 
-	config := &ProcessorConfig{}
-	if err := json.Unmarshal(data, config); err != nil {
+	config, err := decodeProcessorConfig(data)
+	if err != nil {
+		return err
+	}
+	if err := validateProcessorConfig(config); err != nil {
 		return err
 	}
 
 	p.config.Store(config)
+	p.rebuildAllowIndex(config)
+	p.rebuildBlocklistIndex(config)
+	p.rebuildFirewallIndex(config)
+	return nil
+}
+
+// ReloadConfig re-reads processor.json from disk, validates it, swaps it in and notifies registered
+// callbacks so dependent subsystems (e.g. threat-intel feeds) can reconcile instead of dropping
+// in-flight state. It does not compare the new config with the loaded one itself; each callback
+// diffs the part it cares about. Used by both the
+// fsnotify watcher and the POST /config/reload endpoint.
+func (p *Processor) ReloadConfig() error {
+	configPath := filepath.Join(p.dataDir, defaultConfigFile)
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	newConfig, err := decodeProcessorConfig(data)
+	if err != nil {
+		return err
+	}
+	if err := validateProcessorConfig(newConfig); err != nil {
+		return err
+	}
+
+	p.configMu.Lock()
+	oldConfig := p.getConfig()
+	p.config.Store(newConfig)
+	p.configMu.Unlock()
+
+	p.notifyConfigChange(oldConfig, newConfig)
 	return nil
 }
 
 func (p *Processor) saveConfig() error {
+	p.configMu.Lock()
+	defer p.configMu.Unlock()
+
 	data, err := json.MarshalIndent(*p.getConfig(), "", "\t")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(filepath.Join(p.dataDir, defaultConfigFile), data, 0644)
+	configPath := filepath.Join(p.dataDir, defaultConfigFile)
+	tmpPath := configPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, configPath)
+}
+
+// ConfigChangeCallback is invoked with the previous and newly loaded config whenever
+// processor.json is reloaded, either via the fsnotify watcher, SIGHUP or ReloadConfig.
+type ConfigChangeCallback func(old, new *ProcessorConfig)
+
+// namedReloadCallback pairs a ConfigChangeCallback with the key it was registered under (e.g.
+// "threatintel.feeds", "cleanup_interval"), so logs and diagnostics can identify which subsystem
+// reacted to a reload. Every callback still fires on every reload regardless of key - each one is
+// expected to diff the slice of ProcessorConfig it cares about itself, the same way
+// reconcileThreatIntelFeeds does.
+type namedReloadCallback struct {
+	key string
+	cb  ConfigChangeCallback
+}
+
+// RegisterReloadCallback subscribes cb, labelled key, to run with the previous and newly loaded
+// config after every successful reload. Safe to call concurrently with a reload; a callback
+// registered while a reload is dispatching first runs on the next one.
+func (p *Processor) RegisterReloadCallback(key string, cb ConfigChangeCallback) {
+	p.configCallbacksMu.Lock()
+	p.configCallbacks = append(p.configCallbacks, namedReloadCallback{key: key, cb: cb})
+	p.configCallbacksMu.Unlock()
+}
+
+// OnConfigChange is RegisterReloadCallback for a callback that doesn't correspond to one
+// particular config section.
+func (p *Processor) OnConfigChange(cb ConfigChangeCallback) {
+	p.RegisterReloadCallback("", cb)
+}
+
+func (p *Processor) notifyConfigChange(old, new *ProcessorConfig) {
+	p.configCallbacksMu.RLock()
+	callbacks := make([]namedReloadCallback, len(p.configCallbacks))
+	copy(callbacks, p.configCallbacks)
+	p.configCallbacksMu.RUnlock()
+
+	for _, nc := range callbacks {
+		nc.cb(old, new)
+	}
+}
+
+// reconcileThreatIntelFeeds is registered as a ConfigChangeCallback so an on-disk edit to
+// threat_intel.feeds (enabling/disabling a feed, changing its schedule or params) takes effect
+// through the same path as the /threatintel API, instead of only applying on restart.
+func (p *Processor) reconcileThreatIntelFeeds(old, new *ProcessorConfig) {
+	for name, info := range new.ThreatIntel.Feeds {
+		oldInfo, existed := old.ThreatIntel.Feeds[name]
+		if existed && oldInfo.Enabled == info.Enabled && oldInfo.Schedule == info.Schedule && maps.Equal(oldInfo.Params, info.Params) {
+			continue
+		}
+		infoCopy := info
+		if err := p.threatAggregator.UpdateFeedMetadata(name, &infoCopy); err != nil {
+			p.logger.WithField("feed", name).Errorf("failed to reconcile threat-intel feed on config reload: %v", err)
+		}
+	}
+}
+
+// reconcileKernelDrop toggles whether the aggregator's indicator set is mirrored into the
+// kernel's LPM_TRIE threat-intel maps. Turning it on registers ebpfManager.SyncThreatIntel as the
+// aggregator's OnAggregated callback, which also triggers an immediate sync of the current
+// indicator set; turning it off unregisters it, leaving whatever was last synced in the kernel
+// maps in place rather than trying to unwind it.
+func (p *Processor) reconcileKernelDrop(old, new *ProcessorConfig) {
+	if old.ThreatIntel.KernelDrop == new.ThreatIntel.KernelDrop {
+		return
+	}
+	if new.ThreatIntel.KernelDrop {
+		p.threatAggregator.SetOnAggregated(func(v4, v6 []netip.Prefix) {
+			if err := p.ebpfManager.SyncThreatIntel(v4, v6); err != nil {
+				p.logger.Errorf("failed to sync threat-intel indicators to kernel: %v", err)
+			}
+		})
+	} else {
+		p.threatAggregator.SetOnAggregated(nil)
+	}
+}
+
+// watchConfigFile starts an fsnotify watcher on the data directory and reloads processor.json
+// whenever it changes on disk, debounced so an editor's write-then-rename doesn't trigger two
+// reloads for one edit. It also reloads on SIGHUP, the conventional signal for "re-read your
+// config" on a long-running Unix process, for operators who'd rather signal the process than rely
+// on the watcher noticing the write.
+func (p *Processor) watchConfigFile() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create config watcher: %v", err)
+	}
+	if err := watcher.Add(p.dataDir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch data directory: %v", err)
+	}
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	configPath := filepath.Join(p.dataDir, defaultConfigFile)
+	go func() {
+		defer watcher.Close()
+		defer signal.Stop(sighup)
+
+		var debounce *time.Timer
+		reload := func() {
+			if err := p.ReloadConfig(); err != nil {
+				p.logger.Errorf("failed to reload config from disk: %v", err)
+			}
+		}
+		for {
+			select {
+			case <-p.done:
+				if debounce != nil {
+					debounce.Stop()
+				}
+				return
+			case <-sighup:
+				if debounce != nil {
+					debounce.Stop()
+				}
+				p.logger.Info("SIGHUP received, reloading config")
+				reload()
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != configPath {
+					continue
+				}
+				if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+					continue
+				}
+				if debounce != nil {
+					debounce.Stop()
+				}
+				debounce = time.AfterFunc(configWatchDebounce, reload)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				p.logger.Errorf("config watcher error: %v", err)
+			}
+		}
+	}()
+	return nil
 }
@@ -0,0 +1,127 @@
+package processor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestReloadProcessor builds a Processor with just enough state for ReloadConfig to work -
+// dataDir, an initial in-memory config and nothing else - so subsystem-level hot-reload behavior
+// can be exercised without constructing ebpfManager/threatAggregator/geoipDB dependencies.
+func newTestReloadProcessor(t *testing.T, initial *ProcessorConfig) *Processor {
+	t.Helper()
+	dir := t.TempDir()
+	p := &Processor{dataDir: dir}
+	p.config.Store(initial)
+	writeTestConfig(t, dir, initial)
+	return p
+}
+
+func writeTestConfig(t *testing.T, dir string, config *ProcessorConfig) {
+	t.Helper()
+	data, err := json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		t.Fatalf("marshal test config: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, defaultConfigFile), data, 0644); err != nil {
+		t.Fatalf("write test config: %v", err)
+	}
+}
+
+func minimalValidConfig() *ProcessorConfig {
+	config := &ProcessorConfig{CleanupInterval: time.Second}
+	config.ThreatIntel.MatchMode = MatchActionModeMonitor
+	return config
+}
+
+func TestReloadConfigDispatchesKeyedCallbacks(t *testing.T) {
+	config := minimalValidConfig()
+	p := newTestReloadProcessor(t, config)
+
+	var gotCleanup, gotFeeds bool
+	p.RegisterReloadCallback("cleanup_interval", func(old, newConfig *ProcessorConfig) {
+		if old.CleanupInterval != time.Second || newConfig.CleanupInterval != time.Minute {
+			t.Errorf("cleanup_interval callback saw old=%s new=%s, want 1s -> 1m", old.CleanupInterval, newConfig.CleanupInterval)
+		}
+		gotCleanup = true
+	})
+	p.RegisterReloadCallback("threatintel.feeds", func(old, newConfig *ProcessorConfig) {
+		gotFeeds = true
+	})
+
+	updated := minimalValidConfig()
+	updated.CleanupInterval = time.Minute
+	writeTestConfig(t, p.dataDir, updated)
+
+	if err := p.ReloadConfig(); err != nil {
+		t.Fatalf("ReloadConfig: %v", err)
+	}
+	if !gotCleanup {
+		t.Error("cleanup_interval callback was not invoked")
+	}
+	if !gotFeeds {
+		t.Error("threatintel.feeds callback was not invoked")
+	}
+	if p.getConfig().CleanupInterval != time.Minute {
+		t.Errorf("getConfig().CleanupInterval = %s, want 1m", p.getConfig().CleanupInterval)
+	}
+}
+
+// TestReloadConfigPreservesWindowStatesAcrossMatchModeChange asserts that switching
+// threat_intel.match_mode via an on-disk edit takes effect on the very next lookup without
+// dropping whatever threshold counters are already in windowStates - handleThreatIntelMatch reads
+// p.getConfig() fresh on every call, and windowStates is untouched by a reload.
+func TestReloadConfigPreservesWindowStatesAcrossMatchModeChange(t *testing.T) {
+	config := minimalValidConfig()
+	p := newTestReloadProcessor(t, config)
+	p.windowStates.Store("203.0.113.7", &WindowState{Count: 3, FirstTime: time.Now().Unix()})
+
+	updated := minimalValidConfig()
+	updated.ThreatIntel.MatchMode = MatchActionModeThreshold
+	updated.ThreatIntel.MatchThreshold = 5
+	updated.ThreatIntel.MatchWindow = time.Minute
+	writeTestConfig(t, p.dataDir, updated)
+
+	if err := p.ReloadConfig(); err != nil {
+		t.Fatalf("ReloadConfig: %v", err)
+	}
+	if p.getConfig().ThreatIntel.MatchMode != MatchActionModeThreshold {
+		t.Fatalf("MatchMode = %d, want threshold", p.getConfig().ThreatIntel.MatchMode)
+	}
+	val, ok := p.windowStates.Load("203.0.113.7")
+	if !ok {
+		t.Fatal("windowStates entry was dropped by the reload")
+	}
+	if val.(*WindowState).Count != 3 {
+		t.Fatalf("windowStates entry was mutated by the reload: %+v", val)
+	}
+}
+
+func TestReconcileCleanupIntervalResetsTicker(t *testing.T) {
+	p := &Processor{}
+	p.cleanupTicker = time.NewTicker(20 * time.Millisecond)
+	defer p.cleanupTicker.Stop()
+
+	old := &ProcessorConfig{CleanupInterval: 20 * time.Millisecond}
+	newConfig := &ProcessorConfig{CleanupInterval: time.Hour}
+	p.reconcileCleanupInterval(old, newConfig)
+
+	select {
+	case <-p.cleanupTicker.C:
+		t.Fatal("ticker fired at the old interval after being reset to a much longer one")
+	case <-time.After(100 * time.Millisecond):
+		// Expected: nothing fires within 100ms once reset to an hour.
+	}
+}
+
+func TestReconcileCleanupIntervalNoopWhenUnchanged(t *testing.T) {
+	p := &Processor{}
+	// cleanupTicker is nil here, as it would be before cleanupRoutine's goroutine has started;
+	// reconcileCleanupInterval must not panic on a nil ticker.
+	old := &ProcessorConfig{CleanupInterval: time.Second}
+	newConfig := &ProcessorConfig{CleanupInterval: time.Second}
+	p.reconcileCleanupInterval(old, newConfig)
+}
@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"fmt"
+
+	"github.com/danger-dream/ebpf-firewall/internal/firewall"
+	"github.com/danger-dream/ebpf-firewall/internal/utils"
+)
+
+// rebuildFirewallIndex recompiles ProcessorConfig.Firewall.Rules into a firewall.Firewall,
+// the same wholesale-rebuild-on-every-config-change discipline allowIndex and blocklistIndex
+// use. A rule with an invalid CIDR is logged and otherwise skipped by firewall.Compile, so one
+// bad rule can't take the rest of the firewall rule set down with it.
+func (p *Processor) rebuildFirewallIndex(config *ProcessorConfig) {
+	fw, err := firewall.Compile(config.Firewall.Rules)
+	if err != nil {
+		p.logger.Errorf("firewall rule set: %v", err)
+	}
+	p.fwIdx.Store(fw)
+}
+
+func (p *Processor) getFirewall() *firewall.Firewall {
+	fw, _ := p.fwIdx.Load().(*firewall.Firewall)
+	return fw
+}
+
+// CheckFirewall reports whether pkt matches a currently-enabled firewall rule, and which one, the
+// same "explain the match" shape IsBlocked and IsAllowed use.
+func (p *Processor) CheckFirewall(pkt firewall.Packet) (bool, *firewall.Rule) {
+	return p.getFirewall().Allow(pkt)
+}
+
+// GetFirewallRules returns every configured firewall rule, in evaluation order.
+func (p *Processor) GetFirewallRules() []firewall.Rule {
+	return append([]firewall.Rule(nil), p.getConfig().Firewall.Rules...)
+}
+
+// AddFirewallRule appends a new firewall rule.
+func (p *Processor) AddFirewallRule(rule *firewall.Rule) error {
+	rule.ID = utils.GenerateUUID()
+	return p.updateConfig(func(config *ProcessorConfig) error {
+		config.Firewall.Rules = append(config.Firewall.Rules, *rule)
+		return nil
+	})
+}
+
+// UpdateFirewallRule replaces the rule identified by id.
+func (p *Processor) UpdateFirewallRule(id string, rule firewall.Rule) error {
+	return p.updateConfig(func(config *ProcessorConfig) error {
+		for i := range config.Firewall.Rules {
+			if config.Firewall.Rules[i].ID == id {
+				rule.ID = id
+				config.Firewall.Rules[i] = rule
+				return nil
+			}
+		}
+		return fmt.Errorf("firewall rule not found: %s", id)
+	})
+}
+
+// DeleteFirewallRule removes the rule identified by id.
+func (p *Processor) DeleteFirewallRule(id string) error {
+	return p.updateConfig(func(config *ProcessorConfig) error {
+		for i := range config.Firewall.Rules {
+			if config.Firewall.Rules[i].ID == id {
+				config.Firewall.Rules = append(config.Firewall.Rules[:i], config.Firewall.Rules[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("firewall rule not found: %s", id)
+	})
+}
@@ -1,18 +1,25 @@
 package processor
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"io"
 	"net"
+	"net/netip"
 	"os"
 	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/sirupsen/logrus"
+
 	"github.com/danger-dream/ebpf-firewall/internal/config"
 	"github.com/danger-dream/ebpf-firewall/internal/ebpf"
+	"github.com/danger-dream/ebpf-firewall/internal/events"
+	"github.com/danger-dream/ebpf-firewall/internal/firewall"
 	"github.com/danger-dream/ebpf-firewall/internal/metrics"
+	"github.com/danger-dream/ebpf-firewall/internal/notify"
 	"github.com/danger-dream/ebpf-firewall/internal/threatintel"
 	"github.com/danger-dream/ebpf-firewall/internal/types"
 	"github.com/danger-dream/ebpf-firewall/internal/utils"
@@ -30,28 +37,47 @@ type WindowState struct {
 }
 
 type Processor struct {
-	dataDir          string
-	pool             *utils.ElasticPool[*types.PacketInfo]
-	ebpfManager      *ebpf.EBPFManager
-	collector        *metrics.MetricsCollector
-	threatAggregator *threatintel.Aggregator
-	geoipDB          *geoip2.Reader
-	config           atomic.Value
-	windowStates     sync.Map
-	done             chan struct{}
+	dataDir           string
+	pool              *utils.ElasticPool[*types.PacketInfo]
+	ebpfManager       *ebpf.EBPFManager
+	collector         *metrics.MetricsCollector
+	threatAggregator  *threatintel.Aggregator
+	geoipDB           *geoip2.Reader
+	config            atomic.Value
+	configMu          sync.Mutex
+	configCallbacks   []namedReloadCallback
+	configCallbacksMu sync.RWMutex
+	allowIdx          atomic.Value
+	blockIdx          atomic.Value
+	fwIdx             atomic.Value
+	ptrCache          sync.Map
+	ptrInFlight       sync.Map
+	ptrPool           *utils.FuturePool[string, []string]
+	windowStates      sync.Map
+	done              chan struct{}
+	notifier          *notify.Notifier
+	bus               *events.EventBus
+	promptMu          sync.Mutex
+	promptSrv         *promptServer
+	promptCache       sync.Map
+	cleanupMu         sync.Mutex
+	cleanupTicker     *time.Ticker
+	logger            logrus.FieldLogger
 }
 
-func NewProcessor(pool *utils.ElasticPool[*types.PacketInfo], ebpfManager *ebpf.EBPFManager, collector *metrics.MetricsCollector) (*Processor, error) {
+func NewProcessor(pool *utils.ElasticPool[*types.PacketInfo], ebpfManager *ebpf.EBPFManager, collector *metrics.MetricsCollector, notifier *notify.Notifier, bus *events.EventBus, logger logrus.FieldLogger) (*Processor, error) {
+	logger = logger.WithField("component", "processor")
 	systemConfig := config.GetConfig()
 	dir := systemConfig.DataDir
-	geoipDB := loadGeoip(filepath.Join(dir, systemConfig.GeoIPPath))
+	geoipDB := loadGeoip(filepath.Join(dir, systemConfig.GeoIPPath), logger)
 
 	// Initialize threat intelligence aggregator first to ensure default metadata is available
 	// This allows the system to function properly even without explicit configuration
-	threatAggregator, err := threatintel.NewAggregator(dir)
+	threatAggregator, err := threatintel.NewAggregator(dir, logger)
 	if err != nil {
 		return nil, err
 	}
+	threatAggregator.SetEventBus(bus)
 	p := &Processor{
 		dataDir:          dir,
 		pool:             pool,
@@ -61,7 +87,13 @@ func NewProcessor(pool *utils.ElasticPool[*types.PacketInfo], ebpfManager *ebpf.
 		geoipDB:          geoipDB,
 		windowStates:     sync.Map{},
 		done:             make(chan struct{}),
+		notifier:         notifier,
+		bus:              bus,
+		logger:           logger,
 	}
+	p.ptrPool = utils.NewFuturePool(ptrResolverWorkers, func(_ context.Context, ip string) ([]string, error) {
+		return net.LookupAddr(ip)
+	}, logger)
 	if err := p.loadConfig(); err != nil {
 		return nil, err
 	}
@@ -69,32 +101,45 @@ func NewProcessor(pool *utils.ElasticPool[*types.PacketInfo], ebpfManager *ebpf.
 	if err := p.threatAggregator.Initialize(p.getConfig().ThreatIntel.Feeds); err != nil {
 		return nil, err
 	}
+	p.RegisterReloadCallback("threatintel.feeds", p.reconcileThreatIntelFeeds)
+	p.RegisterReloadCallback("allow_list", func(_, newConfig *ProcessorConfig) { p.rebuildAllowIndex(newConfig) })
+	p.RegisterReloadCallback("blocklist.rules", func(_, newConfig *ProcessorConfig) { p.rebuildBlocklistIndex(newConfig) })
+	p.RegisterReloadCallback("firewall.rules", func(_, newConfig *ProcessorConfig) { p.rebuildFirewallIndex(newConfig) })
+	p.RegisterReloadCallback("threat_intel.prompt", p.reconcilePromptServer)
+	p.RegisterReloadCallback("threat_intel.kernel_drop", p.reconcileKernelDrop)
+	p.RegisterReloadCallback("cleanup_interval", p.reconcileCleanupInterval)
+	p.reconcilePromptServer(&ProcessorConfig{}, p.getConfig())
+	p.reconcileKernelDrop(&ProcessorConfig{}, p.getConfig())
+	p.ebpfManager.SetRestartHooks(p)
+	if err := p.watchConfigFile(); err != nil {
+		p.logger.Warnf("config hot-reload disabled: %v", err)
+	}
 	p.pool.SetProcessor(p.processPackets)
 	go p.cleanupRoutine()
 	return p, nil
 }
 
-func loadGeoip(path string) *geoip2.Reader {
+func loadGeoip(path string, logger logrus.FieldLogger) *geoip2.Reader {
 	var geoipDB *geoip2.Reader
 	if path != "" {
 		if _, err := os.Stat(path); os.IsNotExist(err) {
 			// download the latest GeoIP database
 			if err := utils.DownloadGeoIPTarGZ(GeoIPURL, path); err != nil {
-				log.Printf("failed to download GeoIP database: %v", err)
+				logger.Errorf("failed to download GeoIP database: %v", err)
 			}
 		}
 		if _, err := os.Stat(path); err == nil {
 			// init GeoIP database
 			geoipDB, err = geoip2.Open(path)
 			if err != nil {
-				log.Fatalf("failed to open GeoIP database: %v", err)
+				logger.Fatalf("failed to open GeoIP database: %v", err)
 			} else {
-				log.Printf("GeoIP database loaded: %s", path)
+				logger.WithField("path", path).Info("GeoIP database loaded")
 				return geoipDB
 			}
 		}
 	} else {
-		log.Println("GeoIP database path is not set, skip loading GeoIP database")
+		logger.Info("GeoIP database path is not set, skip loading GeoIP database")
 	}
 	return nil
 }
@@ -103,6 +148,10 @@ func (p *Processor) Close() error {
 	close(p.done)
 	p.saveConfig()
 	p.threatAggregator.Close()
+	p.ptrPool.Close()
+	if srv := p.getPromptServer(); srv != nil {
+		srv.Close()
+	}
 	if p.geoipDB != nil {
 		p.geoipDB.Close()
 	}
@@ -115,18 +164,64 @@ func (p *Processor) processPackets(pi *types.PacketInfo) {
 
 	if packet.MatchType != types.NoMatch {
 		// drop the packet if it's not a normal packet
+		p.collector.RecordVerdict(metrics.VerdictDrop)
 		return
 	}
 
 	if packet.SrcIP != "" {
 		srcIP := packet.SrcIP
 		config := p.getConfig()
+
+		// The allow-list is consulted before any block decision so an operator-approved
+		// exception (e.g. a corporate egress IP that shows up on a threat-intel feed) always
+		// wins, without having to disable the whole feed.
+		verdict := p.IsAllowed(srcIP, packet.DstIP, "")
+		packet.AllowReason = verdict.Reason
+		if verdict.Allowed {
+			p.collector.RecordVerdict(metrics.VerdictAllow)
+			return
+		}
+
+		// The firewall ACL is consulted the same way as the allow-list: XDP only ever sees
+		// ingress traffic, so every packet here is inbound, and a Rule that matches is always an
+		// explicit allow (firewall.Firewall.Allow has no deny action of its own - see
+		// internal/firewall/firewall.go). A packet that matches nothing falls through to policy
+		// rules and threat-intel exactly as it did before the firewall layer existed.
+		if addr, err := netip.ParseAddr(srcIP); err == nil {
+			if allowed, rule := p.CheckFirewall(firewall.Packet{
+				RemoteAddr: addr,
+				Port:       packet.SrcPort,
+				Proto:      packet.IPProto,
+				Direction:  firewall.DirectionInbound,
+				Interface:  packet.Interface,
+			}); allowed {
+				packet.AllowReason = "firewall:" + rule.ID
+				p.collector.RecordVerdict(metrics.VerdictAllow)
+				return
+			}
+		}
+
+		// Populated before policy rules run so an Expr can reference threat_category (e.g.
+		// `threat_category == "tor-exit"`) without waiting for the Contains check below.
+		packet.ThreatCategory = p.threatAggregator.Category(srcIP)
+		if p.evaluatePolicyRules(packet) {
+			if packet.AllowReason != "" {
+				p.collector.RecordVerdict(metrics.VerdictAllow)
+			} else {
+				p.collector.RecordVerdict(metrics.VerdictDrop)
+			}
+			return
+		}
+
 		isLocalAndIgnored := config.ThreatIntel.IgnoreLocalNetwork && utils.IsLocalIP(srcIP)
 		if !isLocalAndIgnored && p.threatAggregator.Contains(srcIP) {
-			p.handleThreatIntelMatch(srcIP)
+			p.handleThreatIntelMatch(packet)
+			p.collector.RecordVerdict(metrics.VerdictDrop)
 			return
 		}
 	}
+
+	p.collector.RecordVerdict(metrics.VerdictAllow)
 }
 
 func (p *Processor) createPacket(pi *types.PacketInfo) *types.Packet {
@@ -150,6 +245,7 @@ func (p *Processor) createPacket(pi *types.PacketInfo) *types.Packet {
 		EthType:   pi.EthProto,
 		IPProto:   pi.IPProto,
 		MatchType: pi.MatchType,
+		Interface: pi.Interface,
 	}
 
 	if packet.SrcIP != "" && p.geoipDB != nil {
@@ -175,8 +271,37 @@ func (p *Processor) createPacket(pi *types.PacketInfo) *types.Packet {
 	return packet
 }
 
-func (p *Processor) handleThreatIntelMatch(srcIP string) {
+func (p *Processor) handleThreatIntelMatch(packet *types.Packet) {
+	srcIP := packet.SrcIP
+	if p.notifier != nil {
+		p.notifier.Publish(notify.Event{
+			Type:      "threat_intel",
+			Timestamp: time.Now().Unix(),
+			IP:        srcIP,
+			Message:   "source IP matched threat intelligence feed",
+		})
+	}
+	// Read fresh rather than cached, so a MatchMode/MatchWindow change picked up by a config
+	// reload applies to the very next matched packet - windowStates itself is untouched by a
+	// reload, so in-flight threshold counters survive the switch.
 	config := p.getConfig()
+
+	if config.ThreatIntel.MatchMode == MatchActionModePrompt {
+		if !p.resolvePrompt(packet, packet.ThreatCategory) {
+			return
+		}
+		if err := p.AddBlockRule(&BlockRule{
+			Value:      srcIP,
+			Note:       "Matched threat intelligence (denied via prompt)",
+			Source:     BlockSourceTypeIntel,
+			CreateTime: time.Now().Unix(),
+			Enabled:    true,
+		}); err != nil {
+			p.logger.WithField("src_ip", srcIP).Errorf("failed to add block rule: %v", err)
+		}
+		return
+	}
+
 	enable := config.ThreatIntel.MatchMode == MatchActionModeBlock
 	if config.ThreatIntel.MatchMode == MatchActionModeThreshold {
 		now := time.Now().Unix()
@@ -221,7 +346,7 @@ func (p *Processor) handleThreatIntelMatch(srcIP string) {
 		Enabled:    enable,
 		ExpireTime: expireTime,
 	}); err != nil {
-		log.Printf("Failed to add block rule for IP %s: %v", srcIP, err)
+		p.logger.WithField("src_ip", srcIP).Errorf("failed to add block rule: %v", err)
 	}
 }
 
@@ -241,6 +366,30 @@ func (p *Processor) updateBlockRuleToKernel(rule *BlockRule) error {
 	return nil
 }
 
+// OnInterfaceRestart implements ebpf.RestartHooks. attachInterface loads a brand-new, empty set
+// of kernel maps on every reattach, so this replays the state that normally lives only in those
+// maps - enabled, non-expired blocklist rules and, when kernel-level threat-intel drop is on, the
+// current indicator set - back into iface alone, leaving every other attached interface untouched.
+func (p *Processor) OnInterfaceRestart(iface string) error {
+	now := time.Now().Unix()
+	for _, rule := range p.getConfig().Blocklist.Rules {
+		if !rule.Enabled || (rule.ExpireTime > 0 && rule.ExpireTime <= now) {
+			continue
+		}
+		if err := p.ebpfManager.AddRuleOnInterface(iface, rule.Value); err != nil {
+			p.logger.WithField("interface", iface).WithField("rule_id", rule.ID).Errorf("failed to replay blocklist rule after restart: %v", err)
+		}
+	}
+
+	if p.getConfig().ThreatIntel.KernelDrop {
+		v4, v6 := p.threatAggregator.Indicators()
+		if err := p.ebpfManager.SyncThreatIntelToInterface(iface, v4, v6); err != nil {
+			return fmt.Errorf("replay threat-intel after restart: %w", err)
+		}
+	}
+	return nil
+}
+
 func (p *Processor) cleanupWindowStates() {
 	now := time.Now().Unix()
 	window := p.getConfig().ThreatIntel.MatchWindow
@@ -264,11 +413,13 @@ func (p *Processor) cleanupBlockRules() {
 			if rule.ExpireTime > 0 && rule.ExpireTime <= now {
 				if rule.Enabled {
 					if err := p.ebpfManager.DeleteRule(rule.Value); err != nil {
-						log.Printf("Failed to remove expired rule from kernel: %v", err)
+						p.logger.WithField("rule_id", rule.ID).Errorf("failed to remove expired rule from kernel: %v", err)
 						continue
 					}
 				}
+				expired := *rule
 				rules = append(rules[:i], rules[i+1:]...)
+				p.publishBlacklistEvent("expire", &expired)
 			}
 		}
 		config.Blocklist.Rules = rules
@@ -279,6 +430,9 @@ func (p *Processor) cleanupBlockRules() {
 func (p *Processor) cleanupRoutine() {
 	ticker := time.NewTicker(p.getConfig().CleanupInterval)
 	defer ticker.Stop()
+	p.cleanupMu.Lock()
+	p.cleanupTicker = ticker
+	p.cleanupMu.Unlock()
 	for {
 		select {
 		case <-p.done:
@@ -290,7 +444,31 @@ func (p *Processor) cleanupRoutine() {
 	}
 }
 
-func (p *Processor) GetBlockRules(page, pageSize int) ([]BlockRule, int, error) {
+// reconcileCleanupInterval is registered as a ConfigChangeCallback so editing cleanup_interval on
+// disk takes effect immediately instead of only after a restart - cleanupRoutine otherwise never
+// looks at CleanupInterval again once its ticker is created.
+func (p *Processor) reconcileCleanupInterval(old, newConfig *ProcessorConfig) {
+	if old.CleanupInterval == newConfig.CleanupInterval || newConfig.CleanupInterval <= 0 {
+		return
+	}
+	p.cleanupMu.Lock()
+	ticker := p.cleanupTicker
+	p.cleanupMu.Unlock()
+	if ticker != nil {
+		ticker.Reset(newConfig.CleanupInterval)
+	}
+}
+
+// BlockRulePage is a page of BlockRules, mirroring metrics.SourcePage's Total/Items shape.
+type BlockRulePage struct {
+	Total int         `json:"total"`
+	Items []BlockRule `json:"items"`
+}
+
+// GetBlockRules returns a page of block rules, optionally narrowed to a single source (e.g. only
+// operator-added rules vs. ones an aggregated threat-intel feed pushed in) - pass 0 for source to
+// return every rule regardless of where it came from.
+func (p *Processor) GetBlockRules(page, pageSize int, source BlockSourceType) ([]BlockRule, int, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -298,7 +476,18 @@ func (p *Processor) GetBlockRules(page, pageSize int) ([]BlockRule, int, error)
 		pageSize = 20
 	}
 	config := p.getConfig()
-	total := len(config.Blocklist.Rules)
+	rules := config.Blocklist.Rules
+	if source != 0 {
+		filtered := make([]BlockRule, 0, len(rules))
+		for _, rule := range rules {
+			if rule.Source == source {
+				filtered = append(filtered, rule)
+			}
+		}
+		rules = filtered
+	}
+
+	total := len(rules)
 	start := (page - 1) * pageSize
 	if start >= total {
 		return []BlockRule{}, total, nil
@@ -309,7 +498,7 @@ func (p *Processor) GetBlockRules(page, pageSize int) ([]BlockRule, int, error)
 		end = total
 	}
 
-	return config.Blocklist.Rules[start:end], total, nil
+	return rules[start:end], total, nil
 }
 
 func (p *Processor) AddBlockRule(rule *BlockRule) error {
@@ -324,11 +513,12 @@ func (p *Processor) AddBlockRule(rule *BlockRule) error {
 		return err
 	}
 
+	p.publishBlacklistEvent("add", rule)
 	return nil
 }
 
 func (p *Processor) UpdateBlockRule(id string, rule BlockRule) error {
-	return p.updateConfig(func(config *ProcessorConfig) error {
+	if err := p.updateConfig(func(config *ProcessorConfig) error {
 		for i := range config.Blocklist.Rules {
 			if config.Blocklist.Rules[i].ID == id {
 				oldEnabled := config.Blocklist.Rules[i].Enabled
@@ -348,21 +538,55 @@ func (p *Processor) UpdateBlockRule(id string, rule BlockRule) error {
 			}
 		}
 		return fmt.Errorf("rule not found: %s", id)
-	})
+	}); err != nil {
+		return err
+	}
+
+	p.publishBlacklistEvent("update", &rule)
+	return nil
 }
 
 func (p *Processor) DeleteBlockRule(id string) error {
-	return p.updateConfig(func(config *ProcessorConfig) error {
+	var deleted BlockRule
+	if err := p.updateConfig(func(config *ProcessorConfig) error {
 		for i := range config.Blocklist.Rules {
 			if config.Blocklist.Rules[i].ID == id {
+				deleted = config.Blocklist.Rules[i]
 				config.Blocklist.Rules = append(config.Blocklist.Rules[:i], config.Blocklist.Rules[i+1:]...)
 				return nil
 			}
 		}
 		return fmt.Errorf("rule not found: %s", id)
+	}); err != nil {
+		return err
+	}
+
+	p.publishBlacklistEvent("delete", &deleted)
+	return nil
+}
+
+// publishBlacklistEvent surfaces a block-rule mutation on events.TopicBlacklist, e.g. so a live
+// dashboard can reflect an add/update/delete/expire without polling GetBlockRules.
+func (p *Processor) publishBlacklistEvent(action string, rule *BlockRule) {
+	if p.bus == nil {
+		return
+	}
+	p.bus.Publish(events.TopicBlacklist, time.Now().Unix(), map[string]any{
+		"action": action,
+		"rule":   rule,
 	})
 }
 
 func (p *Processor) GetThreatIntelAggregator() *threatintel.Aggregator {
 	return p.threatAggregator
 }
+
+// WritePrometheus renders the packet pool's and the PTR resolver pool's task/queue/panic metrics
+// in Prometheus text exposition format, so both reach /metrics alongside
+// metrics.MetricsCollector, middleware.Security and ebpf.EBPFManager.
+func (p *Processor) WritePrometheus(w io.Writer) error {
+	if err := p.pool.WritePrometheus(w, "ebpf_firewall_packet_pool"); err != nil {
+		return err
+	}
+	return p.ptrPool.WritePrometheus(w, "ebpf_firewall_ptr_pool")
+}
@@ -0,0 +1,289 @@
+package processor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/danger-dream/ebpf-firewall/internal/types"
+	"github.com/danger-dream/ebpf-firewall/internal/utils"
+	"github.com/danger-dream/ebpf-firewall/pkg/promptclient"
+)
+
+// promptConn is one connected prompt client - a GUI or CLI wrapper built against
+// pkg/promptclient. Writes are serialized per-connection since json.Encoder isn't safe for
+// concurrent use.
+type promptConn struct {
+	conn net.Conn
+	enc  *json.Encoder
+	mu   sync.Mutex
+}
+
+func (c *promptConn) send(req promptclient.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.enc.Encode(req)
+}
+
+// promptServer listens on a Unix socket and brokers promptclient.Request/Response pairs between
+// resolvePrompt (the producer, one per monitored packet) and however many clients are currently
+// connected (the consumers). A Request is broadcast to every connected client; the first Response
+// for its ID wins and any later ones are dropped.
+type promptServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	conns    map[*promptConn]struct{}
+	pending  sync.Map // request ID (string) -> chan promptclient.Response
+	done     chan struct{}
+	logger   logrus.FieldLogger
+}
+
+// startPromptServer removes any stale socket file left behind by a previous run, listens on
+// socketPath and starts accepting connections in the background.
+func startPromptServer(socketPath string, logger logrus.FieldLogger) (*promptServer, error) {
+	if dir := filepath.Dir(socketPath); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("prompt socket: %v", err)
+		}
+	}
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("prompt socket: %v", err)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("prompt socket: %v", err)
+	}
+	s := &promptServer{
+		listener: listener,
+		conns:    make(map[*promptConn]struct{}),
+		done:     make(chan struct{}),
+		logger:   logger,
+	}
+	go s.acceptLoop()
+	return s, nil
+}
+
+func (s *promptServer) acceptLoop() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return
+			default:
+				s.logger.Errorf("prompt socket accept error: %v", err)
+				return
+			}
+		}
+		pc := &promptConn{conn: conn, enc: json.NewEncoder(conn)}
+		s.mu.Lock()
+		s.conns[pc] = struct{}{}
+		s.mu.Unlock()
+		go s.readLoop(pc)
+	}
+}
+
+func (s *promptServer) readLoop(pc *promptConn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, pc)
+		s.mu.Unlock()
+		pc.conn.Close()
+	}()
+	dec := json.NewDecoder(bufio.NewReader(pc.conn))
+	for {
+		var resp promptclient.Response
+		if err := dec.Decode(&resp); err != nil {
+			return
+		}
+		if val, ok := s.pending.Load(resp.ID); ok {
+			select {
+			case val.(chan promptclient.Response) <- resp:
+			default:
+				// Another client already answered this request; the late response is dropped.
+			}
+		}
+	}
+}
+
+// ask broadcasts req to every connected client and waits up to timeout for the first reply,
+// reporting an error if no client is connected or none replies in time - either way the caller
+// falls back to its configured default action.
+func (s *promptServer) ask(req promptclient.Request, timeout time.Duration) (promptclient.Response, error) {
+	s.mu.Lock()
+	conns := make([]*promptConn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	if len(conns) == 0 {
+		return promptclient.Response{}, fmt.Errorf("no prompt clients connected")
+	}
+
+	ch := make(chan promptclient.Response, 1)
+	s.pending.Store(req.ID, ch)
+	defer s.pending.Delete(req.ID)
+
+	for _, c := range conns {
+		if err := c.send(req); err != nil {
+			s.logger.WithField("request_id", req.ID).Warnf("failed to notify a client: %v", err)
+		}
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-time.After(timeout):
+		return promptclient.Response{}, fmt.Errorf("prompt request %s timed out after %s", req.ID, timeout)
+	}
+}
+
+func (s *promptServer) Close() error {
+	close(s.done)
+	return s.listener.Close()
+}
+
+// promptCacheKey identifies a cached prompt decision. Scope is part of the key rather than an
+// attribute of the cached value, since a "session" decision for a (src_ip, dst_port, proto)
+// tuple shouldn't be returned for - or overwritten by - a later "permanent" prompt for the same
+// tuple: each scope tracks its own cache independently.
+type promptCacheKey struct {
+	scope   promptclient.Scope
+	srcIP   string
+	dstPort uint16
+	proto   uint16
+}
+
+type promptDecision struct {
+	action    promptclient.Action
+	expiresAt int64 // zero means never expires
+}
+
+func (d *promptDecision) expired(now int64) bool {
+	return d.expiresAt > 0 && d.expiresAt <= now
+}
+
+// reconcilePromptServer (re)starts the prompt socket listener when threat_intel.prompt.socket_path
+// changes and stops it when cleared, so hot-reloading into or out of prompt mode takes effect
+// without a process restart. It doubles as the initial-startup path: NewProcessor calls it with a
+// zero-value old config, so a non-empty socket_path in the loaded config starts the listener.
+func (p *Processor) reconcilePromptServer(old, newConfig *ProcessorConfig) {
+	if old.ThreatIntel.Prompt.SocketPath == newConfig.ThreatIntel.Prompt.SocketPath {
+		return
+	}
+	p.promptMu.Lock()
+	defer p.promptMu.Unlock()
+	if p.promptSrv != nil {
+		if err := p.promptSrv.Close(); err != nil {
+			p.logger.Errorf("failed to close prompt socket: %v", err)
+		}
+		p.promptSrv = nil
+	}
+	if newConfig.ThreatIntel.Prompt.SocketPath == "" {
+		return
+	}
+	srv, err := startPromptServer(newConfig.ThreatIntel.Prompt.SocketPath, p.logger)
+	if err != nil {
+		p.logger.Errorf("failed to start prompt socket: %v", err)
+		return
+	}
+	p.promptSrv = srv
+}
+
+func (p *Processor) getPromptServer() *promptServer {
+	p.promptMu.Lock()
+	defer p.promptMu.Unlock()
+	return p.promptSrv
+}
+
+// resolvePrompt is handleThreatIntelMatch's branch for MatchActionModePrompt. It first checks the
+// in-memory decision cache, then - if nothing cached or it expired - asks a connected prompt
+// client and caches the answer per the response's Scope so repeat hits from the same
+// (src_ip, dst_port, proto) tuple don't re-prompt. It reports whether the source should be
+// denied; on timeout or with no client connected it falls back to threat_intel.prompt.default_action.
+func (p *Processor) resolvePrompt(packet *types.Packet, feed string) bool {
+	cfg := p.getConfig().ThreatIntel.Prompt
+	now := time.Now().Unix()
+	proto := uint16(packet.IPProto)
+
+	for _, scope := range [...]promptclient.Scope{promptclient.ScopePermanent, promptclient.ScopeSession} {
+		key := promptCacheKey{scope: scope, srcIP: packet.SrcIP, dstPort: packet.DstPort, proto: proto}
+		if val, ok := p.promptCache.Load(key); ok {
+			decision := val.(*promptDecision)
+			if !decision.expired(now) {
+				return decision.action == promptclient.ActionDeny
+			}
+			p.promptCache.Delete(key)
+		}
+	}
+
+	srv := p.getPromptServer()
+	if srv == nil {
+		return cfg.DefaultAction == promptclient.ActionDeny
+	}
+
+	req := promptclient.Request{
+		ID:        utils.GenerateUUID(),
+		Timestamp: now,
+		SrcIP:     packet.SrcIP,
+		DstIP:     packet.DstIP,
+		SrcPort:   packet.SrcPort,
+		DstPort:   packet.DstPort,
+		Proto:     proto,
+		Country:   packet.Country,
+		City:      packet.City,
+		Feed:      feed,
+	}
+	resp, err := srv.ask(req, cfg.Timeout)
+	if err != nil {
+		p.logger.WithField("src_ip", packet.SrcIP).Warnf("prompt fell back to the default action: %v", err)
+		return cfg.DefaultAction == promptclient.ActionDeny
+	}
+
+	if resp.Scope != promptclient.ScopeOnce {
+		key := promptCacheKey{scope: resp.Scope, srcIP: packet.SrcIP, dstPort: packet.DstPort, proto: proto}
+		decision := &promptDecision{action: resp.Action}
+		if resp.Scope == promptclient.ScopeSession && resp.TTL > 0 {
+			decision.expiresAt = now + resp.TTL
+		}
+		p.promptCache.Store(key, decision)
+	}
+	if resp.Scope == promptclient.ScopePermanent {
+		p.promotePromptDecision(packet.SrcIP, resp, feed)
+	}
+	return resp.Action == promptclient.ActionDeny
+}
+
+// promotePromptDecision persists a "permanent" prompt response as a BlockRule or AllowRule, via
+// the same paths the API uses, so the decision survives a restart instead of only living in
+// promptCache.
+func (p *Processor) promotePromptDecision(srcIP string, resp promptclient.Response, feed string) {
+	note := fmt.Sprintf("promoted from a permanent prompt decision (feed: %s)", feed)
+	if resp.Action == promptclient.ActionDeny {
+		if err := p.AddBlockRule(&BlockRule{
+			Value:      srcIP,
+			Note:       note,
+			Source:     BlockSourceTypeUser,
+			CreateTime: time.Now().Unix(),
+			Enabled:    true,
+		}); err != nil {
+			p.logger.WithField("src_ip", srcIP).Errorf("failed to promote permanent deny: %v", err)
+		}
+		return
+	}
+	if err := p.AddAllowRule(&AllowRule{
+		Value:      srcIP,
+		Note:       note,
+		CreateTime: time.Now().Unix(),
+		Enabled:    true,
+	}); err != nil {
+		p.logger.WithField("src_ip", srcIP).Errorf("failed to promote permanent allow: %v", err)
+	}
+}
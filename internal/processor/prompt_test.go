@@ -0,0 +1,137 @@
+package processor
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danger-dream/ebpf-firewall/pkg/promptclient"
+)
+
+func newTestPromptServer(t *testing.T) *promptServer {
+	t.Helper()
+	srv, err := startPromptServer(filepath.Join(t.TempDir(), "prompt.sock"), testLogger())
+	if err != nil {
+		t.Fatalf("startPromptServer: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+func dialTestClient(t *testing.T, srv *promptServer) *promptclient.Client {
+	t.Helper()
+	client, err := promptclient.Dial(srv.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("promptclient.Dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// autoRespond answers every request a client receives with resp, substituting the request's own
+// ID, until the client disconnects.
+func autoRespond(client *promptclient.Client, action promptclient.Action, scope promptclient.Scope) {
+	go func() {
+		for req := range client.Requests() {
+			client.Respond(promptclient.Response{ID: req.ID, Action: action, Scope: scope})
+		}
+	}()
+}
+
+func TestPromptServerAskConcurrentPending(t *testing.T) {
+	srv := newTestPromptServer(t)
+	client := dialTestClient(t, srv)
+	autoRespond(client, promptclient.ActionAllow, promptclient.ScopeOnce)
+
+	// Wait for the server to register the connection before firing concurrent requests.
+	waitForConnCount(t, srv, 1)
+
+	const n = 20
+	var wg sync.WaitGroup
+	results := make([]promptclient.Response, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := srv.ask(promptclient.Request{ID: uniqueID(i)}, time.Second)
+			results[i] = resp
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatalf("request %d: unexpected error: %v", i, errs[i])
+		}
+		if results[i].ID != uniqueID(i) {
+			t.Fatalf("request %d: got response for ID %q, want %q", i, results[i].ID, uniqueID(i))
+		}
+		if results[i].Action != promptclient.ActionAllow {
+			t.Fatalf("request %d: got action %q, want allow", i, results[i].Action)
+		}
+	}
+}
+
+func TestPromptServerAskNoClients(t *testing.T) {
+	srv := newTestPromptServer(t)
+	if _, err := srv.ask(promptclient.Request{ID: "a"}, 50*time.Millisecond); err == nil {
+		t.Fatal("expected an error with no clients connected")
+	}
+}
+
+func TestPromptServerAskDisconnectedClient(t *testing.T) {
+	srv := newTestPromptServer(t)
+	client := dialTestClient(t, srv)
+	waitForConnCount(t, srv, 1)
+
+	// The client disconnects without ever answering.
+	client.Close()
+	waitForConnCount(t, srv, 0)
+
+	start := time.Now()
+	if _, err := srv.ask(promptclient.Request{ID: "a"}, 50*time.Millisecond); err == nil {
+		t.Fatal("expected an error once the only client has disconnected")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("ask took too long to give up on a disconnected client: %s", elapsed)
+	}
+}
+
+func TestPromptDecisionExpired(t *testing.T) {
+	now := time.Now().Unix()
+
+	permanent := &promptDecision{action: promptclient.ActionDeny}
+	if permanent.expired(now + 1_000_000) {
+		t.Fatal("a decision with no expiresAt should never expire")
+	}
+
+	expiring := &promptDecision{action: promptclient.ActionAllow, expiresAt: now + 5}
+	if expiring.expired(now) {
+		t.Fatal("decision should not be expired before its TTL elapses")
+	}
+	if !expiring.expired(now + 5) {
+		t.Fatal("decision should be expired once its TTL has elapsed")
+	}
+}
+
+func uniqueID(i int) string {
+	return "req-" + string(rune('a'+i))
+}
+
+func waitForConnCount(t *testing.T, srv *promptServer, want int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		srv.mu.Lock()
+		got := len(srv.conns)
+		srv.mu.Unlock()
+		if got == want {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d connections", want)
+}
@@ -0,0 +1,252 @@
+package processor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+	"github.com/sirupsen/logrus"
+
+	"github.com/danger-dream/ebpf-firewall/internal/notify"
+	"github.com/danger-dream/ebpf-firewall/internal/types"
+	"github.com/danger-dream/ebpf-firewall/internal/utils"
+)
+
+// RuleAction is what the processor does with a packet that matches a PolicyRule's Expr.
+type RuleAction string
+
+const (
+	RuleActionAllow     RuleAction = "allow"
+	RuleActionBlock     RuleAction = "block"
+	RuleActionLog       RuleAction = "log"
+	RuleActionThreshold RuleAction = "threshold"
+	RuleActionNotify    RuleAction = "notify"
+)
+
+// PolicyRule is a declarative alternative to BlockRule: instead of matching a single IP/CIDR/MAC,
+// Expr is compiled into a boolean expression over the packetEnv fields (e.g.
+// `dst_port == 22 && country != "CN"`), letting an operator express policy without recompiling
+// the firewall. Rules are evaluated in order in processPackets, and the first one whose Expr
+// matches wins.
+type PolicyRule struct {
+	ID         string     `json:"id"`
+	Note       string     `json:"note"`
+	Expr       string     `json:"expr"`
+	Action     RuleAction `json:"action"`
+	// TTL bounds how long a block or threshold-escalated block triggered by this rule lasts.
+	// Zero means the resulting BlockRule never expires.
+	TTL        time.Duration `json:"ttl"`
+	CreateTime int64         `json:"create_time"`
+	Enabled    bool          `json:"enabled"`
+
+	// program is Expr compiled against packetEnv, cached so evaluatePolicyRules doesn't
+	// recompile on every packet. Populated by compilePolicyRule, which validateProcessorConfig
+	// runs on every path that stores a PolicyRule.
+	program *vm.Program
+}
+
+// packetEnv is the expr evaluation environment: the subset of types.Packet fields an operator is
+// expected to write rules against. The `expr` struct tags give rules their snake_case names
+// (e.g. `dst_port == 22 && country != "CN"`), matching how the rest of ProcessorConfig's JSON is
+// named.
+type packetEnv struct {
+	SrcIP          string `expr:"src_ip"`
+	DstIP          string `expr:"dst_ip"`
+	SrcPort        uint16 `expr:"src_port"`
+	DstPort        uint16 `expr:"dst_port"`
+	IPProto        uint16 `expr:"ip_proto"`
+	EthType        uint16 `expr:"eth_type"`
+	Size           uint32 `expr:"size"`
+	Country        string `expr:"country"`
+	City           string `expr:"city"`
+	MatchType      uint32 `expr:"match_type"`
+	ThreatCategory string `expr:"threat_category"`
+}
+
+func newPacketEnv(packet *types.Packet) packetEnv {
+	return packetEnv{
+		SrcIP:          packet.SrcIP,
+		DstIP:          packet.DstIP,
+		SrcPort:        packet.SrcPort,
+		DstPort:        packet.DstPort,
+		IPProto:        uint16(packet.IPProto),
+		EthType:        uint16(packet.EthType),
+		Size:           packet.Size,
+		Country:        packet.Country,
+		City:           packet.City,
+		MatchType:      uint32(packet.MatchType),
+		ThreatCategory: packet.ThreatCategory,
+	}
+}
+
+// compilePolicyRule compiles rule.Expr against packetEnv and caches the result on rule.
+func compilePolicyRule(rule *PolicyRule) error {
+	program, err := expr.Compile(rule.Expr, expr.Env(packetEnv{}), expr.AsBool())
+	if err != nil {
+		return fmt.Errorf("invalid expr: %v", err)
+	}
+	rule.program = program
+	return nil
+}
+
+// matchPolicyRules runs every enabled rule against packet in order, stopping at the first match.
+// Rules whose program hasn't compiled (e.g. validation hasn't run yet) are skipped rather than
+// panicking.
+func matchPolicyRules(rules []PolicyRule, packet *types.Packet, logger logrus.FieldLogger) (*PolicyRule, bool) {
+	env := newPacketEnv(packet)
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.Enabled || rule.program == nil {
+			continue
+		}
+		out, err := expr.Run(rule.program, env)
+		if err != nil {
+			logger.WithField("rule_id", rule.ID).Errorf("policy rule failed to evaluate: %v", err)
+			continue
+		}
+		if matched, ok := out.(bool); ok && matched {
+			return rule, true
+		}
+	}
+	return nil, false
+}
+
+// evaluatePolicyRules runs the configured policy rules against packet and applies the first
+// match's action. It reports whether the packet's fate is already decided (allow or block), in
+// which case processPackets should return without running the threat-intel check below it;
+// "log" and "notify" are observational and let the rest of the pipeline keep running.
+func (p *Processor) evaluatePolicyRules(packet *types.Packet) bool {
+	rule, matched := matchPolicyRules(p.getConfig().Policy.Rules, packet, p.logger)
+	if !matched {
+		return false
+	}
+
+	switch rule.Action {
+	case RuleActionAllow:
+		packet.AllowReason = "policy:" + rule.ID
+		return true
+
+	case RuleActionBlock:
+		p.addPolicyBlock(rule, packet.SrcIP, true)
+		return true
+
+	case RuleActionThreshold:
+		enable := p.checkPolicyThreshold(rule, packet.SrcIP)
+		p.addPolicyBlock(rule, packet.SrcIP, enable)
+		return true
+
+	case RuleActionLog:
+		p.logger.WithFields(logrus.Fields{
+			"rule_id": rule.ID,
+			"src_ip":  packet.SrcIP,
+		}).Infof("policy rule matched (%s): %s", rule.Note, rule.Expr)
+		return false
+
+	case RuleActionNotify:
+		if p.notifier != nil {
+			p.notifier.Publish(notify.Event{
+				Type:      "policy_rule",
+				Timestamp: time.Now().Unix(),
+				IP:        packet.SrcIP,
+				Message:   rule.Note,
+				Extra:     map[string]any{"rule_id": rule.ID, "expr": rule.Expr},
+			})
+		}
+		return false
+	}
+	return false
+}
+
+// checkPolicyThreshold reuses ThreatIntel.MatchThreshold/MatchWindow - a policy rule doesn't
+// carry its own threshold, since "how many hits before escalating" is an operator-wide policy
+// knob, not a per-rule one - to decide whether rule has fired enough times for srcIP within the
+// window to escalate from monitor to block. The window state is keyed per rule+IP so it doesn't
+// collide with the threat-intel aggregator's own threshold tracking of the same IP.
+func (p *Processor) checkPolicyThreshold(rule *PolicyRule, srcIP string) bool {
+	config := p.getConfig()
+	now := time.Now().Unix()
+	window := config.ThreatIntel.MatchWindow
+	threshold := config.ThreatIntel.MatchThreshold
+	key := rule.ID + ":" + srcIP
+
+	var state *WindowState
+	if val, ok := p.windowStates.Load(key); ok {
+		state = val.(*WindowState)
+		if now-state.FirstTime > int64(window/time.Second) {
+			state = &WindowState{Count: 1, FirstTime: now}
+			p.windowStates.Store(key, state)
+		} else {
+			state.Count++
+		}
+	} else {
+		state = &WindowState{Count: 1, FirstTime: now}
+		p.windowStates.Store(key, state)
+	}
+	return state.Count >= int32(threshold)
+}
+
+// addPolicyBlock records a BlockRule for srcIP sourced from a policy-rule match, enabled only if
+// enable is true (e.g. a threshold rule that hasn't escalated yet still records the rule, so an
+// operator can see it was evaluated, but leaves the kernel untouched).
+func (p *Processor) addPolicyBlock(rule *PolicyRule, srcIP string, enable bool) {
+	expireTime := int64(0)
+	if rule.TTL > 0 {
+		expireTime = time.Now().Add(rule.TTL).Unix()
+	}
+	note := rule.Note
+	if note == "" {
+		note = fmt.Sprintf("matched policy rule %s", rule.ID)
+	}
+	if err := p.AddBlockRule(&BlockRule{
+		Value:      srcIP,
+		Note:       note,
+		Source:     BlockSourceTypePolicy,
+		CreateTime: time.Now().Unix(),
+		Enabled:    enable,
+		ExpireTime: expireTime,
+	}); err != nil {
+		p.logger.WithField("rule_id", rule.ID).Errorf("failed to add block rule for policy rule: %v", err)
+	}
+}
+
+// GetPolicyRules returns every configured policy rule, in evaluation order.
+func (p *Processor) GetPolicyRules() []PolicyRule {
+	return p.getConfig().Policy.Rules
+}
+
+// AddPolicyRule compiles and appends a new policy rule to the end of the evaluation order.
+func (p *Processor) AddPolicyRule(rule *PolicyRule) error {
+	rule.ID = utils.GenerateUUID()
+	return p.updateConfig(func(config *ProcessorConfig) error {
+		config.Policy.Rules = append(config.Policy.Rules, *rule)
+		return nil
+	})
+}
+
+// UpdatePolicyRule replaces the rule identified by id, recompiling its Expr.
+func (p *Processor) UpdatePolicyRule(id string, rule PolicyRule) error {
+	return p.updateConfig(func(config *ProcessorConfig) error {
+		for i := range config.Policy.Rules {
+			if config.Policy.Rules[i].ID == id {
+				rule.ID = id
+				config.Policy.Rules[i] = rule
+				return nil
+			}
+		}
+		return fmt.Errorf("policy rule not found: %s", id)
+	})
+}
+
+// DeletePolicyRule removes the rule identified by id.
+func (p *Processor) DeletePolicyRule(id string) error {
+	return p.updateConfig(func(config *ProcessorConfig) error {
+		for i := range config.Policy.Rules {
+			if config.Policy.Rules[i].ID == id {
+				config.Policy.Rules = append(config.Policy.Rules[:i], config.Policy.Rules[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("policy rule not found: %s", id)
+	})
+}
@@ -0,0 +1,120 @@
+package processor
+
+import (
+	"io"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/danger-dream/ebpf-firewall/internal/types"
+)
+
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func TestCompilePolicyRule(t *testing.T) {
+	t.Run("valid expr compiles and caches a program", func(t *testing.T) {
+		rule := &PolicyRule{Expr: `dst_port == 22 && country != "CN"`}
+		if err := compilePolicyRule(rule); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if rule.program == nil {
+			t.Fatal("expected program to be cached on the rule")
+		}
+	})
+
+	t.Run("invalid expr is rejected", func(t *testing.T) {
+		rule := &PolicyRule{Expr: `dst_port ===`}
+		if err := compilePolicyRule(rule); err == nil {
+			t.Fatal("expected a compile error")
+		}
+	})
+
+	t.Run("expr referencing an unknown field is rejected", func(t *testing.T) {
+		rule := &PolicyRule{Expr: `not_a_real_field == 1`}
+		if err := compilePolicyRule(rule); err == nil {
+			t.Fatal("expected a compile error for an unknown field")
+		}
+	})
+}
+
+func mustCompile(t *testing.T, rule *PolicyRule) *PolicyRule {
+	t.Helper()
+	if err := compilePolicyRule(rule); err != nil {
+		t.Fatalf("failed to compile %q: %v", rule.Expr, err)
+	}
+	return rule
+}
+
+func TestMatchPolicyRules(t *testing.T) {
+	t.Run("first matching enabled rule wins", func(t *testing.T) {
+		rules := []PolicyRule{
+			*mustCompile(t, &PolicyRule{ID: "a", Expr: `dst_port == 22`, Action: RuleActionLog, Enabled: true}),
+			*mustCompile(t, &PolicyRule{ID: "b", Expr: `dst_port == 22`, Action: RuleActionBlock, Enabled: true}),
+		}
+		packet := &types.Packet{DstPort: 22}
+
+		rule, matched := matchPolicyRules(rules, packet, testLogger())
+		if !matched {
+			t.Fatal("expected a match")
+		}
+		if rule.ID != "a" {
+			t.Fatalf("expected rule 'a' to win by order, got %q", rule.ID)
+		}
+	})
+
+	t.Run("disabled rules are skipped", func(t *testing.T) {
+		rules := []PolicyRule{
+			*mustCompile(t, &PolicyRule{ID: "a", Expr: `dst_port == 22`, Action: RuleActionBlock, Enabled: false}),
+			*mustCompile(t, &PolicyRule{ID: "b", Expr: `dst_port == 22`, Action: RuleActionAllow, Enabled: true}),
+		}
+		packet := &types.Packet{DstPort: 22}
+
+		rule, matched := matchPolicyRules(rules, packet, testLogger())
+		if !matched || rule.ID != "b" {
+			t.Fatalf("expected disabled rule 'a' to be skipped in favor of 'b', got %+v matched=%v", rule, matched)
+		}
+	})
+
+	t.Run("uncompiled rules are skipped instead of panicking", func(t *testing.T) {
+		rules := []PolicyRule{
+			{ID: "a", Expr: `dst_port == 22`, Action: RuleActionBlock, Enabled: true}, // program never compiled
+		}
+		packet := &types.Packet{DstPort: 22}
+
+		if _, matched := matchPolicyRules(rules, packet, testLogger()); matched {
+			t.Fatal("expected no match for an uncompiled rule")
+		}
+	})
+
+	t.Run("no rule matches when the expr evaluates false", func(t *testing.T) {
+		rules := []PolicyRule{
+			*mustCompile(t, &PolicyRule{ID: "a", Expr: `dst_port == 80`, Action: RuleActionBlock, Enabled: true}),
+		}
+		packet := &types.Packet{DstPort: 22}
+
+		if _, matched := matchPolicyRules(rules, packet, testLogger()); matched {
+			t.Fatal("expected no match")
+		}
+	})
+
+	t.Run("expr can reference GeoIP and threat-intel fields", func(t *testing.T) {
+		rules := []PolicyRule{
+			*mustCompile(t, &PolicyRule{
+				ID:      "a",
+				Expr:    `country == "US" && threat_category == "tor-exit"`,
+				Action:  RuleActionNotify,
+				Enabled: true,
+			}),
+		}
+		packet := &types.Packet{Country: "US", ThreatCategory: "tor-exit"}
+
+		rule, matched := matchPolicyRules(rules, packet, testLogger())
+		if !matched || rule.Action != RuleActionNotify {
+			t.Fatalf("expected a notify match, got %+v matched=%v", rule, matched)
+		}
+	})
+}
@@ -0,0 +1,215 @@
+package processor
+
+// processorConfigSchema is a JSON Schema (draft-07) description of ProcessorConfig. It mirrors
+// the constraints enforced by validateProcessorConfig so operators and external tooling can
+// validate a proposed processor.json before writing it to disk, without round-tripping through
+// the running process. Keep the two in sync by hand: this is documentation-as-contract, not the
+// thing that actually gates a load.
+const processorConfigSchema = `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"title": "ProcessorConfig",
+	"type": "object",
+	"additionalProperties": false,
+	"required": ["cleanup_interval", "blocklist", "threat_intel"],
+	"properties": {
+		"cleanup_interval": {
+			"type": "integer",
+			"description": "nanoseconds between sweeps of expired block rules and window states",
+			"exclusiveMinimum": 0
+		},
+		"blocklist": {
+			"type": "object",
+			"additionalProperties": false,
+			"required": ["default_block_duration", "rules"],
+			"properties": {
+				"default_block_duration": {
+					"type": "integer",
+					"description": "nanoseconds, 0 means never expire",
+					"minimum": 0
+				},
+				"rules": {
+					"type": "array",
+					"items": {
+						"type": "object",
+						"additionalProperties": false,
+						"required": ["id", "value", "source", "create_time", "enabled"],
+						"properties": {
+							"id": { "type": "string" },
+							"value": { "type": "string", "minLength": 1, "description": "IP, CIDR or MAC" },
+							"note": { "type": "string" },
+							"source": {
+								"type": "integer",
+								"description": "1=user, 2=threat-intel, 3=analyzer, 4=policy",
+								"enum": [1, 2, 3, 4]
+							},
+							"create_time": { "type": "integer" },
+							"enabled": { "type": "boolean" },
+							"expire_time": { "type": "integer", "description": "unix seconds, 0 means never" },
+							"extra": { "type": "object" }
+						}
+					}
+				}
+			}
+		},
+		"threat_intel": {
+			"type": "object",
+			"additionalProperties": false,
+			"required": ["match_mode", "match_threshold", "match_window", "block_duration"],
+			"properties": {
+				"ignore_local_network": { "type": "boolean" },
+				"kernel_drop": { "type": "boolean", "description": "mirror the aggregated indicator set into a kernel LPM_TRIE map so XDP drops matches itself" },
+				"match_mode": {
+					"type": "integer",
+					"description": "1=monitor, 2=block, 3=threshold, 4=prompt",
+					"enum": [1, 2, 3, 4]
+				},
+				"match_threshold": {
+					"type": "integer",
+					"description": "required >= 1 when match_mode is threshold (3)",
+					"minimum": 0
+				},
+				"match_window": {
+					"type": "integer",
+					"description": "nanoseconds, required > 0 when match_mode is threshold (3)",
+					"minimum": 0
+				},
+				"block_duration": {
+					"type": "integer",
+					"description": "nanoseconds, 0 means never expire",
+					"minimum": 0
+				},
+				"feeds": {
+					"type": "object",
+					"additionalProperties": {
+						"type": "object",
+						"additionalProperties": false,
+						"required": ["name", "schedule", "enabled"],
+						"properties": {
+							"name": { "type": "string" },
+							"description": { "type": "string" },
+							"schedule": { "type": "string", "description": "standard 5-field cron expression" },
+							"enabled": { "type": "boolean" },
+							"params": {
+								"type": "object",
+								"additionalProperties": { "type": "string" }
+							}
+						}
+					}
+				},
+				"prompt": {
+					"type": "object",
+					"additionalProperties": false,
+					"description": "required when match_mode is prompt (4); see MatchActionModePrompt",
+					"properties": {
+						"socket_path": { "type": "string", "description": "e.g. /var/run/ebpf-firewall/prompt.sock" },
+						"timeout": { "type": "integer", "description": "nanoseconds, required > 0 when match_mode is prompt (4)", "minimum": 0 },
+						"default_action": { "type": "string", "enum": ["allow", "deny"], "description": "applied when no client answers before timeout" }
+					}
+				}
+			}
+		},
+		"allow_list": {
+			"type": "object",
+			"additionalProperties": false,
+			"properties": {
+				"rules": { "type": "array", "items": { "$ref": "#/definitions/allowRule" } },
+				"scoped": {
+					"type": "array",
+					"items": {
+						"type": "object",
+						"additionalProperties": false,
+						"required": ["inside_cidr", "rules"],
+						"properties": {
+							"inside_cidr": { "type": "string", "description": "CIDR matched against the packet's destination IP" },
+							"rules": { "type": "array", "items": { "$ref": "#/definitions/allowRule" } }
+						}
+					}
+				}
+			}
+		},
+		"policy": {
+			"type": "object",
+			"additionalProperties": false,
+			"properties": {
+				"rules": {
+					"type": "array",
+					"items": {
+						"type": "object",
+						"additionalProperties": false,
+						"required": ["id", "expr", "action", "create_time", "enabled"],
+						"properties": {
+							"id": { "type": "string" },
+							"note": { "type": "string" },
+							"expr": { "type": "string", "minLength": 1, "description": "boolean expr over the packet's fields, e.g. dst_port == 22 && country != \"CN\"" },
+							"action": {
+								"type": "string",
+								"description": "what to do when expr evaluates true",
+								"enum": ["allow", "block", "log", "threshold", "notify"]
+							},
+							"ttl": { "type": "integer", "description": "nanoseconds a block/threshold triggered by this rule lasts; 0 means indefinite", "minimum": 0 },
+							"create_time": { "type": "integer" },
+							"enabled": { "type": "boolean" }
+						}
+					}
+				}
+			}
+		},
+		"firewall": {
+			"type": "object",
+			"additionalProperties": false,
+			"properties": {
+				"rules": {
+					"type": "array",
+					"items": {
+						"type": "object",
+						"additionalProperties": false,
+						"required": ["direction"],
+						"properties": {
+							"id": { "type": "string" },
+							"cidr": { "type": "string", "description": "IP or CIDR matched against the packet's remote address; empty matches any" },
+							"proto": { "type": "integer", "description": "IANA protocol number, 0 matches any", "minimum": 0 },
+							"ports": {
+								"type": ["array", "null"],
+								"items": {
+									"type": "object",
+									"additionalProperties": false,
+									"properties": {
+										"from": { "type": "integer", "minimum": 0, "maximum": 65535 },
+										"to": { "type": "integer", "minimum": 0, "maximum": 65535, "description": "0 means same as from; otherwise must not be less than from" }
+									}
+								}
+							},
+							"direction": { "type": "string", "enum": ["inbound", "outbound", "any"] },
+							"interface": { "type": "string", "description": "empty matches any interface" },
+							"note": { "type": "string" },
+							"create_time": { "type": "integer" },
+							"enabled": { "type": "boolean" }
+						}
+					}
+				}
+			}
+		}
+	},
+	"definitions": {
+		"allowRule": {
+			"type": "object",
+			"additionalProperties": false,
+			"required": ["id", "create_time", "enabled"],
+			"properties": {
+				"id": { "type": "string" },
+				"value": { "type": "string", "description": "IP or CIDR; mutually exclusive with name" },
+				"name": { "type": "string", "description": "reverse-DNS PTR regex; mutually exclusive with value" },
+				"interface": { "type": "string", "description": "empty matches any interface" },
+				"note": { "type": "string" },
+				"create_time": { "type": "integer" },
+				"enabled": { "type": "boolean" }
+			}
+		}
+	}
+}`
+
+// ProcessorConfigSchema returns the JSON Schema document describing ProcessorConfig, served by
+// GET /config/schema.
+func ProcessorConfigSchema() []byte {
+	return []byte(processorConfigSchema)
+}
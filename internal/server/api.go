@@ -1,10 +1,18 @@
 package server
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/danger-dream/ebpf-firewall/internal/firewall"
+	"github.com/danger-dream/ebpf-firewall/internal/logging"
+	"github.com/danger-dream/ebpf-firewall/internal/processor"
 	"github.com/gofiber/fiber/v3"
 )
 
@@ -13,7 +21,7 @@ func (s *Server) Ping(c fiber.Ctx) error {
 }
 
 func (s *Server) GetLinkType(c fiber.Ctx) error {
-	return c.SendString(s.ebpf.GetLinkType())
+	return c.JSON(s.ebpf.GetLinkTypes())
 }
 
 func (s *Server) GetMetricsReport(c fiber.Ctx) error {
@@ -25,6 +33,94 @@ func (s *Server) GetMetricsReport(c fiber.Ctx) error {
 	return c.JSON(s.metrics.GenerateReport(top))
 }
 
+// GetMetricsStream streams per-interval traffic deltas over SSE instead of making clients
+// poll GetMetricsReport, which sorts the full dataset on every call.
+func (s *Server) GetMetricsStream(c fiber.Ctx) error {
+	interval, err := strconv.Atoi(c.Query("interval", "1"))
+	if err != nil || interval < 1 {
+		interval = 1
+	}
+	n, err := strconv.Atoi(c.Query("n", "0"))
+	if err != nil || n < 0 {
+		n = 0
+	}
+	var types []string
+	if raw := c.Query("types", ""); raw != "" {
+		types = strings.Split(raw, ",")
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	deltas := s.metrics.StreamDeltas(ctx, time.Duration(interval)*time.Second, n, types)
+
+	return c.SendStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		for delta := range deltas {
+			data, err := json.Marshal(delta)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+}
+
+// GetEvents streams live flow/threatintel/blacklist/metrics events over SSE, replacing UI
+// polling of GetMetricsReport/GetSources for a live dashboard. A client that reconnects with a
+// Last-Event-ID header resumes from the bus's ring buffer instead of missing what happened while
+// it was away; a client that falls behind gets its events dropped and is told so via a
+// "dropped" frame rather than stalling every other subscriber.
+func (s *Server) GetEvents(c fiber.Ctx) error {
+	if s.events == nil {
+		return c.SendStatus(fiber.StatusServiceUnavailable)
+	}
+	var topics []string
+	if raw := c.Query("topics", ""); raw != "" {
+		topics = strings.Split(raw, ",")
+	}
+	lastEventID, _ := strconv.ParseInt(c.Get("Last-Event-ID"), 10, 64)
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+
+	sub := s.events.Subscribe(topics, lastEventID)
+
+	return c.SendStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+		lastDropped := int64(0)
+		for event := range sub.Events() {
+			data, err := json.Marshal(event.Data)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Topic, data); err != nil {
+				return
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+			if dropped := sub.Dropped(); dropped != lastDropped {
+				lastDropped = dropped
+				if _, err := fmt.Fprintf(w, "event: dropped\ndata: %d\n\n", dropped); err != nil {
+					return
+				}
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	})
+}
+
 func (s *Server) GetSources(c fiber.Ctx) error {
 	page, err := strconv.Atoi(c.Query("page", "1"))
 	if err != nil {
@@ -57,13 +153,133 @@ func (s *Server) GetTargets(c fiber.Ctx) error {
 	return c.JSON(s.metrics.GetTargets(sourceId, page, pageSize, order, sortDir))
 }
 
-func (s *Server) GetBlackList(c fiber.Ctx) error {
+func (s *Server) GetThreatIntelFeeds(c fiber.Ctx) error {
+	return c.JSON(s.processor.GetThreatIntelAggregator().GetFeedsMetadata())
+}
 
-	return nil
+func (s *Server) RefreshThreatIntelFeed(c fiber.Ctx) error {
+	name := c.Params("name")
+	if name == "" {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if err := s.processor.GetThreatIntelAggregator().RefreshFeed(name); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	return c.SendStatus(fiber.StatusOK)
 }
 
+func (s *Server) ExplainThreatIntelIP(c fiber.Ctx) error {
+	ip := c.Query("ip", "")
+	if ip == "" {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	return c.JSON(s.processor.GetThreatIntelAggregator().Explain(ip))
+}
+
+// GetRateLimitBuckets lists every rate-limit bucket currently tracked, for operators
+// diagnosing why a particular key is being throttled.
+func (s *Server) GetRateLimitBuckets(c fiber.Ctx) error {
+	return c.JSON(s.limiter.Buckets())
+}
+
+// LiftRateLimitBucket refills a bucket back to full capacity given its key (as returned by
+// GetRateLimitBuckets), letting an operator clear throttling without waiting it out.
+func (s *Server) LiftRateLimitBucket(c fiber.Ctx) error {
+	key := c.Query("key", "")
+	if key == "" {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if !s.limiter.Lift(key) {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// ReloadConfig re-reads processor.json from disk, validating it before applying so a bad edit
+// is rejected with a structured error list instead of silently corrupting the running config.
+func (s *Server) ReloadConfig(c fiber.Ctx) error {
+	if err := s.processor.ReloadConfig(); err != nil {
+		return s.respondConfigError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// GetConfigSchema returns the JSON Schema for ProcessorConfig so operators and tooling can
+// validate a proposed config before writing it to processor.json.
+func (s *Server) GetConfigSchema(c fiber.Ctx) error {
+	c.Set("Content-Type", "application/json")
+	return c.Send(processor.ProcessorConfigSchema())
+}
+
+// GetLogLevel reports the process's current logrus level.
+func (s *Server) GetLogLevel(c fiber.Ctx) error {
+	return c.JSON(fiber.Map{"level": s.rootLogger.GetLevel().String()})
+}
+
+// SetLogLevel raises or lowers the process's log level at runtime (e.g. to "debug" while
+// chasing down an issue), without needing a restart.
+func (s *Server) SetLogLevel(c fiber.Ctx) error {
+	var body struct {
+		Level string `json:"level"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if err := logging.SetLevel(s.rootLogger, body.Level); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	return c.JSON(fiber.Map{"level": s.rootLogger.GetLevel().String()})
+}
+
+// GetBlackList returns a page of configured block rules (IP, CIDR or MAC), optionally narrowed
+// to a single source (see BlockSourceType) so a client can e.g. list only operator-added rules.
+func (s *Server) GetBlackList(c fiber.Ctx) error {
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.Query("page_size", "20"))
+	if err != nil {
+		pageSize = 20
+	}
+	source, err := strconv.Atoi(c.Query("source", "0"))
+	if err != nil {
+		source = 0
+	}
+	rules, total, err := s.processor.GetBlockRules(page, pageSize, processor.BlockSourceType(source))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	return c.JSON(processor.BlockRulePage{Total: total, Items: rules})
+}
+
+// AddBlack adds a block rule, accepting a single IP, a CIDR, or a MAC address as Value.
 func (s *Server) AddBlack(c fiber.Ctx) error {
-	return nil
+	var rule processor.BlockRule
+	if err := json.Unmarshal(c.Body(), &rule); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	rule.CreateTime = time.Now().Unix()
+	if err := s.processor.AddBlockRule(&rule); err != nil {
+		return s.respondConfigError(c, err)
+	}
+	return c.JSON(rule)
+}
+
+// UpdateBlack replaces the block rule identified by :id.
+func (s *Server) UpdateBlack(c fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	var rule processor.BlockRule
+	if err := json.Unmarshal(c.Body(), &rule); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if err := s.processor.UpdateBlockRule(id, rule); err != nil {
+		return s.respondConfigError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
 }
 
 func (s *Server) DeleteBlack(c fiber.Ctx) error {
@@ -71,5 +287,205 @@ func (s *Server) DeleteBlack(c fiber.Ctx) error {
 	if id == "" {
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
-	return nil
+	if err := s.processor.DeleteBlockRule(id); err != nil {
+		return s.respondConfigError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// ExplainBlack reports whether ip is covered by a currently-enabled block rule, and which one,
+// the same way ExplainThreatIntelIP does for threat-intel feeds.
+func (s *Server) ExplainBlack(c fiber.Ctx) error {
+	ip := c.Query("ip", "")
+	if ip == "" {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	rule, blocked := s.processor.IsBlocked(ip)
+	return c.JSON(processor.BlockExplainResult{Blocked: blocked, Rule: rule})
+}
+
+// GetAllowRules returns the global allow-list.
+func (s *Server) GetAllowRules(c fiber.Ctx) error {
+	return c.JSON(s.processor.GetAllowRules())
+}
+
+// AddAllowRule adds a rule to the global allow-list.
+func (s *Server) AddAllowRule(c fiber.Ctx) error {
+	var rule processor.AllowRule
+	if err := json.Unmarshal(c.Body(), &rule); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	rule.CreateTime = time.Now().Unix()
+	if err := s.processor.AddAllowRule(&rule); err != nil {
+		return s.respondConfigError(c, err)
+	}
+	return c.JSON(rule)
+}
+
+// UpdateAllowRule replaces the allow rule identified by :id.
+func (s *Server) UpdateAllowRule(c fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	var rule processor.AllowRule
+	if err := json.Unmarshal(c.Body(), &rule); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if err := s.processor.UpdateAllowRule(id, rule); err != nil {
+		return s.respondConfigError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (s *Server) DeleteAllowRule(c fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if err := s.processor.DeleteAllowRule(id); err != nil {
+		return s.respondConfigError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// GetScopedAllowLists returns every inside-CIDR-scoped allow-list.
+func (s *Server) GetScopedAllowLists(c fiber.Ctx) error {
+	return c.JSON(s.processor.GetScopedAllowLists())
+}
+
+// AddScopedAllowRule adds a rule to the ScopedAllowList for the inside_cidr in the request body,
+// creating that scope if it doesn't exist yet. The CIDR is carried in the body rather than the
+// path since it contains a "/".
+func (s *Server) AddScopedAllowRule(c fiber.Ctx) error {
+	var req struct {
+		InsideCIDR string              `json:"inside_cidr"`
+		Rule       processor.AllowRule `json:"rule"`
+	}
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if req.InsideCIDR == "" {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	req.Rule.CreateTime = time.Now().Unix()
+	if err := s.processor.AddScopedAllowRule(req.InsideCIDR, &req.Rule); err != nil {
+		return s.respondConfigError(c, err)
+	}
+	return c.JSON(req.Rule)
+}
+
+// DeleteScopedAllowRule removes a rule from the ScopedAllowList for inside_cidr.
+func (s *Server) DeleteScopedAllowRule(c fiber.Ctx) error {
+	insideCIDR := c.Query("inside_cidr", "")
+	id := c.Params("id")
+	if insideCIDR == "" || id == "" {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if err := s.processor.DeleteScopedAllowRule(insideCIDR, id); err != nil {
+		return s.respondConfigError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// GetPolicyRules returns every configured policy rule, in evaluation order.
+func (s *Server) GetPolicyRules(c fiber.Ctx) error {
+	return c.JSON(s.processor.GetPolicyRules())
+}
+
+// AddPolicyRule appends a new policy rule to the end of the evaluation order.
+func (s *Server) AddPolicyRule(c fiber.Ctx) error {
+	var rule processor.PolicyRule
+	if err := json.Unmarshal(c.Body(), &rule); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	rule.CreateTime = time.Now().Unix()
+	if err := s.processor.AddPolicyRule(&rule); err != nil {
+		return s.respondConfigError(c, err)
+	}
+	return c.JSON(rule)
+}
+
+// UpdatePolicyRule replaces the policy rule identified by :id.
+func (s *Server) UpdatePolicyRule(c fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	var rule processor.PolicyRule
+	if err := json.Unmarshal(c.Body(), &rule); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if err := s.processor.UpdatePolicyRule(id, rule); err != nil {
+		return s.respondConfigError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// DeletePolicyRule removes the policy rule identified by :id.
+func (s *Server) DeletePolicyRule(c fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if err := s.processor.DeletePolicyRule(id); err != nil {
+		return s.respondConfigError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// GetFirewallRules returns every configured firewall rule, in evaluation order.
+func (s *Server) GetFirewallRules(c fiber.Ctx) error {
+	return c.JSON(s.processor.GetFirewallRules())
+}
+
+// AddFirewallRule appends a new firewall rule.
+func (s *Server) AddFirewallRule(c fiber.Ctx) error {
+	var rule firewall.Rule
+	if err := json.Unmarshal(c.Body(), &rule); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	rule.CreateTime = time.Now().Unix()
+	if err := s.processor.AddFirewallRule(&rule); err != nil {
+		return s.respondConfigError(c, err)
+	}
+	return c.JSON(rule)
+}
+
+// UpdateFirewallRule replaces the firewall rule identified by :id.
+func (s *Server) UpdateFirewallRule(c fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	var rule firewall.Rule
+	if err := json.Unmarshal(c.Body(), &rule); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	if err := s.processor.UpdateFirewallRule(id, rule); err != nil {
+		return s.respondConfigError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// DeleteFirewallRule removes the firewall rule identified by :id.
+func (s *Server) DeleteFirewallRule(c fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if err := s.processor.DeleteFirewallRule(id); err != nil {
+		return s.respondConfigError(c, err)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// respondConfigError reports a ProcessorConfig validation failure as a structured error list,
+// the same way ReloadConfig does, instead of a single opaque message.
+func (s *Server) respondConfigError(c fiber.Ctx, err error) error {
+	var verrs *processor.ValidationErrors
+	if errors.As(err, &verrs) {
+		return c.Status(fiber.StatusBadRequest).JSON(verrs)
+	}
+	return c.Status(fiber.StatusBadRequest).SendString(err.Error())
 }
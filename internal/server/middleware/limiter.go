@@ -1,86 +1,425 @@
-package middleware
-
-import "time"
-
-// IPRecord holds the count and last reset time for an IP address
-type IPRecord struct {
-	// the number of requests for the IP address
-	Count int
-	// the timestamp of the last reset
-	LastReset int64
-}
-
-// rate limiter for IP addresses
-type Limiter struct {
-	// maximum number of requests allowed per interval
-	rateLimitRequest int
-	// time interval in seconds for rate limiting
-	rateLimitInterval int
-	// map of IP addresses to their request counts and last reset times
-	ipMap map[string]*IPRecord
-	// channel to signal the cleanup goroutine to stop
-	channel chan struct{}
-}
-
-func NewLimiter(rateLimitRequest int, rateLimitInterval int) *Limiter {
-	if rateLimitRequest <= 0 {
-		rateLimitRequest = 120
-	}
-	if rateLimitInterval <= 0 {
-		rateLimitInterval = 60
-	}
-	limiter := Limiter{
-		rateLimitRequest:  rateLimitRequest,
-		rateLimitInterval: rateLimitInterval,
-		ipMap:             make(map[string]*IPRecord, 1024),
-		channel:           make(chan struct{}),
-	}
-	go limiter.cleanup()
-	return &limiter
-}
-
-func (l *Limiter) cleanup() {
-	ticker := time.NewTicker(time.Second * time.Duration(l.rateLimitInterval))
-	defer ticker.Stop()
-	for {
-		select {
-		case <-l.channel:
-			return
-		case <-ticker.C:
-			now := time.Now().Unix()
-			for ip, record := range l.ipMap {
-				if now-record.LastReset >= int64(l.rateLimitInterval) {
-					delete(l.ipMap, ip)
-				}
-			}
-		}
-	}
-}
-
-// check if an IP address is rate limited
-func (l *Limiter) IsRateLimited(ip string) bool {
-	now := time.Now().Unix()
-	if _, ok := l.ipMap[ip]; !ok {
-		l.ipMap[ip] = &IPRecord{
-			Count:     1,
-			LastReset: now,
-		}
-		// not rate limited
-		return false
-	}
-	record := l.ipMap[ip]
-	// if the last reset time is greater than the interval, reset the count and last reset time
-	if now-record.LastReset > int64(l.rateLimitInterval) {
-		record.Count = 1
-		record.LastReset = now
-		return false
-	}
-	// increment the count for the IP address
-	record.Count++
-	// check if the IP address is rate limited
-	return record.Count > l.rateLimitRequest
-}
-
-func (l *Limiter) Close() {
-	close(l.channel)
-}
+package middleware
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultIdleTTL is how long a bucket can go untouched before the GC reclaims it. Buckets are
+// cheap, but a firewall management API can see hundreds of thousands of distinct source
+// addresses over time, so idle ones still need to go away.
+const defaultIdleTTL = 10 * time.Minute
+
+// defaultMaxEntries bounds how many buckets a Limiter tracks at once, on top of the idle-TTL GC:
+// a burst of single-use source addresses (e.g. a scan from a spoofed or rotating range) would
+// otherwise grow entries unboundedly between GC sweeps.
+const defaultMaxEntries = 100_000
+
+// RouteRule overrides the default token-bucket parameters for requests whose path starts with
+// Prefix. The longest matching prefix wins; a zero value for any field falls back to the
+// limiter's default.
+type RouteRule struct {
+	Prefix    string
+	Rate      float64 // tokens refilled per second
+	Burst     int      // bucket capacity / max burst size
+	CIDRLenV4 int      // IPv4 addresses are masked to this prefix length before bucketing
+	CIDRLenV6 int      // IPv6 addresses are masked to this prefix length before bucketing
+}
+
+// bucket is a classic token bucket: tokens refill continuously at rate, capped at burst, and
+// every allowed request consumes one.
+type bucket struct {
+	mu         sync.Mutex
+	tokens     float64
+	rate       float64
+	burst      int
+	lastRefill time.Time
+}
+
+// bucketEntry pairs a bucket with the bookkeeping the GC heap needs: its key (for map
+// deletion) and its position in the heap (for O(log n) re-prioritization on access).
+type bucketEntry struct {
+	key        string
+	bucket     *bucket
+	lastAccess time.Time
+	index      int
+}
+
+// bucketHeap is a min-heap on lastAccess, so the GC can always pop the least-recently-used
+// bucket first instead of scanning the whole map every sweep.
+type bucketHeap []*bucketEntry
+
+func (h bucketHeap) Len() int           { return len(h) }
+func (h bucketHeap) Less(i, j int) bool { return h[i].lastAccess.Before(h[j].lastAccess) }
+func (h bucketHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+func (h *bucketHeap) Push(x any) {
+	entry := x.(*bucketEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *bucketHeap) Pop() any {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	entry.index = -1
+	*h = old[:n-1]
+	return entry
+}
+
+// Limiter is a token-bucket rate limiter keyed on a netip.Addr masked to a configurable CIDR
+// length per family, so abuse from an IPv6 /64 or a known proxy range can be capped as one
+// client instead of an unbounded set of distinct addresses.
+type Limiter struct {
+	mu             sync.Mutex
+	entries        map[string]*bucketEntry
+	gcHeap         bucketHeap
+	defaultRule    RouteRule
+	routes         []RouteRule // sorted longest-prefix-first
+	trustedProxies []netip.Prefix
+	idleTTL        time.Duration
+	maxEntries     int
+	now            func() time.Time
+	channel        chan struct{}
+	logger         logrus.FieldLogger
+}
+
+// normalizeRouteRules applies NewLimiterWithOptions's defaulting rules to defaultRate/
+// defaultBurst/cidrLenV4/cidrLenV6 and fills any zero-valued field of routes from the resulting
+// default rule, returning both sorted longest-prefix-first. Shared by NewLimiterWithOptions and
+// Reconfigure so a config reload normalizes new settings exactly the way startup does.
+func normalizeRouteRules(defaultRate float64, defaultBurst, cidrLenV4, cidrLenV6 int, routes []RouteRule) (RouteRule, []RouteRule) {
+	if defaultRate <= 0 {
+		defaultRate = 2
+	}
+	if defaultBurst <= 0 {
+		defaultBurst = 120
+	}
+	if cidrLenV4 <= 0 || cidrLenV4 > 32 {
+		cidrLenV4 = 32
+	}
+	if cidrLenV6 <= 0 || cidrLenV6 > 128 {
+		cidrLenV6 = 64
+	}
+	defaultRule := RouteRule{Rate: defaultRate, Burst: defaultBurst, CIDRLenV4: cidrLenV4, CIDRLenV6: cidrLenV6}
+
+	sorted := make([]RouteRule, len(routes))
+	copy(sorted, routes)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i].Prefix) > len(sorted[j].Prefix) })
+	for i := range sorted {
+		if sorted[i].Rate <= 0 {
+			sorted[i].Rate = defaultRule.Rate
+		}
+		if sorted[i].Burst <= 0 {
+			sorted[i].Burst = defaultRule.Burst
+		}
+		if sorted[i].CIDRLenV4 <= 0 {
+			sorted[i].CIDRLenV4 = defaultRule.CIDRLenV4
+		}
+		if sorted[i].CIDRLenV6 <= 0 {
+			sorted[i].CIDRLenV6 = defaultRule.CIDRLenV6
+		}
+	}
+	return defaultRule, sorted
+}
+
+// Reconfigure replaces the limiter's default rule and per-prefix route overrides, taking effect
+// for buckets created from this point on. Already-tracked buckets keep whatever rate/burst they
+// were given when created until they idle out and the GC reclaims them - the same
+// eventually-consistent reload model ElasticPool.Reconfigure uses for an in-flight queue.
+func (l *Limiter) Reconfigure(defaultRate float64, defaultBurst, cidrLenV4, cidrLenV6 int, routes []RouteRule) {
+	defaultRule, sorted := normalizeRouteRules(defaultRate, defaultBurst, cidrLenV4, cidrLenV6, routes)
+	l.mu.Lock()
+	l.defaultRule = defaultRule
+	l.routes = sorted
+	l.mu.Unlock()
+}
+
+// NewLimiter builds a Limiter. defaultRate/defaultBurst/cidrLenV4/cidrLenV6 apply to any
+// request whose path doesn't match a more specific entry in routes. trustedProxies is a list
+// of CIDRs (or bare IPs) allowed to supply a client IP via X-Real-IP/X-Forwarded-For. It's
+// NewLimiterWithOptions with the default capacity, the real clock and a discarding logger; use
+// that constructor directly to override any of those, e.g. from a test.
+func NewLimiter(defaultRate float64, defaultBurst, cidrLenV4, cidrLenV6 int, routes []RouteRule, trustedProxies []string) (*Limiter, error) {
+	return NewLimiterWithOptions(defaultRate, defaultBurst, cidrLenV4, cidrLenV6, routes, trustedProxies, 0, nil, nil)
+}
+
+// NewLimiterWithOptions is NewLimiter plus maxEntries (the most buckets tracked at once before
+// the least-recently-used one is evicted to make room; <= 0 uses defaultMaxEntries), clock (the
+// time source Allow/Peek/gc use; nil uses time.Now) and logger (nil discards), so tests can
+// control capacity pressure and refill timing deterministically and production can observe GC
+// activity.
+func NewLimiterWithOptions(defaultRate float64, defaultBurst, cidrLenV4, cidrLenV6 int, routes []RouteRule, trustedProxies []string, maxEntries int, clock func() time.Time, logger logrus.FieldLogger) (*Limiter, error) {
+	defaultRule, sorted := normalizeRouteRules(defaultRate, defaultBurst, cidrLenV4, cidrLenV6, routes)
+
+	proxies := make([]netip.Prefix, 0, len(trustedProxies))
+	for _, p := range trustedProxies {
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(p)
+			if aerr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %v", p, err)
+			}
+			bits := 32
+			if addr.Is6() {
+				bits = 128
+			}
+			prefix = netip.PrefixFrom(addr, bits)
+		}
+		proxies = append(proxies, prefix)
+	}
+
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxEntries
+	}
+	if clock == nil {
+		clock = time.Now
+	}
+	if logger == nil {
+		discard := logrus.New()
+		discard.SetOutput(io.Discard)
+		logger = discard
+	}
+
+	limiter := &Limiter{
+		entries:        make(map[string]*bucketEntry, 1024),
+		defaultRule:    defaultRule,
+		routes:         sorted,
+		trustedProxies: proxies,
+		idleTTL:        defaultIdleTTL,
+		maxEntries:     maxEntries,
+		now:            clock,
+		channel:        make(chan struct{}),
+		logger:         logger.WithField("component", "rate_limiter"),
+	}
+	go limiter.gc()
+	return limiter, nil
+}
+
+func (l *Limiter) gc() {
+	ticker := time.NewTicker(l.idleTTL / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.channel:
+			return
+		case <-ticker.C:
+			cutoff := l.now().Add(-l.idleTTL)
+			evicted := 0
+			l.mu.Lock()
+			for l.gcHeap.Len() > 0 && l.gcHeap[0].lastAccess.Before(cutoff) {
+				entry := heap.Pop(&l.gcHeap).(*bucketEntry)
+				delete(l.entries, entry.key)
+				evicted++
+			}
+			l.mu.Unlock()
+			if evicted > 0 {
+				l.logger.WithField("evicted", evicted).Debug("reclaimed idle rate-limit buckets")
+			}
+		}
+	}
+}
+
+// ResolveClientIP returns the address a request should be rate-limited under: peerIP unless
+// peerIP is a configured trusted proxy, in which case X-Real-IP (or the first hop of
+// X-Forwarded-For) is trusted instead.
+func (l *Limiter) ResolveClientIP(peerIP, xRealIP, xForwardedFor string) netip.Addr {
+	addr, err := netip.ParseAddr(peerIP)
+	if err != nil {
+		return netip.Addr{}
+	}
+	if !l.isTrustedProxy(addr) {
+		return addr
+	}
+	if xRealIP != "" {
+		if real, err := netip.ParseAddr(xRealIP); err == nil {
+			return real
+		}
+	}
+	if xForwardedFor != "" {
+		first := strings.TrimSpace(strings.Split(xForwardedFor, ",")[0])
+		if real, err := netip.ParseAddr(first); err == nil {
+			return real
+		}
+	}
+	return addr
+}
+
+func (l *Limiter) isTrustedProxy(addr netip.Addr) bool {
+	for _, p := range l.trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Limiter) matchRoute(path string) RouteRule {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, r := range l.routes {
+		if strings.HasPrefix(path, r.Prefix) {
+			return r
+		}
+	}
+	return l.defaultRule
+}
+
+func (l *Limiter) bucketKey(addr netip.Addr, rule RouteRule) string {
+	bits := rule.CIDRLenV4
+	if addr.Is6() && !addr.Is4In6() {
+		bits = rule.CIDRLenV6
+	}
+	masked := netip.PrefixFrom(addr.Unmap(), bits).Masked()
+	return rule.Prefix + "|" + masked.String()
+}
+
+func (l *Limiter) getOrCreateBucket(key string, rule RouteRule) *bucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.entries[key]
+	now := l.now()
+	if !ok {
+		if len(l.entries) >= l.maxEntries && l.gcHeap.Len() > 0 {
+			l.logger.WithField("max_entries", l.maxEntries).Warn("rate limiter at capacity, evicting least-recently-used bucket")
+		}
+		for len(l.entries) >= l.maxEntries && l.gcHeap.Len() > 0 {
+			evicted := heap.Pop(&l.gcHeap).(*bucketEntry)
+			delete(l.entries, evicted.key)
+		}
+		entry = &bucketEntry{
+			key: key,
+			bucket: &bucket{
+				tokens:     float64(rule.Burst),
+				rate:       rule.Rate,
+				burst:      rule.Burst,
+				lastRefill: now,
+			},
+			lastAccess: now,
+		}
+		l.entries[key] = entry
+		heap.Push(&l.gcHeap, entry)
+		return entry.bucket
+	}
+	entry.lastAccess = now
+	heap.Fix(&l.gcHeap, entry.index)
+	return entry.bucket
+}
+
+// Allow consumes a token for addr against the rule matching path. It reports whether the
+// request is allowed along with the limit/remaining/retry-after values a caller can surface
+// as standard RateLimit-Limit / RateLimit-Remaining / Retry-After headers.
+func (l *Limiter) Allow(addr netip.Addr, path string) (allowed bool, limit int, remaining int, retryAfter time.Duration) {
+	if !addr.IsValid() {
+		return true, 0, 0, 0
+	}
+	rule := l.matchRoute(path)
+	b := l.getOrCreateBucket(l.bucketKey(addr, rule), rule)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := l.now()
+	b.tokens += now.Sub(b.lastRefill).Seconds() * b.rate
+	if b.tokens > float64(b.burst) {
+		b.tokens = float64(b.burst)
+	}
+	b.lastRefill = now
+
+	allowed = b.tokens >= 1
+	if allowed {
+		b.tokens--
+	} else {
+		retryAfter = time.Duration((1-b.tokens)/b.rate*1000) * time.Millisecond
+	}
+	limit = b.burst
+	remaining = int(b.tokens)
+	return allowed, limit, remaining, retryAfter
+}
+
+// Peek reports the token count and burst capacity addr would see on its next Allow call for
+// path, without consuming a token or creating a bucket if one doesn't already exist. ok is false
+// if addr has no tracked bucket for the matching rule.
+func (l *Limiter) Peek(addr netip.Addr, path string) (tokens float64, burst int, ok bool) {
+	if !addr.IsValid() {
+		return 0, 0, false
+	}
+	rule := l.matchRoute(path)
+	key := l.bucketKey(addr, rule)
+
+	l.mu.Lock()
+	entry, exists := l.entries[key]
+	l.mu.Unlock()
+	if !exists {
+		return 0, 0, false
+	}
+
+	entry.bucket.mu.Lock()
+	defer entry.bucket.mu.Unlock()
+	tokens = entry.bucket.tokens + l.now().Sub(entry.bucket.lastRefill).Seconds()*entry.bucket.rate
+	if tokens > float64(entry.bucket.burst) {
+		tokens = float64(entry.bucket.burst)
+	}
+	return tokens, entry.bucket.burst, true
+}
+
+// BucketInfo is a point-in-time snapshot of a tracked bucket, used by the admin inspection
+// endpoint.
+type BucketInfo struct {
+	Key        string    `json:"key"`
+	Tokens     float64   `json:"tokens"`
+	Burst      int       `json:"burst"`
+	Rate       float64   `json:"rate"`
+	LastAccess time.Time `json:"last_access"`
+}
+
+// Buckets returns a snapshot of every currently tracked bucket.
+func (l *Limiter) Buckets() []BucketInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	infos := make([]BucketInfo, 0, len(l.entries))
+	for _, entry := range l.entries {
+		entry.bucket.mu.Lock()
+		infos = append(infos, BucketInfo{
+			Key:        entry.key,
+			Tokens:     entry.bucket.tokens,
+			Burst:      entry.bucket.burst,
+			Rate:       entry.bucket.rate,
+			LastAccess: entry.lastAccess,
+		})
+		entry.bucket.mu.Unlock()
+	}
+	return infos
+}
+
+// Lift refills a bucket back to full capacity, so an operator can clear throttling for a key
+// without waiting for it to refill naturally. It reports false if the key isn't tracked.
+func (l *Limiter) Lift(key string) bool {
+	l.mu.Lock()
+	entry, ok := l.entries[key]
+	l.mu.Unlock()
+	if !ok {
+		return false
+	}
+	entry.bucket.mu.Lock()
+	entry.bucket.tokens = float64(entry.bucket.burst)
+	entry.bucket.mu.Unlock()
+	return true
+}
+
+func (l *Limiter) Close() {
+	close(l.channel)
+}
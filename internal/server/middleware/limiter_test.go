@@ -1,142 +1,333 @@
 package middleware
 
 import (
-	"fmt"
+	"net/netip"
+	"sync"
 	"testing"
 	"time"
 )
 
-func TestLimiter(t *testing.T) {
-	// Initialize rate limiter: 3 requests per 5 seconds
-	limiter := NewLimiter(3, 5)
-	defer limiter.Close()
-	testIP := "192.168.1.1"
+func mustAddr(t *testing.T, s string) netip.Addr {
+	t.Helper()
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		t.Fatalf("invalid test address %q: %v", s, err)
+	}
+	return addr
+}
+
+// manualClock is an injectable clock for tests that need to control refill timing precisely
+// instead of sleeping and hoping the scheduler cooperates.
+type manualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newManualClock() *manualClock {
+	return &manualClock{now: time.Unix(0, 0)}
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
 
-	// Test Case 1: First access
-	if limiter.IsRateLimited(testIP) {
-		t.Error("Expected first access to not be rate limited")
+func TestLimiterBurst(t *testing.T) {
+	limiter, err := NewLimiter(1, 3, 32, 64, nil, nil)
+	if err != nil {
+		t.Fatalf("NewLimiter: %v", err)
 	}
+	defer limiter.Close()
+	addr := mustAddr(t, "192.168.1.1")
 
-	// Test Case 2: Normal access within limits
-	for i := 0; i < 2; i++ {
-		if limiter.IsRateLimited(testIP) {
-			t.Errorf("Expected access %d to not be rate limited", i+2)
+	for i := 0; i < 3; i++ {
+		if allowed, _, _, _ := limiter.Allow(addr, "/api/v1/ping"); !allowed {
+			t.Errorf("expected request %d within burst to be allowed", i+1)
 		}
 	}
+	if allowed, _, _, retryAfter := limiter.Allow(addr, "/api/v1/ping"); allowed {
+		t.Error("expected request beyond burst to be rate limited")
+	} else if retryAfter <= 0 {
+		t.Error("expected a positive retry-after when rate limited")
+	}
+}
 
-	// Test Case 3: Exceeding limit
-	if !limiter.IsRateLimited(testIP) {
-		t.Error("Expected fourth access to be rate limited")
+func TestLimiterRefillsOverTime(t *testing.T) {
+	limiter, err := NewLimiter(100, 1, 32, 64, nil, nil)
+	if err != nil {
+		t.Fatalf("NewLimiter: %v", err)
 	}
+	defer limiter.Close()
+	addr := mustAddr(t, "192.168.1.2")
 
-	// Test Case 4: After reset period
-	record := limiter.ipMap[testIP]
-	record.LastReset -= 6 // Simulate 6 seconds passing
+	if allowed, _, _, _ := limiter.Allow(addr, "/api/v1/ping"); !allowed {
+		t.Fatal("expected first request to be allowed")
+	}
+	if allowed, _, _, _ := limiter.Allow(addr, "/api/v1/ping"); allowed {
+		t.Fatal("expected second request to be rate limited before refill")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if allowed, _, _, _ := limiter.Allow(addr, "/api/v1/ping"); !allowed {
+		t.Error("expected request after refill window to be allowed")
+	}
+}
+
+func TestLimiterIndependentPerKey(t *testing.T) {
+	limiter, err := NewLimiter(1, 1, 32, 64, nil, nil)
+	if err != nil {
+		t.Fatalf("NewLimiter: %v", err)
+	}
+	defer limiter.Close()
+	ip1 := mustAddr(t, "192.168.1.3")
+	ip2 := mustAddr(t, "192.168.1.4")
 
-	if limiter.IsRateLimited(testIP) {
-		t.Error("Expected access after reset to not be rate limited")
+	if allowed, _, _, _ := limiter.Allow(ip1, "/api/v1/ping"); !allowed {
+		t.Error("expected IP1 first request to be allowed")
+	}
+	if allowed, _, _, _ := limiter.Allow(ip1, "/api/v1/ping"); allowed {
+		t.Error("expected IP1 second request to be rate limited")
+	}
+	if allowed, _, _, _ := limiter.Allow(ip2, "/api/v1/ping"); !allowed {
+		t.Error("expected IP2 to be unaffected by IP1's bucket")
 	}
 }
 
-func TestLimiterConcurrent(t *testing.T) {
-	limiter := NewLimiter(100, 2)
+func TestLimiterIPv6PrefixSharesBucket(t *testing.T) {
+	limiter, err := NewLimiter(1, 1, 32, 64, nil, nil)
+	if err != nil {
+		t.Fatalf("NewLimiter: %v", err)
+	}
 	defer limiter.Close()
-	testIP := "192.168.1.2"
+	a := mustAddr(t, "2001:db8::1")
+	b := mustAddr(t, "2001:db8::2")
 
-	// Test concurrent access
-	done := make(chan bool)
-	for i := 0; i < 100; i++ {
-		go func() {
-			limiter.IsRateLimited(testIP)
-			done <- true
-		}()
+	if allowed, _, _, _ := limiter.Allow(a, "/api/v1/ping"); !allowed {
+		t.Fatal("expected first address in the /64 to be allowed")
+	}
+	if allowed, _, _, _ := limiter.Allow(b, "/api/v1/ping"); allowed {
+		t.Error("expected a second address in the same /64 to share the bucket and be limited")
 	}
+}
 
-	for i := 0; i < 100; i++ {
-		<-done
+func TestLimiterRouteRuleOverride(t *testing.T) {
+	limiter, err := NewLimiter(1, 1, 32, 64, []RouteRule{
+		{Prefix: "/api/v1/black", Rate: 1, Burst: 5, CIDRLenV4: 32, CIDRLenV6: 64},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewLimiter: %v", err)
 	}
+	defer limiter.Close()
+	addr := mustAddr(t, "192.168.1.5")
 
-	if limiter.ipMap[testIP].Count != 100 {
-		t.Errorf("Expected request count to be 100, got %d", limiter.ipMap[testIP].Count)
+	for i := 0; i < 5; i++ {
+		if allowed, _, _, _ := limiter.Allow(addr, "/api/v1/black"); !allowed {
+			t.Errorf("expected route-specific burst request %d to be allowed", i+1)
+		}
+	}
+	if allowed, _, _, _ := limiter.Allow(addr, "/api/v1/black"); allowed {
+		t.Error("expected request beyond the route-specific burst to be rate limited")
+	}
+	// the default rule's single-token bucket is unaffected by the route-specific bucket
+	if allowed, _, _, _ := limiter.Allow(addr, "/api/v1/ping"); !allowed {
+		t.Error("expected default-rule bucket to be independent of the route-specific bucket")
 	}
 }
 
-func TestMultipleIPs(t *testing.T) {
-	limiter := NewLimiter(2, 5)
+func TestLimiterReconfigure(t *testing.T) {
+	limiter, err := NewLimiter(1, 1, 32, 64, nil, nil)
+	if err != nil {
+		t.Fatalf("NewLimiter: %v", err)
+	}
 	defer limiter.Close()
-	ip1 := "192.168.1.3"
-	ip2 := "192.168.1.4"
+	addr := mustAddr(t, "192.168.1.9")
 
-	// Test IP1 rate limiting
-	if limiter.IsRateLimited(ip1) {
-		t.Error("Expected IP1 first access to not be rate limited")
+	limiter.Reconfigure(1, 5, 32, 64, []RouteRule{
+		{Prefix: "/api/v1/black", Rate: 1, Burst: 2, CIDRLenV4: 32, CIDRLenV6: 64},
+	})
+
+	for i := 0; i < 5; i++ {
+		if allowed, _, _, _ := limiter.Allow(addr, "/api/v1/ping"); !allowed {
+			t.Errorf("expected reconfigured default burst request %d to be allowed", i+1)
+		}
 	}
-	if limiter.IsRateLimited(ip1) {
-		t.Error("Expected IP1 second access to not be rate limited")
+	if allowed, _, _, _ := limiter.Allow(addr, "/api/v1/ping"); allowed {
+		t.Error("expected request beyond the reconfigured default burst to be rate limited")
 	}
-	if !limiter.IsRateLimited(ip1) {
-		t.Error("Expected IP1 third access to be rate limited")
+
+	routeAddr := mustAddr(t, "192.168.1.10")
+	for i := 0; i < 2; i++ {
+		if allowed, _, _, _ := limiter.Allow(routeAddr, "/api/v1/black"); !allowed {
+			t.Errorf("expected new route-specific burst request %d to be allowed", i+1)
+		}
+	}
+	if allowed, _, _, _ := limiter.Allow(routeAddr, "/api/v1/black"); allowed {
+		t.Error("expected request beyond the new route-specific burst to be rate limited")
 	}
+}
 
-	// Test IP2 rate limiting (should not be affected by IP1)
-	if limiter.IsRateLimited(ip2) {
-		t.Error("Expected IP2 first access to not be rate limited")
+func TestLimiterResolveClientIPTrustsOnlyConfiguredProxies(t *testing.T) {
+	limiter, err := NewLimiter(10, 10, 32, 64, nil, []string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("NewLimiter: %v", err)
 	}
-	if limiter.IsRateLimited(ip2) {
-		t.Error("Expected IP2 second access to not be rate limited")
+	defer limiter.Close()
+
+	real := limiter.ResolveClientIP("10.0.0.1", "203.0.113.5", "")
+	if real.String() != "203.0.113.5" {
+		t.Errorf("expected trusted proxy's X-Real-IP to be used, got %s", real)
 	}
-	if !limiter.IsRateLimited(ip2) {
-		t.Error("Expected IP2 third access to be rate limited")
+
+	untrusted := limiter.ResolveClientIP("198.51.100.1", "203.0.113.5", "")
+	if untrusted.String() != "198.51.100.1" {
+		t.Errorf("expected untrusted peer's own IP to be used, got %s", untrusted)
 	}
 }
 
-func TestEdgeCases(t *testing.T) {
-	// Test with very short window
-	limiter := NewLimiter(3, 1)
+func TestLimiterBucketsAndLift(t *testing.T) {
+	limiter, err := NewLimiter(1, 1, 32, 64, nil, nil)
+	if err != nil {
+		t.Fatalf("NewLimiter: %v", err)
+	}
 	defer limiter.Close()
-	if limiter.IsRateLimited("192.168.1.5") {
-		t.Error("Expected first request to not be limited with short window")
+	addr := mustAddr(t, "192.168.1.6")
+
+	limiter.Allow(addr, "/api/v1/ping")
+	limiter.Allow(addr, "/api/v1/ping")
+
+	buckets := limiter.Buckets()
+	if len(buckets) != 1 {
+		t.Fatalf("expected 1 tracked bucket, got %d", len(buckets))
+	}
+	if !limiter.Lift(buckets[0].Key) {
+		t.Fatal("expected Lift to succeed for a tracked key")
+	}
+	if allowed, _, _, _ := limiter.Allow(addr, "/api/v1/ping"); !allowed {
+		t.Error("expected request after Lift to be allowed")
 	}
+	if limiter.Lift("does-not-exist") {
+		t.Error("expected Lift to report false for an untracked key")
+	}
+}
 
-	// Test cleanup of old records
-	limiter = NewLimiter(1, 1)
+// TestLimiterNoBoundaryBurst guards against the fixed-window limiter's old behavior, where a
+// request right before a window boundary and another right after it could both be allowed,
+// granting up to 2x burst. A token bucket refills continuously, so there's no boundary to land
+// on in the first place.
+func TestLimiterNoBoundaryBurst(t *testing.T) {
+	clock := newManualClock()
+	limiter, err := NewLimiterWithOptions(1, 1, 32, 64, nil, nil, 0, clock.Now, nil)
+	if err != nil {
+		t.Fatalf("NewLimiterWithOptions: %v", err)
+	}
 	defer limiter.Close()
-	for i := 0; i < 200; i++ {
-		ip := fmt.Sprintf("192.168.1.%d", i)
-		limiter.IsRateLimited(ip)
+	addr := mustAddr(t, "192.168.2.1")
+
+	if allowed, _, _, _ := limiter.Allow(addr, "/api/v1/ping"); !allowed {
+		t.Fatal("expected the first request to be allowed")
 	}
-	time.Sleep(1100 * time.Millisecond)
-	for i := 0; i < 5; i++ {
-		ip := fmt.Sprintf("192.168.2.%d", i)
-		limiter.IsRateLimited(ip)
+	clock.Advance(999 * time.Millisecond)
+	if allowed, _, _, _ := limiter.Allow(addr, "/api/v1/ping"); allowed {
+		t.Fatal("expected a request just before the bucket refills to be denied")
+	}
+	clock.Advance(1 * time.Millisecond)
+	if allowed, _, _, _ := limiter.Allow(addr, "/api/v1/ping"); !allowed {
+		t.Fatal("expected a request right at the 1s refill mark to be allowed")
 	}
-	if len(limiter.ipMap) != 5 {
-		t.Errorf("Expected old records to be cleaned up, got %d records", len(limiter.ipMap))
+	if allowed, _, _, _ := limiter.Allow(addr, "/api/v1/ping"); allowed {
+		t.Fatal("expected a second request in the same instant to be denied, not a double burst")
 	}
 }
 
-func TestBurstTraffic(t *testing.T) {
-	limiter := NewLimiter(5, 1)
+func TestLimiterEvictsUnderCapacityPressure(t *testing.T) {
+	clock := newManualClock()
+	limiter, err := NewLimiterWithOptions(1, 1, 32, 64, nil, nil, 2, clock.Now, nil)
+	if err != nil {
+		t.Fatalf("NewLimiterWithOptions: %v", err)
+	}
 	defer limiter.Close()
-	testIP := "192.168.1.6"
 
-	// Simulate burst traffic
-	for i := 0; i < 5; i++ {
-		if limiter.IsRateLimited(testIP) {
-			t.Errorf("Expected request %d to not be limited in burst", i+1)
-		}
+	first := mustAddr(t, "192.168.3.1")
+	second := mustAddr(t, "192.168.3.2")
+	third := mustAddr(t, "192.168.3.3")
+
+	limiter.Allow(first, "/api/v1/ping")
+	clock.Advance(time.Millisecond)
+	limiter.Allow(second, "/api/v1/ping")
+	clock.Advance(time.Millisecond)
+	// The third distinct address pushes entries over maxEntries, evicting the
+	// least-recently-touched bucket (first's).
+	limiter.Allow(third, "/api/v1/ping")
+
+	buckets := limiter.Buckets()
+	if len(buckets) != 2 {
+		t.Fatalf("expected eviction to cap tracked buckets at 2, got %d", len(buckets))
 	}
+	if _, _, ok := limiter.Peek(first, "/api/v1/ping"); ok {
+		t.Error("expected the least-recently-used bucket to have been evicted")
+	}
+	if _, _, ok := limiter.Peek(third, "/api/v1/ping"); !ok {
+		t.Error("expected the most recently created bucket to still be tracked")
+	}
+}
+
+func TestLimiterPeekDoesNotConsumeToken(t *testing.T) {
+	clock := newManualClock()
+	limiter, err := NewLimiterWithOptions(1, 3, 32, 64, nil, nil, 0, clock.Now, nil)
+	if err != nil {
+		t.Fatalf("NewLimiterWithOptions: %v", err)
+	}
+	defer limiter.Close()
+	addr := mustAddr(t, "192.168.4.1")
 
-	// Verify burst limit
-	if !limiter.IsRateLimited(testIP) {
-		t.Error("Expected request to be limited after burst")
+	if _, _, ok := limiter.Peek(addr, "/api/v1/ping"); ok {
+		t.Fatal("expected Peek to report no bucket before any request has been made")
 	}
 
-	// Wait for window reset
-	time.Sleep(1100 * time.Millisecond)
+	limiter.Allow(addr, "/api/v1/ping")
+	tokens, burst, ok := limiter.Peek(addr, "/api/v1/ping")
+	if !ok {
+		t.Fatal("expected a bucket to exist after Allow")
+	}
+	if burst != 3 {
+		t.Errorf("burst = %d, want 3", burst)
+	}
+	if tokens != 2 {
+		t.Errorf("tokens = %v, want 2 (burst minus the one Allow consumed)", tokens)
+	}
+
+	// Peeking again, with no time elapsed, must not have consumed anything itself.
+	if tokens2, _, _ := limiter.Peek(addr, "/api/v1/ping"); tokens2 != tokens {
+		t.Errorf("Peek mutated bucket state: got %v, then %v", tokens, tokens2)
+	}
+}
+
+func TestLimiterConcurrent(t *testing.T) {
+	limiter, err := NewLimiter(1000, 1000, 32, 64, nil, nil)
+	if err != nil {
+		t.Fatalf("NewLimiter: %v", err)
+	}
+	defer limiter.Close()
+	addr := mustAddr(t, "192.168.1.7")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.Allow(addr, "/api/v1/ping")
+		}()
+	}
+	wg.Wait()
 
-	// Verify counter reset
-	if limiter.IsRateLimited(testIP) {
-		t.Error("Expected request to not be limited after window reset")
+	buckets := limiter.Buckets()
+	if len(buckets) != 1 {
+		t.Fatalf("expected 1 tracked bucket, got %d", len(buckets))
 	}
 }
@@ -2,12 +2,16 @@ package middleware
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 
-	"github.com/gofiber/fiber/v3/log"
+	"github.com/sirupsen/logrus"
+
+	"github.com/danger-dream/ebpf-firewall/internal/notify"
 )
 
 // holds the count and time information for an IP address
@@ -41,9 +45,12 @@ type Security struct {
 	mu sync.RWMutex
 	// channel to signal the cleanup goroutine to stop
 	channel chan struct{}
+	// optional notifier, fired when an IP transitions into the block list
+	notifier *notify.Notifier
+	logger   logrus.FieldLogger
 }
 
-func NewSecurity(dataDir string, ipErrorThreshold int, errorWindow int) *Security {
+func NewSecurity(dataDir string, ipErrorThreshold int, errorWindow int, notifier *notify.Notifier, logger logrus.FieldLogger) *Security {
 	if ipErrorThreshold <= 0 {
 		ipErrorThreshold = 10
 	}
@@ -58,13 +65,29 @@ func NewSecurity(dataDir string, ipErrorThreshold int, errorWindow int) *Securit
 			ErrorCounter: make(map[string]*IPErrorCounter),
 			BlockList:    make(map[string]bool),
 		},
-		channel: make(chan struct{}),
+		channel:  make(chan struct{}),
+		notifier: notifier,
+		logger:   logger.WithField("component", "security"),
 	}
 	go security.cleanup()
 	security.loadBlockList()
 	return security
 }
 
+// SetThresholds updates the error threshold and window applied to subsequent AddRecord/cleanup
+// checks, so a config reload can tune them without restarting the process. Values <= 0 are
+// ignored and the previous setting is kept (NewSecurity instead falls back to its defaults).
+func (s *Security) SetThresholds(ipErrorThreshold, errorWindow int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ipErrorThreshold > 0 {
+		s.ipErrorThreshold = ipErrorThreshold
+	}
+	if errorWindow > 0 {
+		s.errorWindow = errorWindow
+	}
+}
+
 // cleanup the error counter
 func (s *Security) cleanup() {
 	ticker := time.NewTicker(time.Second * time.Duration(s.errorWindow))
@@ -144,8 +167,16 @@ func (s *Security) AddRecord(ip string, errorType string) {
 	// if the count of errors is greater than the threshold and the time window is within the error window, block the IP address
 	if record.Count >= s.ipErrorThreshold && now-record.FirstTime <= int64(s.errorWindow) {
 		s.block.BlockList[ip] = true
-		log.Warnf("ip %s is blocked", ip)
+		s.logger.WithField("ip", ip).Warn("ip is blocked")
 		s.saveBlockList()
+		if s.notifier != nil {
+			s.notifier.Publish(notify.Event{
+				Type:      "block",
+				Timestamp: now,
+				IP:        ip,
+				Message:   fmt.Sprintf("ip blocked after %d errors: %s", record.Count, errorType),
+			})
+		}
 	}
 }
 
@@ -159,6 +190,16 @@ func (s *Security) IsBlocked(ip string) bool {
 	return false
 }
 
+// WritePrometheus renders the blocklist gauge in Prometheus text exposition format.
+func (s *Security) WritePrometheus(w io.Writer) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	fmt.Fprintln(w, "# HELP ebpf_firewall_blocked_ips Number of IPs currently blocked due to repeated errors.")
+	fmt.Fprintln(w, "# TYPE ebpf_firewall_blocked_ips gauge")
+	fmt.Fprintf(w, "ebpf_firewall_blocked_ips %d\n", len(s.block.BlockList))
+	return nil
+}
+
 func (s *Security) Clear() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
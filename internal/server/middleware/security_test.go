@@ -1,18 +1,27 @@
 package middleware
 
 import (
+	"io"
 	"os"
 	"testing"
 	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
 func TestSecurity(t *testing.T) {
 	tmpFile := "test_blocklist.json"
 	defer os.Remove(tmpFile)
 
 	// Test Case 1: Basic initialization and first access
 	t.Run("Basic initialization", func(t *testing.T) {
-		sec := NewSecurity(tmpFile, 3, 5)
+		sec := NewSecurity(tmpFile, 3, 5, nil, testLogger())
 		defer sec.Clear()
 		testIP := "192.168.1.1"
 
@@ -37,7 +46,7 @@ func TestSecurity(t *testing.T) {
 
 	// Test Case 2: Test window expiration
 	t.Run("Window expiration", func(t *testing.T) {
-		sec := NewSecurity(tmpFile, 3, 1) // 1 second window
+		sec := NewSecurity(tmpFile, 3, 1, nil, testLogger()) // 1 second window
 		defer sec.Clear()
 		testIP := "192.168.1.2"
 		// Add two records
@@ -55,7 +64,7 @@ func TestSecurity(t *testing.T) {
 
 	// Test Case 3: Concurrent access
 	t.Run("Concurrent access", func(t *testing.T) {
-		sec := NewSecurity(tmpFile, 100, 5)
+		sec := NewSecurity(tmpFile, 100, 5, nil, testLogger())
 		defer sec.Clear()
 		testIP := "192.168.1.3"
 
@@ -78,7 +87,7 @@ func TestSecurity(t *testing.T) {
 
 	// Test Case 4: Multiple IPs
 	t.Run("Multiple IPs", func(t *testing.T) {
-		sec := NewSecurity(tmpFile, 3, 5)
+		sec := NewSecurity(tmpFile, 3, 5, nil, testLogger())
 		defer sec.Clear()
 		ip1 := "192.168.1.4"
 		ip2 := "192.168.1.5"
@@ -103,7 +112,7 @@ func TestSecurity(t *testing.T) {
 
 	// Test Case 5: Persistence
 	t.Run("Persistence", func(t *testing.T) {
-		sec1 := NewSecurity(tmpFile, 3, 5)
+		sec1 := NewSecurity(tmpFile, 3, 5, nil, testLogger())
 		defer sec1.Clear()
 		testIP := "192.168.1.6"
 
@@ -113,16 +122,35 @@ func TestSecurity(t *testing.T) {
 		}
 
 		// Create new instance and verify blocked status
-		sec2 := NewSecurity(tmpFile, 3, 5)
+		sec2 := NewSecurity(tmpFile, 3, 5, nil, testLogger())
 		defer sec2.Clear()
 		if !sec2.IsBlocked(testIP) {
 			t.Error("Expected IP to remain blocked after reload")
 		}
 	})
 
-	// Test Case 6: Edge Cases
+	// Test Case 6: SetThresholds
+	t.Run("SetThresholds", func(t *testing.T) {
+		sec := NewSecurity(tmpFile, 3, 5, nil, testLogger())
+		defer sec.Clear()
+		testIP := "192.168.1.8"
+
+		sec.SetThresholds(1, 5)
+		sec.AddRecord(testIP, "login_failed")
+		if !sec.IsBlocked(testIP) {
+			t.Error("Expected IP to be blocked immediately after lowering threshold to 1")
+		}
+
+		// values <= 0 are ignored, keeping the previous setting
+		sec.SetThresholds(0, 0)
+		if sec.ipErrorThreshold != 1 {
+			t.Errorf("Expected threshold to remain 1, got %d", sec.ipErrorThreshold)
+		}
+	})
+
+	// Test Case 7: Edge Cases
 	t.Run("Edge cases", func(t *testing.T) {
-		sec := NewSecurity(tmpFile, 1, 1)
+		sec := NewSecurity(tmpFile, 1, 1, nil, testLogger())
 		defer sec.Clear()
 		testIP := "192.168.1.7"
 
@@ -1,16 +1,21 @@
 package server
 
 import (
+	"bytes"
 	"embed"
-	"log"
 	"mime"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/sirupsen/logrus"
+
 	"github.com/danger-dream/ebpf-firewall/internal/config"
 	"github.com/danger-dream/ebpf-firewall/internal/ebpf"
+	"github.com/danger-dream/ebpf-firewall/internal/events"
 	"github.com/danger-dream/ebpf-firewall/internal/metrics"
+	"github.com/danger-dream/ebpf-firewall/internal/notify"
 	"github.com/danger-dream/ebpf-firewall/internal/processor"
 	"github.com/danger-dream/ebpf-firewall/internal/server/middleware"
 	"github.com/danger-dream/ebpf-firewall/internal/utils"
@@ -20,21 +25,32 @@ import (
 )
 
 type Server struct {
-	app       *fiber.App
-	ebpf      *ebpf.EBPFManager
-	metrics   *metrics.MetricsCollector
-	processor *processor.Processor
-	security  *middleware.Security
-	limiter   *middleware.Limiter
+	app        *fiber.App
+	ebpf       *ebpf.EBPFManager
+	metrics    *metrics.MetricsCollector
+	processor  *processor.Processor
+	security   *middleware.Security
+	limiter    *middleware.Limiter
+	notifier   *notify.Notifier
+	events     *events.EventBus
+	rootLogger *logrus.Logger
+	logger     logrus.FieldLogger
 }
 
-func New(ebpf *ebpf.EBPFManager, metrics *metrics.MetricsCollector, processor *processor.Processor) *Server {
+// New wires up a Server. logger is kept both as the raw *logrus.Logger (so the runtime
+// log-level endpoint can adjust it) and as a component-scoped FieldLogger handed to every
+// subsystem constructor.
+func New(ebpf *ebpf.EBPFManager, metrics *metrics.MetricsCollector, processor *processor.Processor, notifier *notify.Notifier, bus *events.EventBus, logger *logrus.Logger) *Server {
 	app := fiber.New()
 	server := &Server{
-		app:       app,
-		ebpf:      ebpf,
-		metrics:   metrics,
-		processor: processor,
+		app:        app,
+		ebpf:       ebpf,
+		metrics:    metrics,
+		processor:  processor,
+		notifier:   notifier,
+		events:     bus,
+		rootLogger: logger,
+		logger:     logger.WithField("component", "server"),
 	}
 	server.initServer()
 	server.setupRoutes()
@@ -43,8 +59,26 @@ func New(ebpf *ebpf.EBPFManager, metrics *metrics.MetricsCollector, processor *p
 
 func (s *Server) initServer() {
 	config := config.GetConfig()
-	s.security = middleware.NewSecurity(config.DataDir, config.Security.IPErrorThreshold, config.Security.ErrorWindow)
-	s.limiter = middleware.NewLimiter(config.RateLimit.RateLimitRequest, config.RateLimit.RateLimitInterval)
+	s.security = middleware.NewSecurity(config.DataDir, config.Security.IPErrorThreshold, config.Security.ErrorWindow, s.notifier, s.logger)
+
+	routes := make([]middleware.RouteRule, 0, len(config.RateLimit.Routes))
+	for _, r := range config.RateLimit.Routes {
+		routes = append(routes, middleware.RouteRule{
+			Prefix:    r.Prefix,
+			Rate:      r.Rate,
+			Burst:     r.Burst,
+			CIDRLenV4: r.CIDRLenV4,
+			CIDRLenV6: r.CIDRLenV6,
+		})
+	}
+	limiter, err := middleware.NewLimiterWithOptions(config.RateLimit.Rate, config.RateLimit.Burst, config.RateLimit.CIDRLenV4, config.RateLimit.CIDRLenV6, routes, config.RateLimit.TrustedProxies, 0, nil, s.logger)
+	if err != nil {
+		s.logger.Fatalf("failed to initialize rate limiter: %v", err)
+	}
+	s.limiter = limiter
+
+	go s.watchConfigChanges()
+
 	s.app.Use(cors.New(cors.Config{
 		AllowOrigins: []string{"*"},
 		AllowHeaders: []string{"Origin", "Content-Type", "Accept", "Authorization"},
@@ -64,6 +98,29 @@ func (s *Server) initServer() {
 	}))
 }
 
+// watchConfigChanges applies config reloads delivered via config.Subscribe to the subsystems
+// initServer built from the old config, so a hot config reload takes effect without restarting
+// the process. Runs for the lifetime of the server.
+func (s *Server) watchConfigChanges() {
+	for change := range config.Subscribe() {
+		newCfg := change.New
+		s.security.SetThresholds(newCfg.Security.IPErrorThreshold, newCfg.Security.ErrorWindow)
+
+		routes := make([]middleware.RouteRule, 0, len(newCfg.RateLimit.Routes))
+		for _, r := range newCfg.RateLimit.Routes {
+			routes = append(routes, middleware.RouteRule{
+				Prefix:    r.Prefix,
+				Rate:      r.Rate,
+				Burst:     r.Burst,
+				CIDRLenV4: r.CIDRLenV4,
+				CIDRLenV6: r.CIDRLenV6,
+			})
+		}
+		s.limiter.Reconfigure(newCfg.RateLimit.Rate, newCfg.RateLimit.Burst, newCfg.RateLimit.CIDRLenV4, newCfg.RateLimit.CIDRLenV6, routes)
+		s.logger.Info("applied reloaded config")
+	}
+}
+
 func (s *Server) setupRoutes() {
 	config := config.GetConfig()
 	api := s.app.Group("/api/v1", func(c fiber.Ctx) error {
@@ -86,7 +143,12 @@ func (s *Server) setupRoutes() {
 			if s.security.IsBlocked(srcIP) {
 				return c.SendStatus(fiber.StatusForbidden)
 			}
-			if s.limiter.IsRateLimited(srcIP) {
+			clientAddr := s.limiter.ResolveClientIP(c.IP(), c.Get("X-Real-IP"), c.Get("X-Forwarded-For"))
+			allowed, limit, remaining, retryAfter := s.limiter.Allow(clientAddr, c.Path())
+			c.Set("RateLimit-Limit", strconv.Itoa(limit))
+			c.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+			if !allowed {
+				c.Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
 				return c.SendStatus(fiber.StatusTooManyRequests)
 			}
 		}
@@ -108,14 +170,55 @@ func (s *Server) setupRoutes() {
 	api.Get("/link-type", s.GetLinkType)
 
 	api.Get("/metrics", s.GetMetricsReport)
+	api.Get("/metrics/stream", s.GetMetricsStream)
+	api.Get("/events", s.GetEvents)
 	api.Get("/sources", s.GetSources)
 	api.Get("/:sourceId/targets", s.GetTargets)
 
 	black := api.Group("/black")
 	black.Get("/", s.GetBlackList)
+	black.Get("/explain", s.ExplainBlack)
 	black.Post("/", s.AddBlack)
+	black.Put("/:id", s.UpdateBlack)
 	black.Delete("/:id", s.DeleteBlack)
 
+	threatIntel := api.Group("/threatintel")
+	threatIntel.Get("/", s.GetThreatIntelFeeds)
+	threatIntel.Get("/explain", s.ExplainThreatIntelIP)
+	threatIntel.Post("/:name/refresh", s.RefreshThreatIntelFeed)
+
+	rateLimit := api.Group("/rate-limit")
+	rateLimit.Get("/", s.GetRateLimitBuckets)
+	rateLimit.Post("/lift", s.LiftRateLimitBucket)
+
+	cfg := api.Group("/config")
+	cfg.Post("/reload", s.ReloadConfig)
+	cfg.Get("/schema", s.GetConfigSchema)
+
+	log := api.Group("/log-level")
+	log.Get("/", s.GetLogLevel)
+	log.Put("/", s.SetLogLevel)
+
+	allow := api.Group("/allow")
+	allow.Get("/", s.GetAllowRules)
+	allow.Post("/", s.AddAllowRule)
+	allow.Put("/:id", s.UpdateAllowRule)
+	allow.Delete("/:id", s.DeleteAllowRule)
+	allow.Get("/scoped", s.GetScopedAllowLists)
+	allow.Post("/scoped", s.AddScopedAllowRule)
+	allow.Delete("/scoped/:id", s.DeleteScopedAllowRule)
+
+	policy := api.Group("/policy")
+	policy.Get("/", s.GetPolicyRules)
+	policy.Post("/", s.AddPolicyRule)
+	policy.Put("/:id", s.UpdatePolicyRule)
+	policy.Delete("/:id", s.DeletePolicyRule)
+
+	fw := api.Group("/firewall")
+	fw.Get("/", s.GetFirewallRules)
+	fw.Post("/", s.AddFirewallRule)
+	fw.Put("/:id", s.UpdateFirewallRule)
+	fw.Delete("/:id", s.DeleteFirewallRule)
 }
 
 func (s *Server) ServeStaticDirectory(directory string) {
@@ -143,14 +246,14 @@ func (s *Server) ServeStaticDirectory(directory string) {
 func (s *Server) ServeEmbeddedFiles(staticFS embed.FS) {
 	s.app.Get("/*", func(c fiber.Ctx) error {
 		path := c.Path()
-		log.Println("serving static file: ", path)
+		s.logger.WithField("path", path).Debug("serving static file")
 		if path == "/" {
 			path = "/index.html"
 		}
 		filePath := filepath.Join("web/dist", path)
 		content, err := staticFS.ReadFile(filePath)
 		if err != nil {
-			log.Println("static file not found: ", filePath)
+			s.logger.WithField("path", filePath).Warn("static file not found")
 			return c.SendStatus(fiber.StatusNotFound)
 		}
 		ext := filepath.Ext(filePath)
@@ -161,6 +264,32 @@ func (s *Server) ServeEmbeddedFiles(staticFS embed.FS) {
 	})
 }
 
+// ServePrometheusMetrics registers a /metrics endpoint, outside the authenticated /api/v1
+// group, so existing monitoring stacks can scrape it the same way they scrape any other
+// Prometheus exporter.
+func (s *Server) ServePrometheusMetrics() {
+	s.app.Get("/metrics", func(c fiber.Ctx) error {
+		var buf bytes.Buffer
+		if err := s.metrics.WritePrometheus(&buf); err != nil {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		if err := s.security.WritePrometheus(&buf); err != nil {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		if err := s.ebpf.WritePrometheus(&buf); err != nil {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		if err := s.processor.GetThreatIntelAggregator().WritePrometheus(&buf); err != nil {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		if err := s.processor.WritePrometheus(&buf); err != nil {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		c.Set("Content-Type", "text/plain; version=0.0.4")
+		return c.SendString(buf.String())
+	})
+}
+
 func (s *Server) HandleStatusNotFound() {
 	s.app.Use(func(c fiber.Ctx) error {
 		s.security.AddRecord(c.IP(), "not found: "+c.Path())
@@ -3,18 +3,23 @@ package threatintel
 import (
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"net/netip"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/exp/maps"
 
+	"github.com/danger-dream/ebpf-firewall/internal/events"
 	"github.com/danger-dream/ebpf-firewall/internal/threatintel/iptrie"
 	"github.com/danger-dream/ebpf-firewall/internal/threatintel/provider"
-	"github.com/danger-dream/ebpf-firewall/internal/utils"
 )
 
 type FeedMetadata struct {
@@ -25,25 +30,45 @@ type FeedMetadata struct {
 	Params      map[string]string `json:"params"`
 }
 
-type ThreatFeed interface {
-	Name() string
-	Description() string
-	Schedule() string
-	Fetch(params map[string]string) ([]string, error)
-	DefaultParams() map[string]string
+// ThreatFeed is kept as an alias to provider.Provider so the rest of this file can keep
+// referring to feeds by the name callers already know, while concrete feeds live in and
+// self-register from the provider package.
+type ThreatFeed = provider.Provider
+
+// FeedMatch describes a single feed that a looked-up IP matched against, used to explain
+// why a given address is considered malicious.
+type FeedMatch struct {
+	Feed      string `json:"feed"`
+	FetchedAt int64  `json:"fetched_at"`
 }
 
+// OnAggregated is invoked after every aggregateIndicators pass with the flat set of IPv4 and IPv6
+// CIDRs the enabled feeds currently cover, split by family to match a kernel LPM_TRIE sync path's
+// separate v4/v6 maps (see ebpf.EBPFManager.SyncThreatIntel). Registered via SetOnAggregated; nil,
+// the default, leaves indicators enforced only via the in-memory trie.
+type OnAggregated func(v4, v6 []netip.Prefix)
+
 type Aggregator struct {
 	dataDir  string
 	cron     *cron.Cron
 	entryIDs map[string]cron.EntryID
 	trie     *iptrie.IPTrie
-	feeds    map[string]ThreatFeed
-	metadata *sync.Map
-	mu       sync.RWMutex
+	// attrTree attributes each indicator to the feed(s) that contributed it, for Explain and
+	// Category - a.trie stays the dedicated membership-only structure used by Contains, so the
+	// per-packet hot path never pays for attribution it doesn't need.
+	attrTree     *iptrie.Tree[iptrie.Entry]
+	feedCounts   map[string]int
+	feeds        map[string]ThreatFeed
+	metadata     *sync.Map
+	fetchedAt    sync.Map
+	fetchErrors  sync.Map
+	onAggregated OnAggregated
+	bus          *events.EventBus
+	mu           sync.RWMutex
+	logger       logrus.FieldLogger
 }
 
-func NewAggregator(dataDir string) (*Aggregator, error) {
+func NewAggregator(dataDir string, logger logrus.FieldLogger) (*Aggregator, error) {
 	dir := filepath.Join(dataDir, "threatintel")
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create data directory: %v", err)
@@ -54,14 +79,15 @@ func NewAggregator(dataDir string) (*Aggregator, error) {
 		cron:     cron.New(),
 		entryIDs: make(map[string]cron.EntryID),
 		trie:     iptrie.NewIPTrie(),
+		attrTree: iptrie.NewTree[iptrie.Entry](),
 		feeds:    make(map[string]ThreatFeed),
 		metadata: &sync.Map{},
+		logger:   logger.WithField("component", "threatintel"),
 	}
-	if err := agg.registerFeed(&provider.AbuseIPDB{}); err != nil {
-		return nil, err
-	}
-	if err := agg.registerFeed(&provider.Spamhaus{}); err != nil {
-		return nil, err
+	for _, p := range provider.List() {
+		if err := agg.registerFeed(p); err != nil {
+			return nil, err
+		}
 	}
 	return agg, nil
 }
@@ -126,43 +152,143 @@ func (a *Aggregator) syncFeed(name string) {
 	if !exists || info == nil || !info.Enabled {
 		return
 	}
+	params := a.paramsWithDataDir(info.Params)
+
+	if incremental, ok := source.(provider.IncrementalProvider); ok {
+		a.syncFeedIncremental(name, incremental, params)
+		return
+	}
 
-	ips, err := source.Fetch(info.Params)
+	prefixes, err := source.Fetch(params)
 	if err != nil {
-		log.Printf("Failed to fetch data from feed %s: %v", name, err)
+		a.logger.WithField("feed", name).Errorf("failed to fetch data from feed: %v", err)
+		a.recordFetchError(name)
 		return
 	}
-	if len(ips) == 0 {
-		log.Printf("No indicators retrieved from feed %s", name)
+	if len(prefixes) == 0 {
+		a.logger.WithField("feed", name).Warn("no indicators retrieved from feed")
 		return
 	}
 
-	validIPs := make([]string, 0, len(ips))
-	for _, ip := range ips {
-		if utils.ParseStringToIPType(ip) != utils.IPTypeUnknown {
-			validIPs = append(validIPs, ip)
-		}
+	lines := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		lines[i] = provider.FormatIndicator(prefix)
 	}
-	ips = validIPs
 
-	if len(ips) == 0 {
-		log.Printf("No valid indicators retrieved from feed %s", name)
+	a.logger.WithField("feed", name).Infof("successfully retrieved %d indicators from feed", len(lines))
+
+	filename := a.getIntelligenceFilename(name)
+	if err := os.WriteFile(filename, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		a.logger.WithField("feed", name).Errorf("failed to save data for feed: %v", err)
 		return
 	}
+	a.fetchedAt.Store(name, time.Now().Unix())
 
-	log.Printf("Successfully retrieved %d indicators from feed %s", len(ips), name)
+	a.aggregateIndicators()
+}
 
-	filename := a.getIntelligenceFilename(name)
-	if err := os.WriteFile(filename, []byte(strings.Join(ips, "\n")), 0644); err != nil {
-		log.Printf("Failed to save data for feed %s: %v", name, err)
+// syncFeedIncremental applies an IncrementalProvider's added/removed deltas to name's cached
+// file in place, rather than rewriting it from a full Fetch, and skips the trie rebuild entirely
+// when a poll comes back empty - which is the common case for a feed streaming mostly-quiet
+// diffs every couple of minutes.
+func (a *Aggregator) syncFeedIncremental(name string, source provider.IncrementalProvider, params map[string]string) {
+	added, removed, err := source.FetchIncremental(params)
+	if err != nil {
+		a.logger.WithField("feed", name).Errorf("failed to fetch incremental data from feed: %v", err)
+		a.recordFetchError(name)
+		return
+	}
+	if len(added) == 0 && len(removed) == 0 {
 		return
 	}
 
+	filename := a.getIntelligenceFilename(name)
+	existing := make(map[string]struct{})
+	if data, err := os.ReadFile(filename); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" {
+				existing[line] = struct{}{}
+			}
+		}
+	}
+	for _, prefix := range removed {
+		delete(existing, provider.FormatIndicator(prefix))
+	}
+	for _, prefix := range added {
+		existing[provider.FormatIndicator(prefix)] = struct{}{}
+	}
+
+	lines := make([]string, 0, len(existing))
+	for line := range existing {
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+
+	if err := os.WriteFile(filename, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		a.logger.WithField("feed", name).Errorf("failed to save data for feed: %v", err)
+		return
+	}
+	a.logger.WithField("feed", name).Infof("applied %d added / %d removed indicators from feed (%d total)", len(added), len(removed), len(lines))
+	a.fetchedAt.Store(name, time.Now().Unix())
 	a.aggregateIndicators()
 }
 
+// recordFetchError tallies a feed's Fetch/FetchIncremental failure for
+// ebpf_firewall_threatintel_fetch_errors_total.
+func (a *Aggregator) recordFetchError(name string) {
+	counter, _ := a.fetchErrors.LoadOrStore(name, new(atomic.Int64))
+	counter.(*atomic.Int64).Add(1)
+}
+
+// WritePrometheus renders per-feed threat-intel health in Prometheus text exposition format,
+// alongside the counters metrics.MetricsCollector and friends already expose on /metrics.
+func (a *Aggregator) WritePrometheus(w io.Writer) error {
+	a.mu.RLock()
+	feedCounts := make(map[string]int, len(a.feedCounts))
+	for name, count := range a.feedCounts {
+		feedCounts[name] = count
+	}
+	a.mu.RUnlock()
+
+	fmt.Fprintln(w, "# HELP ebpf_firewall_threatintel_indicators Number of indicators currently loaded from a feed.")
+	fmt.Fprintln(w, "# TYPE ebpf_firewall_threatintel_indicators gauge")
+	for name, count := range feedCounts {
+		fmt.Fprintf(w, "ebpf_firewall_threatintel_indicators{feed=%q} %d\n", name, count)
+	}
+
+	fmt.Fprintln(w, "# HELP ebpf_firewall_threatintel_last_sync_timestamp Unix timestamp of a feed's last successful sync.")
+	fmt.Fprintln(w, "# TYPE ebpf_firewall_threatintel_last_sync_timestamp gauge")
+	a.fetchedAt.Range(func(key, value interface{}) bool {
+		fmt.Fprintf(w, "ebpf_firewall_threatintel_last_sync_timestamp{feed=%q} %d\n", key.(string), value.(int64))
+		return true
+	})
+
+	fmt.Fprintln(w, "# HELP ebpf_firewall_threatintel_fetch_errors_total Total fetch failures for a feed.")
+	fmt.Fprintln(w, "# TYPE ebpf_firewall_threatintel_fetch_errors_total counter")
+	a.fetchErrors.Range(func(key, value interface{}) bool {
+		fmt.Fprintf(w, "ebpf_firewall_threatintel_fetch_errors_total{feed=%q} %d\n", key.(string), value.(*atomic.Int64).Load())
+		return true
+	})
+	return nil
+}
+
+// paramsWithDataDir returns a copy of params with "_data_dir" set to a's data directory, so a
+// feed that needs to persist a cursor between runs (see provider.CrowdSec) can find a stable
+// place to put it without the Provider interface needing a dedicated parameter for it.
+func (a *Aggregator) paramsWithDataDir(params map[string]string) map[string]string {
+	merged := make(map[string]string, len(params)+1)
+	for k, v := range params {
+		merged[k] = v
+	}
+	merged["_data_dir"] = a.dataDir
+	return merged
+}
+
 func (a *Aggregator) aggregateIndicators() {
 	trie := iptrie.NewIPTrie()
+	attrTree := iptrie.NewTree[iptrie.Entry]()
+	feedCounts := make(map[string]int)
 	total := 0
 	a.metadata.Range(func(key, value interface{}) bool {
 		info, _ := value.(*FeedMetadata)
@@ -175,21 +301,171 @@ func (a *Aggregator) aggregateIndicators() {
 		}
 		data, err := os.ReadFile(filename)
 		if err != nil {
-			log.Printf("Failed to read feed file %s: %v", filename, err)
+			a.logger.WithField("feed", info.Name).Errorf("failed to read feed file %s: %v", filename, err)
 			return true
 		}
+		prefixes := make([]netip.Prefix, 0, len(data)/12)
 		for _, line := range strings.Split(string(data), "\n") {
 			line = strings.TrimSpace(line)
-			if err := trie.Insert(line); err == nil {
-				total++
+			prefix, ok := provider.ParseIndicator(line)
+			if !ok {
+				continue
 			}
+			prefixes = append(prefixes, prefix)
+		}
+		// InsertAddrBulk aggregates the feed's prefixes and takes the write lock once per feed
+		// instead of once per line, so a feed with hundreds of thousands of entries doesn't
+		// serialize against ContainsAddr on the packet hot path for the length of the whole load.
+		total += trie.InsertAddrBulk(prefixes)
+		feedCounts[info.Name] = len(prefixes)
+		fetchedAtVal, _ := a.fetchedAt.Load(info.Name)
+		fetchedAt, _ := fetchedAtVal.(int64)
+		for _, prefix := range prefixes {
+			_ = attrTree.InsertAddrFrom(prefix, info.Name, iptrie.Entry{Source: info.Name, InsertedAt: fetchedAt})
 		}
 		return true
 	})
 	a.mu.Lock()
 	a.trie = trie
+	a.attrTree = attrTree
+	a.feedCounts = feedCounts
+	onAggregated := a.onAggregated
+	bus := a.bus
 	a.mu.Unlock()
-	log.Printf("threatintel aggregate indicators: %d", total)
+	a.logger.Infof("aggregated %d threat-intel indicators", total)
+
+	if bus != nil {
+		bus.Publish(events.TopicThreatIntel, time.Now().Unix(), map[string]int{"indicators": total, "feeds": len(feedCounts)})
+	}
+
+	if onAggregated != nil {
+		var v4, v6 []netip.Prefix
+		trie.Walk(func(prefix netip.Prefix) bool {
+			if prefix.Addr().Is4() {
+				v4 = append(v4, prefix)
+			} else {
+				v6 = append(v6, prefix)
+			}
+			return true
+		})
+		onAggregated(v4, v6)
+	}
+}
+
+// SetOnAggregated registers fn to receive the flat IPv4/IPv6 indicator sets after every
+// aggregation pass - e.g. to mirror them into a kernel LPM_TRIE map for in-kernel drops. Passing
+// nil (the default) stops delivery. Registering a non-nil fn triggers an immediate aggregation
+// pass, so it sees the current indicator set rather than waiting for the next feed sync.
+func (a *Aggregator) SetOnAggregated(fn OnAggregated) {
+	a.mu.Lock()
+	a.onAggregated = fn
+	a.mu.Unlock()
+	if fn != nil {
+		a.aggregateIndicators()
+	}
+}
+
+// Indicators returns the current full IPv4/IPv6 indicator sets from the live trie, split by
+// family the same way aggregateIndicators splits them for OnAggregated. Unlike SetOnAggregated,
+// this doesn't touch the callback or trigger a fresh aggregation pass - it's for a caller that
+// needs the existing indicator set on demand, e.g. to replay it into a single interface's kernel
+// maps after a restart (see ebpf.EBPFManager.SyncThreatIntelToInterface).
+func (a *Aggregator) Indicators() (v4, v6 []netip.Prefix) {
+	a.mu.RLock()
+	trie := a.trie
+	a.mu.RUnlock()
+	if trie == nil {
+		return nil, nil
+	}
+	trie.Walk(func(prefix netip.Prefix) bool {
+		if prefix.Addr().Is4() {
+			v4 = append(v4, prefix)
+		} else {
+			v6 = append(v6, prefix)
+		}
+		return true
+	})
+	return v4, v6
+}
+
+// SetEventBus registers bus to receive a threatintel event after every aggregation pass, for a
+// live dashboard subscribed to events.TopicThreatIntel. Passing nil (the default) stops delivery.
+func (a *Aggregator) SetEventBus(bus *events.EventBus) {
+	a.mu.Lock()
+	a.bus = bus
+	a.mu.Unlock()
+}
+
+// RefreshFeed triggers an immediate fetch for an enabled feed instead of waiting for its
+// next scheduled run, so operators can pull a fresh blocklist on demand.
+func (a *Aggregator) RefreshFeed(name string) error {
+	name = strings.ToLower(name)
+	if _, exists := a.feeds[name]; !exists {
+		return fmt.Errorf("feed not found: %s", name)
+	}
+	infoVal, exists := a.metadata.Load(name)
+	if !exists {
+		return fmt.Errorf("feed metadata not found: %s", name)
+	}
+	info, _ := infoVal.(*FeedMetadata)
+	if !info.Enabled {
+		return fmt.Errorf("feed is not enabled: %s", name)
+	}
+	a.syncFeed(name)
+	return nil
+}
+
+// Explain reports which enabled feeds currently list the given IP and when each feed was
+// last fetched, so operators can see why an address is being blocked.
+func (a *Aggregator) Explain(ip string) []FeedMatch {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil
+	}
+	a.mu.RLock()
+	attrTree := a.attrTree
+	a.mu.RUnlock()
+	if attrTree == nil {
+		return nil
+	}
+	sources := attrTree.MatchingSources(addr)
+	seen := make(map[string]struct{}, len(sources))
+	matches := make([]FeedMatch, 0, len(sources))
+	for _, src := range sources {
+		// A feed can contribute more than one covering CIDR at different specificities (e.g. a
+		// /16 and a more specific /24 both from the same feed) - MatchingSources walks every
+		// ancestor, so dedupe down to one FeedMatch per feed, same as the old per-feed
+		// trie.Contains check.
+		if _, ok := seen[src.Source]; ok {
+			continue
+		}
+		seen[src.Source] = struct{}{}
+		fetchedAt, _ := a.fetchedAt.Load(src.Source)
+		ts, _ := fetchedAt.(int64)
+		matches = append(matches, FeedMatch{Feed: src.Source, FetchedAt: ts})
+	}
+	return matches
+}
+
+// Category returns the name of the first enabled feed that lists ip, or "" if none do. It's a
+// cheaper alternative to Explain for callers that only need to know whether/which category an IP
+// falls into, not every matching feed or when each was last fetched.
+func (a *Aggregator) Category(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	a.mu.RLock()
+	attrTree := a.attrTree
+	a.mu.RUnlock()
+	if attrTree == nil {
+		return ""
+	}
+	entry, ok := attrTree.LookupAddr(addr)
+	if !ok {
+		return ""
+	}
+	return entry.Source
 }
 
 func (a *Aggregator) Close() {
@@ -0,0 +1,159 @@
+package iptrie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+)
+
+// InsertBulk parses each of cidrs as a bare IP or CIDR string and bulk-inserts them. Entries that
+// fail to parse are skipped and reported in the returned error; added only counts entries that
+// were genuinely new to the trie.
+//
+// Deprecated: parses every entry on every call; prefer InsertAddrBulk with already-parsed
+// netip.Prefix values on a path that loads a downloaded feed file.
+func (t *IPTrie) InsertBulk(cidrs []string) (added int, err error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	var errs []error
+	for _, cidr := range cidrs {
+		prefix, ok := parsePrefix(cidr)
+		if !ok {
+			errs = append(errs, fmt.Errorf("invalid IP or CIDR: %s", cidr))
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return t.InsertAddrBulk(prefixes), errors.Join(errs...)
+}
+
+// InsertAddrBulk aggregates prefixes - dropping entries already covered by a shorter prefix in
+// the batch and merging adjacent sibling prefixes into their parent (e.g. 10.0.0.0/25 and
+// 10.0.0.128/25 become 10.0.0.0/24) - then inserts the result while holding the write lock
+// exactly once, instead of once per entry. A threat-intel feed reload can hand this hundreds of
+// thousands of lines at once; inserting each individually would otherwise serialize every one of
+// them against ContainsAddr on the packet hot path for the length of the whole load, where one
+// aggregated pass blocks it only once and leaves a smaller trie behind besides.
+func (t *IPTrie) InsertAddrBulk(prefixes []netip.Prefix) (added int) {
+	aggregated := aggregatePrefixes(prefixes)
+	if len(aggregated) == 0 {
+		return 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	root := t.root.Load()
+	for _, prefix := range aggregated {
+		unified, bits := prefixToUnified(prefix)
+		newRoot, inserted := insertNode(root, unified, bits)
+		root = newRoot
+		if inserted {
+			added++
+		}
+	}
+	t.root.Store(root)
+	t.count.Add(int32(added))
+	return added
+}
+
+// Snapshot returns every prefix currently in the trie, e.g. to diff against an eBPF map's
+// contents on reload. Equivalent to collecting everything Walk visits into a slice.
+func (t *IPTrie) Snapshot() []netip.Prefix {
+	var prefixes []netip.Prefix
+	t.Walk(func(p netip.Prefix) bool {
+		prefixes = append(prefixes, p)
+		return true
+	})
+	return prefixes
+}
+
+// unifiedPrefix is aggregatePrefixes' working representation: a prefix's unified address and
+// unified bit length, the same shape insertNode/removeNode operate on.
+type unifiedPrefix struct {
+	addr [16]byte
+	bits int
+}
+
+// aggregatePrefixes sorts prefixes, drops entries already covered by a shorter prefix in the
+// batch, and merges adjacent sibling prefixes using the standard CIDR-merge algorithm: sort by
+// address then length, repeatedly fold the top two into their parent when they're siblings.
+func aggregatePrefixes(prefixes []netip.Prefix) []netip.Prefix {
+	if len(prefixes) == 0 {
+		return nil
+	}
+
+	seen := make(map[unifiedPrefix]bool, len(prefixes))
+	entries := make([]unifiedPrefix, 0, len(prefixes))
+	for _, p := range prefixes {
+		addr, bits := prefixToUnified(p)
+		up := unifiedPrefix{addr, bits}
+		if seen[up] {
+			continue
+		}
+		seen[up] = true
+		entries = append(entries, up)
+	}
+
+	// Broader prefixes (fewer bits) are considered first so a /8 already in the batch suppresses
+	// every /24 it contains, regardless of input order.
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].bits != entries[j].bits {
+			return entries[i].bits < entries[j].bits
+		}
+		return bytes.Compare(entries[i].addr[:], entries[j].addr[:]) < 0
+	})
+	kept := make([]unifiedPrefix, 0, len(entries))
+	for _, e := range entries {
+		covered := false
+		for _, k := range kept {
+			if prefixMatches(k.addr, k.bits, e.addr) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			kept = append(kept, e)
+		}
+	}
+
+	merged := mergeSiblings(kept)
+	result := make([]netip.Prefix, len(merged))
+	for i, e := range merged {
+		result[i] = unifiedToPrefix(e.addr, e.bits)
+	}
+	return result
+}
+
+// mergeSiblings repeatedly folds adjacent sibling prefixes (two /25s sharing a /24 parent) into
+// their parent, cascading upward when the merged parent turns out to have a sibling of its own.
+// entries must already be free of any prefix covered by another, or a sibling check could fold a
+// prefix into a parent that also still (redundantly) covers one of its own children.
+func mergeSiblings(entries []unifiedPrefix) []unifiedPrefix {
+	sort.Slice(entries, func(i, j int) bool {
+		c := bytes.Compare(entries[i].addr[:], entries[j].addr[:])
+		if c != 0 {
+			return c < 0
+		}
+		return entries[i].bits < entries[j].bits
+	})
+
+	stack := make([]unifiedPrefix, 0, len(entries))
+	for _, e := range entries {
+		cur := e
+		for len(stack) > 0 {
+			top := stack[len(stack)-1]
+			if top.bits != cur.bits || top.bits == 0 {
+				break
+			}
+			parentBits := cur.bits - 1
+			if !bitsEqual(top.addr, cur.addr, parentBits) || getBit(top.addr, parentBits) == getBit(cur.addr, parentBits) {
+				break
+			}
+			stack = stack[:len(stack)-1]
+			cur = unifiedPrefix{addr: maskAddr(top.addr, parentBits), bits: parentBits}
+		}
+		stack = append(stack, cur)
+	}
+	return stack
+}
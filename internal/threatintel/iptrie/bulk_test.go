@@ -0,0 +1,71 @@
+package iptrie
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestIPTrie_InsertAddrBulk_MergesSiblings(t *testing.T) {
+	trie := NewIPTrie()
+	added := trie.InsertAddrBulk([]netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/25"),
+		netip.MustParsePrefix("10.0.0.128/25"),
+	})
+	if added != 1 {
+		t.Fatalf("added = %d, want 1 (siblings should merge into a single /24)", added)
+	}
+	if trie.Size() != 1 {
+		t.Fatalf("Size() = %d, want 1", trie.Size())
+	}
+	if !trie.ContainsAddr(netip.MustParseAddr("10.0.0.200")) {
+		t.Error("expected merged /24 to cover an address only the second /25 held")
+	}
+}
+
+func TestIPTrie_InsertAddrBulk_DropsCoveredEntries(t *testing.T) {
+	trie := NewIPTrie()
+	added := trie.InsertAddrBulk([]netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/24"),
+		netip.MustParsePrefix("10.0.0.0/8"),
+	})
+	if added != 1 {
+		t.Fatalf("added = %d, want 1 (the /24 is covered by the /8 already in the batch)", added)
+	}
+	match, ok := trie.LongestMatch(netip.MustParseAddr("10.0.0.1"))
+	if !ok || match.String() != "10.0.0.0/8" {
+		t.Errorf("LongestMatch() = (%v, %v), want (10.0.0.0/8, true)", match, ok)
+	}
+}
+
+func TestIPTrie_InsertBulk(t *testing.T) {
+	trie := NewIPTrie()
+	added, err := trie.InsertBulk([]string{"192.168.1.0/25", "192.168.1.128/25", "not-a-cidr"})
+	if err == nil {
+		t.Error("expected an error reporting the unparseable entry")
+	}
+	if added != 1 {
+		t.Fatalf("added = %d, want 1 (the two /25s should merge)", added)
+	}
+	if !trie.ContainsAddr(netip.MustParseAddr("192.168.1.1")) {
+		t.Error("expected merged /24 to contain the batch's addresses")
+	}
+}
+
+func TestIPTrie_Snapshot(t *testing.T) {
+	trie := NewIPTrie()
+	trie.InsertAddrBulk([]netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	})
+	snapshot := trie.Snapshot()
+	if len(snapshot) != 2 {
+		t.Fatalf("Snapshot() returned %d prefixes, want 2", len(snapshot))
+	}
+	seen := make(map[string]bool, len(snapshot))
+	for _, p := range snapshot {
+		seen[p.String()] = true
+	}
+	if !seen["10.0.0.0/8"] || !seen["2001:db8::/32"] {
+		t.Errorf("Snapshot() = %v, missing an inserted prefix", snapshot)
+	}
+}
@@ -1,335 +1,339 @@
+// Package iptrie implements a level-compressed (PATRICIA-style) binary radix trie for IP
+// prefix membership and longest-prefix-match lookups.
+//
+// Internally every prefix is folded into a single 128-bit unified address space: IPv4 addresses
+// are mapped into ::ffff:0:0/96, as netip.Addr.As16 already does, so one trie holds both
+// families without dedicated v4 code paths (see network.go). Callers never observe this mapping
+// directly - LongestMatch and Walk unmap back to the original family via netip.Addr.Is4In6()
+// before returning a netip.Prefix, so a prefix inserted as "10.0.0.0/8" is always returned as an
+// Is4() prefix, never an Is4In6() one.
 package iptrie
 
 import (
 	"fmt"
 	"net"
-	"strings"
+	"net/netip"
 	"sync"
 	"sync/atomic"
 )
 
+// node is immutable once published: Insert/Remove build a new path of nodes sharing every
+// untouched subtree with the previous tree, and the trie publishes the new root with a single
+// atomic store. This makes Contains/LongestMatch/Walk lock-free for readers.
+type node struct {
+	left, right *node
+	addr        [16]byte // this node's prefix, masked to `bits`
+	bits        int      // length of the compressed edge ending at this node, in unified bits
+	present     bool     // true if this exact prefix was inserted and hasn't been removed
+}
+
 type IPTrie struct {
-	mu       sync.RWMutex
-	ipv4Root *prefixNode
-	ipv6Root *prefixNode
+	root  atomic.Pointer[node]
+	count atomic.Int32
+	mu    sync.Mutex // serializes writers; readers never take this lock
 }
 
 func NewIPTrie() *IPTrie {
-	_, rootNet, _ := net.ParseCIDR("0.0.0.0/0")
-	_, rootNet6, _ := net.ParseCIDR("0::0/0")
-	return &IPTrie{
-		ipv4Root: &prefixNode{
-			children: make([]*prefixNode, 2, 8),
-			skipBits: 0,
-			network:  NewIPNetwork(rootNet),
-		},
-		ipv6Root: &prefixNode{
-			children: make([]*prefixNode, 2, 8),
-			skipBits: 0,
-			network:  NewIPNetwork(rootNet6),
-		},
-	}
+	return &IPTrie{}
 }
 
+// Insert parses addr as a bare IP or CIDR string and inserts it.
+//
+// Deprecated: parses addr on every call; prefer InsertAddr with an already-parsed netip.Prefix
+// on paths that run per-packet or per-line.
 func (t *IPTrie) Insert(addr string) error {
-	ipNet := parseIPAddrToIPNet(addr)
-	if ipNet == nil {
+	prefix, ok := parsePrefix(addr)
+	if !ok {
 		return fmt.Errorf("invalid IP or CIDR: %s", addr)
 	}
+	return t.InsertAddr(prefix)
+}
+
+// InsertAddr inserts prefix, which is masked to its own bit length before the insert so callers
+// don't need to call prefix.Masked() themselves.
+func (t *IPTrie) InsertAddr(prefix netip.Prefix) error {
+	unified, bits := prefixToUnified(prefix)
+
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	if ipNet.IP.To4() != nil {
-		return t.ipv4Root.Insert(ipNet)
+	newRoot, inserted := insertNode(t.root.Load(), unified, bits)
+	if !inserted {
+		return fmt.Errorf("network already exists")
 	}
-	return t.ipv6Root.Insert(ipNet)
+	t.root.Store(newRoot)
+	t.count.Add(1)
+	return nil
 }
 
+// Contains parses addr as a bare IP string and reports whether any inserted prefix covers it.
+//
+// Deprecated: parses addr on every call; prefer ContainsAddr with an already-parsed netip.Addr
+// on the packet hot path.
 func (t *IPTrie) Contains(addr string) bool {
-	ipNet := parseIPAddrToIPNet(addr)
-	if ipNet == nil {
+	ip, ok := parseAddr(addr)
+	if !ok {
 		return false
 	}
-	t.mu.RLock()
-	defer t.mu.RUnlock()
-	if ipNet.IP.To4() != nil {
-		return t.ipv4Root.Contains(ipNet.IP)
+	return t.ContainsAddr(ip)
+}
+
+// ContainsAddr reports whether any inserted prefix covers addr. It performs no string parsing
+// and no heap allocation, making it safe to call on the per-packet hot path.
+func (t *IPTrie) ContainsAddr(addr netip.Addr) bool {
+	_, found := longestMatch(t.root.Load(), addrToUnified(addr))
+	return found
+}
+
+// LongestMatch returns the most specific inserted prefix that contains addr, if any. It is
+// lock-free: callers on the packet hot path never block behind an Insert/Remove.
+func (t *IPTrie) LongestMatch(addr netip.Addr) (netip.Prefix, bool) {
+	match, found := longestMatch(t.root.Load(), addrToUnified(addr))
+	if !found {
+		return netip.Prefix{}, false
 	}
-	return t.ipv6Root.Contains(ipNet.IP)
+	return unifiedToPrefix(match.addr, match.bits), true
+}
+
+// Walk calls fn for every prefix currently present in the trie, stopping early if fn returns
+// false.
+func (t *IPTrie) Walk(fn func(netip.Prefix) bool) {
+	walk(t.root.Load(), fn)
 }
 
+// Remove parses addr as a bare IP or CIDR string and removes it.
+//
+// Deprecated: parses addr on every call; prefer RemoveAddr with an already-parsed netip.Prefix.
 func (t *IPTrie) Remove(addr string) error {
-	ipNet := parseIPAddrToIPNet(addr)
-	if ipNet == nil {
+	prefix, ok := parsePrefix(addr)
+	if !ok {
 		return fmt.Errorf("invalid IP or CIDR: %s", addr)
 	}
+	return t.RemoveAddr(prefix)
+}
+
+// RemoveAddr clears prefix if it is present. Removing a prefix that was never inserted is a
+// no-op, not an error, matching the string-based Remove.
+func (t *IPTrie) RemoveAddr(prefix netip.Prefix) error {
+	unified, bits := prefixToUnified(prefix)
+
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	if ipNet.IP.To4() != nil {
-		return t.ipv4Root.Remove(ipNet)
+	newRoot, removed := removeNode(t.root.Load(), unified, bits)
+	if removed {
+		t.root.Store(newRoot)
+		t.count.Add(-1)
 	}
-	return t.ipv6Root.Remove(ipNet)
+	return nil
 }
 
 func (t *IPTrie) Size() int32 {
-	t.mu.RLock()
-	defer t.mu.RUnlock()
-	return t.ipv4Root.Size() + t.ipv6Root.Size()
+	return t.count.Load()
 }
 
 func (t *IPTrie) String() string {
-	t.mu.RLock()
-	defer t.mu.RUnlock()
-	return t.ipv4Root.String() + "\n" + t.ipv6Root.String()
+	s := ""
+	t.Walk(func(p netip.Prefix) bool {
+		s += p.String() + "\n"
+		return true
+	})
+	return s
 }
 
-func parseIPAddrToIPNet(addr string) *net.IPNet {
-	_, ipNet, err := net.ParseCIDR(addr)
-	if err != nil {
-		ip := net.ParseIP(addr)
-		if ip == nil {
-			return nil
-		}
-		if ip.To4() != nil {
-			ipNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}
-		} else {
-			ipNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
-		}
+// insertNode returns a new subtree with (addr, bits) present, sharing every subtree of n that
+// wasn't on the insertion path. It splits the existing compressed edge on the first differing
+// bit, mirroring the classic PATRICIA insert.
+func insertNode(n *node, addr [16]byte, bits int) (*node, bool) {
+	if n == nil {
+		return &node{addr: maskAddr(addr, bits), bits: bits, present: true}, true
 	}
-	return ipNet
-}
 
-type prefixNode struct {
-	parent    *prefixNode
-	children  []*prefixNode
-	skipBits  uint
-	network   IPNetwork
-	isLeaf    bool
-	nodeCount int32
-}
+	common := commonBits(n.addr, addr, min(n.bits, bits))
 
-func newPathNode(network IPNetwork, numBitsSkipped uint) *prefixNode {
-	path := &prefixNode{
-		children: make([]*prefixNode, 2),
-		skipBits: numBitsSkipped,
-		network:  network.Masked(int(numBitsSkipped)),
+	if common == n.bits && n.bits == bits {
+		if n.present {
+			return n, false
+		}
+		newNode := *n
+		newNode.present = true
+		return &newNode, true
 	}
-	return path
-}
-
-func newLeafNode(network IPNetwork) *prefixNode {
-	leaf := newPathNode(network, uint(network.PrefixLen))
-	leaf.isLeaf = true
-	return leaf
-}
 
-func (p *prefixNode) Insert(entry *net.IPNet) error {
-	n := NewIPNetwork(entry)
-	sizeIncreased, err := p.insertNetwork(n)
-	if sizeIncreased {
-		atomic.AddInt32(&p.nodeCount, 1)
-	} else if err == nil {
-		return fmt.Errorf("network already exists")
+	if common == n.bits && bits > n.bits {
+		newNode := *n
+		if getBit(addr, n.bits) == 0 {
+			child, ok := insertNode(n.left, addr, bits)
+			newNode.left = child
+			return &newNode, ok
+		}
+		child, ok := insertNode(n.right, addr, bits)
+		newNode.right = child
+		return &newNode, ok
 	}
-	return err
-}
 
-func (p *prefixNode) Remove(network *net.IPNet) error {
-	err := p.removeNetwork(NewIPNetwork(network))
-	if err != nil {
-		return err
+	if common == bits && bits < n.bits {
+		newParent := &node{addr: maskAddr(addr, bits), bits: bits, present: true}
+		if getBit(n.addr, bits) == 0 {
+			newParent.left = n
+		} else {
+			newParent.right = n
+		}
+		return newParent, true
 	}
-	atomic.AddInt32(&p.nodeCount, -1)
-	return nil
-}
 
-func (p *prefixNode) Contains(ip net.IP) bool {
-	ipa := NewIPAddress(ip)
-	if ipa == nil {
-		return false
+	branch := &node{addr: maskAddr(addr, common), bits: common}
+	leaf := &node{addr: maskAddr(addr, bits), bits: bits, present: true}
+	if getBit(addr, common) == 0 {
+		branch.left, branch.right = leaf, n
+	} else {
+		branch.left, branch.right = n, leaf
 	}
-	return p.containsAddress(ipa)
-}
-
-func (p *prefixNode) Size() int32 {
-	return p.nodeCount
+	return branch, true
 }
 
-func (p *prefixNode) String() string {
-	children := []string{}
-	level := 0
-	for parent := p.parent; parent != nil; parent = parent.parent {
-		level++
+// removeNode clears the present flag on the node matching (addr, bits) and collapses any
+// internal node left with a single child back into a compressed edge. A target that isn't
+// present is a no-op, not an error, matching how a firewall rule removal behaves when the
+// rule was already gone.
+func removeNode(n *node, addr [16]byte, bits int) (*node, bool) {
+	if n == nil {
+		return nil, false
 	}
-	padding := strings.Repeat("| ", level+1)
-	for bits, child := range p.children {
-		if child == nil {
-			continue
+
+	if n.bits == bits {
+		if !bitsEqual(n.addr, addr, bits) || !n.present {
+			return n, false
+		}
+		switch {
+		case n.left == nil && n.right == nil:
+			return nil, true
+		case n.left != nil && n.right == nil:
+			return n.left, true
+		case n.left == nil && n.right != nil:
+			return n.right, true
+		default:
+			newNode := *n
+			newNode.present = false
+			return &newNode, true
 		}
-		childStr := fmt.Sprintf("\n%s%d--> %s", padding, bits, child.String())
-		children = append(children, childStr)
 	}
-	return fmt.Sprintf("%s (target pos:%d, is_leaf:%t, mask:%d)%s", p.network.CIDR.IP.String(),
-		p.getTargetBitPos(), p.isLeaf, p.network.PrefixLen, strings.Join(children, ""))
-}
 
-func (p *prefixNode) containsAddress(number IPAddress) bool {
-	if !p.network.Contains(number) {
-		return false
-	}
-	if p.isLeaf {
-		return true
-	}
-	targetPos := p.getTargetBitPos()
-	if targetPos < 0 {
-		return false
+	if n.bits > bits || !prefixMatches(n.addr, n.bits, addr) {
+		return n, false
 	}
-	bit, err := number.Bit(uint(targetPos))
-	if err != nil {
-		return false
+
+	newNode := *n
+	var removed bool
+	if getBit(addr, n.bits) == 0 {
+		newNode.left, removed = removeNode(n.left, addr, bits)
+	} else {
+		newNode.right, removed = removeNode(n.right, addr, bits)
 	}
-	child := p.children[bit]
-	if child == nil {
-		return false
+	if !removed {
+		return n, false
 	}
-	return child.containsAddress(number)
-}
 
-func (p *prefixNode) insertNetwork(network IPNetwork) (bool, error) {
-	current := p
-
-	for {
-		if current.network.Equal(network) {
-			if current.isLeaf {
-				return false, nil
-			}
-			current.isLeaf = true
-			return true, nil
-		}
-
-		bit, err := current.getBitFromAddress(network.Address)
-		if err != nil {
-			return false, err
+	if !newNode.present {
+		switch {
+		case newNode.left != nil && newNode.right == nil:
+			return newNode.left, true
+		case newNode.right != nil && newNode.left == nil:
+			return newNode.right, true
+		case newNode.left == nil && newNode.right == nil:
+			return nil, true
 		}
+	}
+	return &newNode, true
+}
 
-		child := current.children[bit]
-		if child == nil {
-			current.children[bit] = newLeafNode(network)
-			current.children[bit].parent = current
-			return true, nil
+// longestMatch walks from the root following the bits of addr, remembering the most specific
+// present node seen so far.
+func longestMatch(n *node, addr [16]byte) (*node, bool) {
+	var best *node
+	for n != nil {
+		if !prefixMatches(n.addr, n.bits, addr) {
+			break
 		}
-
-		lcb, err := network.LeastCommonBitPosition(child.network)
-		if err != nil {
-			return false, err
+		if n.present {
+			best = n
 		}
-		divergingBitPos := int(lcb) - 1
-		if divergingBitPos <= child.getTargetBitPos() {
-			current = child
-			continue
+		if n.bits >= unifiedBits {
+			break
 		}
-		pathNode := newPathNode(network, current.getTotalBits()-lcb)
-		if err := current.insertPrefix(bit, pathNode, child); err != nil {
-			return false, err
+		if getBit(addr, n.bits) == 0 {
+			n = n.left
+		} else {
+			n = n.right
 		}
-		current = pathNode
 	}
-}
-
-func (p *prefixNode) insertPrefix(bit uint32, pathPrefix, child *prefixNode) error {
-	p.children[bit] = pathPrefix
-	pathPrefix.parent = p
-
-	pathPrefixBit, err := pathPrefix.getBitFromAddress(child.network.Address)
-	if err != nil {
-		return err
+	if best == nil {
+		return nil, false
 	}
-	pathPrefix.children[pathPrefixBit] = child
-	child.parent = pathPrefix
-	return nil
+	return best, true
 }
 
-func (p *prefixNode) removeNetwork(network IPNetwork) error {
-	if p.isLeaf && p.network.Equal(network) {
-		p.isLeaf = false
-		return p.compressPath()
-	}
-
-	if p.getTargetBitPos() < 0 {
-		return nil
+func walk(n *node, fn func(netip.Prefix) bool) bool {
+	if n == nil {
+		return true
 	}
-
-	bit, err := p.getBitFromAddress(network.Address)
-	if err != nil {
-		return err
+	if n.present && !fn(unifiedToPrefix(n.addr, n.bits)) {
+		return false
 	}
-	child := p.children[bit]
-	if child != nil {
-		return child.removeNetwork(network)
+	if !walk(n.left, fn) {
+		return false
 	}
-	return nil
-}
-
-func (p *prefixNode) canCompressPath() bool {
-	return !p.isLeaf && p.getChildCount() <= 1 && p.parent != nil
+	return walk(n.right, fn)
 }
 
-func (p *prefixNode) compressPath() error {
-	if !p.canCompressPath() {
-		return nil
+func min(a, b int) int {
+	if a < b {
+		return a
 	}
+	return b
+}
 
-	var loneChild *prefixNode
-	for _, child := range p.children {
-		if child != nil {
-			loneChild = child
-			break
-		}
+// parsePrefix parses a bare address (treated as a host /32 or /128 prefix) or CIDR string.
+func parsePrefix(s string) (netip.Prefix, bool) {
+	ipNet := parseIPAddrToIPNet(s)
+	if ipNet == nil {
+		return netip.Prefix{}, false
 	}
-	if loneChild == nil {
-		if p.parent != nil {
-			for i, child := range p.parent.children {
-				if child == p {
-					p.parent.children[i] = nil
-					break
-				}
-			}
-		}
-		return nil
+	addr, ok := netipAddrFromIP(ipNet.IP)
+	if !ok {
+		return netip.Prefix{}, false
 	}
+	ones, _ := ipNet.Mask.Size()
+	return netip.PrefixFrom(addr, ones), true
+}
 
-	parent := p.parent
-	for ; parent.canCompressPath(); parent = parent.parent {
+func parseAddr(s string) (netip.Addr, bool) {
+	ipNet := parseIPAddrToIPNet(s)
+	if ipNet == nil {
+		return netip.Addr{}, false
 	}
+	return netipAddrFromIP(ipNet.IP)
+}
 
-	parentBit, err := parent.getBitFromAddress(p.network.Address)
-	if err != nil {
-		return err
+func netipAddrFromIP(ip net.IP) (netip.Addr, bool) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return netip.AddrFromSlice(ip4)
 	}
-
-	parent.children[parentBit] = loneChild
-	loneChild.parent = parent
-
-	return parent.compressPath()
+	return netip.AddrFromSlice(ip.To16())
 }
 
-func (p *prefixNode) getChildCount() int {
-	count := 0
-	for _, child := range p.children {
-		if child != nil {
-			count++
+// parseIPAddrToIPNet parses a bare IP (defaulted to a host prefix) or CIDR string, rejecting
+// anything net.ParseCIDR/net.ParseIP itself would reject (zones, malformed octets, ...).
+func parseIPAddrToIPNet(addr string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(addr)
+	if err != nil {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil
+		}
+		if ip.To4() != nil {
+			ipNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}
+		} else {
+			ipNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
 		}
 	}
-	return count
-}
-
-func (p *prefixNode) getTotalBits() uint {
-	return BitsPerWord * uint(len(p.network.Address))
-}
-
-func (p *prefixNode) getTargetBitPos() int {
-	return int(p.getTotalBits()) - int(p.skipBits) - 1
-}
-
-func (p *prefixNode) getBitFromAddress(n IPAddress) (uint32, error) {
-	return n.Bit(uint(p.getTargetBitPos()))
+	return ipNet
 }
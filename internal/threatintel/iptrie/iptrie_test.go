@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"net/netip"
 	"sync"
 	"testing"
 )
@@ -347,6 +348,73 @@ func TestIPTrie_EdgeCases(t *testing.T) {
 		})
 	}
 }
+
+// TestIPTrie_IPv6EdgeCases exercises the unified-bit-space conversion in network.go against the
+// v6 shapes that are easy to get wrong when folding v4 and v6 into one 128-bit trie: a default
+// route, a prefix shorter than the /96 v4-in-v6 offset, a v4-mapped literal, and a prefix with
+// host bits set outside its own mask.
+func TestIPTrie_IPv6EdgeCases(t *testing.T) {
+	tests := []struct {
+		name     string
+		inserts  []string
+		queries  []string
+		expected []bool
+	}{
+		{
+			name:     "default route matches everything",
+			inserts:  []string{"::/0"},
+			queries:  []string{"::1", "2001:db8::1", "fe80::1"},
+			expected: []bool{true, true, true},
+		},
+		{
+			// Because v4 addresses live inside the unified space at ::ffff:0:0/96, a v6 ::/0
+			// (0 unified bits) covers them too - this is the unified-trie design working as
+			// documented, not a leak, so a feed that needs v6-only coverage must say so with an
+			// explicit prefix rather than relying on ::/0.
+			name:     "default route also covers the v4-mapped subspace",
+			inserts:  []string{"::/0"},
+			queries:  []string{"192.168.1.1", "10.0.0.1"},
+			expected: []bool{true, true},
+		},
+		{
+			name:     "prefix shorter than the v4-in-v6 offset",
+			inserts:  []string{"2001:db8::/32"},
+			queries:  []string{"2001:db8::1", "2001:db8:ffff::1", "2001:db9::1"},
+			expected: []bool{true, true, false},
+		},
+		{
+			name:     "v4-mapped literal is treated as the plain v4 address",
+			inserts:  []string{"1.2.3.0/24"},
+			queries:  []string{"::ffff:1.2.3.4", "1.2.3.4", "::ffff:1.2.4.4"},
+			expected: []bool{true, true, false},
+		},
+		{
+			name:     "host bits set outside the mask are ignored on insert",
+			inserts:  []string{"2001:db8::1/32"},
+			queries:  []string{"2001:db8::1", "2001:db8:ffff::2", "2001:db9::1"},
+			expected: []bool{true, true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trie := NewIPTrie()
+			for _, insert := range tt.inserts {
+				if err := trie.Insert(insert); err != nil {
+					t.Fatalf("Insert(%s) failed: %v", insert, err)
+				}
+			}
+
+			for i, query := range tt.queries {
+				got := trie.Contains(query)
+				if got != tt.expected[i] {
+					t.Errorf("Contains(%s) = %v, want %v", query, got, tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
 func TestIPTrie_Concurrency(t *testing.T) {
 	trie := NewIPTrie()
 	const (
@@ -528,3 +596,35 @@ func BenchmarkIpTrieQuery(b *testing.B) {
 		trie.Contains(queryIPs[i])
 	}
 }
+
+// BenchmarkIpTrieQueryAddr is BenchmarkIpTrieQuery's ContainsAddr counterpart: addresses are
+// parsed once up front, so the loop under measurement does no string parsing and should show
+// zero allocations, unlike BenchmarkIpTrieQuery which reparses queryIPs[i] on every call.
+func BenchmarkIpTrieQueryAddr(b *testing.B) {
+	r := rand.New(rand.NewSource(1234))
+
+	const baseDataSize = 1000000
+	trie := NewIPTrie()
+	ips, cidrs := generateTestData(r, baseDataSize/2, baseDataSize/2)
+
+	for i := 0; i < baseDataSize; i++ {
+		if i < len(ips) {
+			trie.Insert(ips[i])
+		} else {
+			trie.Insert(cidrs[i-len(ips)])
+		}
+	}
+
+	rawQueryIPs, _ := generateTestData(r, b.N, 0)
+	queryAddrs := make([]netip.Addr, b.N)
+	for i, raw := range rawQueryIPs {
+		queryAddrs[i] = netip.MustParseAddr(raw)
+	}
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		trie.ContainsAddr(queryAddrs[i])
+	}
+}
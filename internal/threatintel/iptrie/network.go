@@ -1,131 +1,83 @@
-package iptrie
-
-import (
-	"bytes"
-	"encoding/binary"
-	"fmt"
-	"math"
-	"net"
-)
-
-type IPAddress []uint32
-
-const BitsPerWord = 32
-
-func NewIPAddress(ip net.IP) IPAddress {
-	if ip == nil {
-		return nil
-	}
-	coercedIP := ip.To4()
-	parts := 1
-	if coercedIP == nil {
-		coercedIP = ip.To16()
-		parts = 4
-	}
-	if coercedIP == nil {
-		return nil
-	}
-	addr := make(IPAddress, parts)
-	for i := 0; i < parts; i++ {
-		idx := i * net.IPv4len
-		addr[i] = binary.BigEndian.Uint32(coercedIP[idx : idx+net.IPv4len])
-	}
-	return addr
-}
-
-func (n IPAddress) Equal(n1 IPAddress) bool {
-	if len(n) != len(n1) {
-		return false
-	}
-	if len(n) == 1 {
-		return n[0] == n1[0]
-	}
-	return n[0] == n1[0] && n[1] == n1[1] &&
-		n[2] == n1[2] && n[3] == n1[3]
-}
-
-func (n IPAddress) Bit(position uint) (uint32, error) {
-	wordIdx := len(n) - 1 - int(position>>5)
-	if wordIdx < 0 || wordIdx >= len(n) {
-		return 0, fmt.Errorf("bit position not valid")
-	}
-	return (n[wordIdx] >> (position & 31)) & 1, nil
-}
-
-func (n IPAddress) LeastCommonBitPosition(n1 IPAddress) (uint, error) {
-	if len(n) != len(n1) {
-		return 0, fmt.Errorf("network input version mismatch")
-	}
-	for i := 0; i < len(n); i++ {
-		mask := uint32(1) << 31
-		pos := uint(31)
-		for ; mask > 0; mask >>= 1 {
-			if n[i]&mask != n1[i]&mask {
-				if i == 0 && pos == 31 {
-					return 0, fmt.Errorf("no greatest common bit")
-				}
-				return (pos + 1) + uint(BitsPerWord)*uint(len(n)-i-1), nil
-			}
-			pos--
-		}
-	}
-	return 0, nil
-}
-
-type IPNetwork struct {
-	CIDR      *net.IPNet
-	Address   IPAddress
-	Netmask   IPAddress
-	PrefixLen int
-}
-
-func NewIPNetwork(ipNet *net.IPNet) IPNetwork {
-	ones, _ := ipNet.Mask.Size()
-	return IPNetwork{
-		CIDR:      ipNet,
-		Address:   NewIPAddress(ipNet.IP),
-		Netmask:   IPAddress(NewIPAddress(net.IP(ipNet.Mask))),
-		PrefixLen: ones,
-	}
-}
-
-func (n IPNetwork) Masked(ones int) IPNetwork {
-	mask := net.CIDRMask(ones, len(n.Address)*BitsPerWord)
-
-	return NewIPNetwork(&net.IPNet{
-		IP:   n.CIDR.IP.Mask(mask),
-		Mask: mask,
-	})
-}
-
-func (n IPNetwork) Contains(nn IPAddress) bool {
-	if len(n.Netmask) != len(nn) {
-		return false
-	}
-	if (nn[0] & n.Netmask[0]) != n.Address[0] {
-		return false
-	}
-	if len(nn) == 4 {
-		return (nn[1]&n.Netmask[1]) == n.Address[1] &&
-			(nn[2]&n.Netmask[2]) == n.Address[2] &&
-			(nn[3]&n.Netmask[3]) == n.Address[3]
-	}
-	return true
-}
-
-func (n IPNetwork) LeastCommonBitPosition(n1 IPNetwork) (uint, error) {
-	maskSize := n.PrefixLen
-	if n1.PrefixLen < maskSize {
-		maskSize = n1.PrefixLen
-	}
-	maskPosition := len(n1.Address)*BitsPerWord - maskSize
-	lcb, err := n.Address.LeastCommonBitPosition(n1.Address)
-	if err != nil {
-		return 0, err
-	}
-	return uint(math.Max(float64(maskPosition), float64(lcb))), nil
-}
-
-func (n IPNetwork) Equal(n1 IPNetwork) bool {
-	return n.CIDR.IP.Equal(n1.CIDR.IP) && bytes.Equal(n.CIDR.Mask, n1.CIDR.Mask)
-}
+package iptrie
+
+import "net/netip"
+
+// unifiedBits is the width of the bit space all prefixes are compared in. IPv4 addresses are
+// folded into their IPv4-in-IPv6 form (netip.Addr.As16) so a single trie can hold both
+// families without dedicated v4 code paths.
+const unifiedBits = 128
+
+// v4Offset is how many leading bits of the unified 128-bit address space are fixed by the
+// ::ffff:0:0/96 prefix that every IPv4-mapped address shares.
+const v4Offset = 96
+
+func addrToUnified(addr netip.Addr) [16]byte {
+	return addr.As16()
+}
+
+// prefixToUnified converts a prefix into its masked 128-bit representation plus the number of
+// significant bits in that unified space (an IPv4 /8 becomes a 104-bit unified prefix).
+func prefixToUnified(prefix netip.Prefix) ([16]byte, int) {
+	bits := prefix.Bits()
+	if prefix.Addr().Is4() {
+		bits += v4Offset
+	}
+	return maskAddr(addrToUnified(prefix.Addr()), bits), bits
+}
+
+// unifiedToPrefix is the inverse of prefixToUnified: given a masked address and its unified
+// bit length, it reconstructs the original-family netip.Prefix.
+func unifiedToPrefix(addr [16]byte, bits int) netip.Prefix {
+	full := netip.AddrFrom16(addr)
+	if full.Is4In6() {
+		return netip.PrefixFrom(full.Unmap(), bits-v4Offset)
+	}
+	return netip.PrefixFrom(full, bits)
+}
+
+func getBit(addr [16]byte, pos int) int {
+	return int((addr[pos/8] >> uint(7-pos%8)) & 1)
+}
+
+// maskAddr zeroes every bit beyond the first `bits` bits.
+func maskAddr(addr [16]byte, bits int) [16]byte {
+	var out [16]byte
+	fullBytes := bits / 8
+	copy(out[:fullBytes], addr[:fullBytes])
+	if rem := bits % 8; rem > 0 && fullBytes < 16 {
+		out[fullBytes] = addr[fullBytes] & (0xFF << uint(8-rem))
+	}
+	return out
+}
+
+func bitsEqual(a, b [16]byte, bits int) bool {
+	return maskAddr(a, bits) == maskAddr(b, bits)
+}
+
+// prefixMatches reports whether addr falls under the prefix described by (nodeAddr, nodeBits).
+func prefixMatches(nodeAddr [16]byte, nodeBits int, addr [16]byte) bool {
+	return maskAddr(addr, nodeBits) == nodeAddr
+}
+
+// commonBits returns the number of leading bits shared by a and b, capped at max.
+func commonBits(a, b [16]byte, max int) int {
+	count := 0
+	for i := 0; i < 16 && count < max; i++ {
+		if a[i] == b[i] {
+			count += 8
+			continue
+		}
+		diff := a[i] ^ b[i]
+		for bit := 0; bit < 8; bit++ {
+			if diff&(0x80>>uint(bit)) != 0 {
+				count += bit
+				break
+			}
+		}
+		break
+	}
+	if count > max {
+		count = max
+	}
+	return count
+}
@@ -0,0 +1,375 @@
+package iptrie
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Entry is a typical Tree value: enough metadata to explain why a CIDR is present and to
+// attribute it to whichever feed contributed it, e.g. for a "why was this IP blocked" view.
+type Entry struct {
+	Source     string `json:"source"`
+	Reason     string `json:"reason"`
+	InsertedAt int64  `json:"inserted_at"`
+	ExpireAt   int64  `json:"expire_at"` // zero means no expiry
+}
+
+// valueNode mirrors node's copy-on-write discipline (Insert/Remove build a new path of nodes
+// sharing every untouched subtree with the previous tree, so Lookup/Walk stay lock-free for
+// readers) but carries a value per source instead of a bare presence flag, so a CIDR contributed
+// by more than one source survives either source's removal alone.
+type valueNode[T any] struct {
+	left, right *valueNode[T]
+	addr        [16]byte
+	bits        int
+	values      map[string]T // keyed by source; a non-empty map means this CIDR is present
+}
+
+// Tree is a level-compressed (PATRICIA-style) binary radix trie keyed by CIDR, generalizing
+// IPTrie's bare presence flag into an arbitrary value of type T per (CIDR, source) pair - e.g.
+// an Entry recording which threat-intel feed contributed an indicator, when, and for how long.
+// IPTrie itself is left as the dedicated membership-only structure for the per-packet hot path;
+// Tree is the building block for features that need to explain or attribute a match instead of
+// just testing for one.
+type Tree[T any] struct {
+	root  atomic.Pointer[valueNode[T]]
+	count atomic.Int32
+	mu    sync.Mutex // serializes writers; readers never take this lock
+}
+
+// NewTree creates an empty Tree ready to accept inserts.
+func NewTree[T any]() *Tree[T] {
+	return &Tree[T]{}
+}
+
+// defaultSource is the key used by the single-source convenience methods (Insert, Remove, ...)
+// for callers that don't need per-source provenance.
+const defaultSource = ""
+
+// Insert parses cidr (a bare IP or CIDR string) and associates v with it. Equivalent to
+// InsertFrom(cidr, "", v); use InsertFrom directly when more than one source may contribute the
+// same CIDR and each needs to be removable independently.
+func (t *Tree[T]) Insert(cidr string, v T) error {
+	return t.InsertFrom(cidr, defaultSource, v)
+}
+
+// InsertFrom parses cidr and associates v with it under source. A later RemoveFrom(cidr, source)
+// retracts only this source's contribution - any value the same CIDR holds under a different
+// source is untouched, which is what makes Remove source-aware.
+func (t *Tree[T]) InsertFrom(cidr string, source string, v T) error {
+	prefix, ok := parsePrefix(cidr)
+	if !ok {
+		return fmt.Errorf("invalid IP or CIDR: %s", cidr)
+	}
+	return t.InsertAddrFrom(prefix, source, v)
+}
+
+// InsertAddr is the netip.Prefix equivalent of Insert, for callers on a path that already has a
+// parsed prefix and wants to avoid re-parsing it.
+func (t *Tree[T]) InsertAddr(prefix netip.Prefix, v T) error {
+	return t.InsertAddrFrom(prefix, defaultSource, v)
+}
+
+// InsertAddrFrom is the netip.Prefix equivalent of InsertFrom.
+func (t *Tree[T]) InsertAddrFrom(prefix netip.Prefix, source string, v T) error {
+	unified, bits := prefixToUnified(prefix)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	newRoot, added := insertValue(t.root.Load(), unified, bits, source, v)
+	t.root.Store(newRoot)
+	if added {
+		t.count.Add(1)
+	}
+	return nil
+}
+
+// LookupLongestPrefix parses ip and returns the value held by the most specific inserted CIDR
+// that covers it. If more than one source contributed a value at that exact CIDR, the value from
+// the lexicographically lowest source name wins, for a deterministic result.
+func (t *Tree[T]) LookupLongestPrefix(ip string) (T, bool) {
+	addr, ok := parseAddr(ip)
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return t.LookupAddr(addr)
+}
+
+// LookupAddr is the netip.Addr equivalent of LookupLongestPrefix.
+func (t *Tree[T]) LookupAddr(addr netip.Addr) (T, bool) {
+	n, found := longestValueMatch(t.root.Load(), addrToUnified(addr))
+	if !found {
+		var zero T
+		return zero, false
+	}
+	return pickValue(n.values), true
+}
+
+// Walk calls fn for every (CIDR, value) pair currently present, stopping early if fn returns
+// false. A CIDR held under more than one source is walked once per source, in sorted source
+// order.
+func (t *Tree[T]) Walk(fn func(netip.Prefix, T) bool) {
+	walkValues(t.root.Load(), fn)
+}
+
+// SourceMatch pairs a Tree value with the source that contributed it, returned by
+// MatchingSources for a caller that needs every source covering an address rather than just the
+// single value LookupAddr picks among them.
+type SourceMatch[T any] struct {
+	Source string
+	Value  T
+}
+
+// MatchingSources returns every (source, value) pair from every present ancestor covering addr,
+// walked in one pass from the root down to the longest match - e.g. so Aggregator.Explain can
+// attribute a match to every feed that contributed a covering CIDR without a separate trie per
+// feed. Entries are grouped by prefix specificity (root to leaf) and, within a prefix, sorted by
+// source name for a deterministic result.
+func (t *Tree[T]) MatchingSources(addr netip.Addr) []SourceMatch[T] {
+	var matches []SourceMatch[T]
+	unified := addrToUnified(addr)
+	n := t.root.Load()
+	for n != nil {
+		if !prefixMatches(n.addr, n.bits, unified) {
+			break
+		}
+		if len(n.values) > 0 {
+			sources := make([]string, 0, len(n.values))
+			for source := range n.values {
+				sources = append(sources, source)
+			}
+			sort.Strings(sources)
+			for _, source := range sources {
+				matches = append(matches, SourceMatch[T]{Source: source, Value: n.values[source]})
+			}
+		}
+		if n.bits >= unifiedBits {
+			break
+		}
+		if getBit(unified, n.bits) == 0 {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return matches
+}
+
+// Remove parses cidr and removes it. Equivalent to RemoveFrom(cidr, "", ...).
+func (t *Tree[T]) Remove(cidr string) error {
+	return t.RemoveFrom(cidr, defaultSource)
+}
+
+// RemoveFrom parses cidr and retracts only source's contribution to it. Removing a (cidr,
+// source) pair that was never inserted, or that belongs to a different source, is a no-op, not
+// an error.
+func (t *Tree[T]) RemoveFrom(cidr string, source string) error {
+	prefix, ok := parsePrefix(cidr)
+	if !ok {
+		return fmt.Errorf("invalid IP or CIDR: %s", cidr)
+	}
+	return t.RemoveAddrFrom(prefix, source)
+}
+
+// RemoveAddr is the netip.Prefix equivalent of Remove.
+func (t *Tree[T]) RemoveAddr(prefix netip.Prefix) error {
+	return t.RemoveAddrFrom(prefix, defaultSource)
+}
+
+// RemoveAddrFrom is the netip.Prefix equivalent of RemoveFrom.
+func (t *Tree[T]) RemoveAddrFrom(prefix netip.Prefix, source string) error {
+	unified, bits := prefixToUnified(prefix)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	newRoot, removed := removeValue(t.root.Load(), unified, bits, source)
+	if removed {
+		t.root.Store(newRoot)
+		t.count.Add(-1)
+	}
+	return nil
+}
+
+// Size returns the number of distinct (CIDR, source) pairs currently present.
+func (t *Tree[T]) Size() int32 {
+	return t.count.Load()
+}
+
+// pickValue returns the value for the lexicographically lowest source key, so concurrent
+// sources contributing the same CIDR still produce a deterministic LookupAddr result.
+func pickValue[T any](values map[string]T) T {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return values[keys[0]]
+}
+
+func insertValue[T any](n *valueNode[T], addr [16]byte, bits int, source string, v T) (*valueNode[T], bool) {
+	if n == nil {
+		return &valueNode[T]{addr: maskAddr(addr, bits), bits: bits, values: map[string]T{source: v}}, true
+	}
+
+	common := commonBits(n.addr, addr, min(n.bits, bits))
+
+	if common == n.bits && n.bits == bits {
+		_, existed := n.values[source]
+		newNode := *n
+		newNode.values = copyValues(n.values)
+		newNode.values[source] = v
+		return &newNode, !existed
+	}
+
+	if common == n.bits && bits > n.bits {
+		newNode := *n
+		if getBit(addr, n.bits) == 0 {
+			child, added := insertValue(n.left, addr, bits, source, v)
+			newNode.left = child
+			return &newNode, added
+		}
+		child, added := insertValue(n.right, addr, bits, source, v)
+		newNode.right = child
+		return &newNode, added
+	}
+
+	if common == bits && bits < n.bits {
+		newParent := &valueNode[T]{addr: maskAddr(addr, bits), bits: bits, values: map[string]T{source: v}}
+		if getBit(n.addr, bits) == 0 {
+			newParent.left = n
+		} else {
+			newParent.right = n
+		}
+		return newParent, true
+	}
+
+	branch := &valueNode[T]{addr: maskAddr(addr, common), bits: common}
+	leaf := &valueNode[T]{addr: maskAddr(addr, bits), bits: bits, values: map[string]T{source: v}}
+	if getBit(addr, common) == 0 {
+		branch.left, branch.right = leaf, n
+	} else {
+		branch.left, branch.right = n, leaf
+	}
+	return branch, true
+}
+
+// removeValue clears source's value on the node matching (addr, bits), collapsing an internal
+// node left with no values and a single child back into a compressed edge - mirroring
+// removeNode, but a node with other sources' values still present stays present.
+func removeValue[T any](n *valueNode[T], addr [16]byte, bits int, source string) (*valueNode[T], bool) {
+	if n == nil {
+		return nil, false
+	}
+
+	if n.bits == bits {
+		if !bitsEqual(n.addr, addr, bits) {
+			return n, false
+		}
+		if _, ok := n.values[source]; !ok {
+			return n, false
+		}
+		newNode := *n
+		newNode.values = copyValues(n.values)
+		delete(newNode.values, source)
+		if len(newNode.values) > 0 {
+			return &newNode, true
+		}
+		switch {
+		case newNode.left == nil && newNode.right == nil:
+			return nil, true
+		case newNode.left != nil && newNode.right == nil:
+			return newNode.left, true
+		case newNode.left == nil && newNode.right != nil:
+			return newNode.right, true
+		default:
+			newNode.values = nil
+			return &newNode, true
+		}
+	}
+
+	if n.bits > bits || !prefixMatches(n.addr, n.bits, addr) {
+		return n, false
+	}
+
+	newNode := *n
+	var removed bool
+	if getBit(addr, n.bits) == 0 {
+		newNode.left, removed = removeValue(n.left, addr, bits, source)
+	} else {
+		newNode.right, removed = removeValue(n.right, addr, bits, source)
+	}
+	if !removed {
+		return n, false
+	}
+
+	if len(newNode.values) == 0 {
+		switch {
+		case newNode.left != nil && newNode.right == nil:
+			return newNode.left, true
+		case newNode.right != nil && newNode.left == nil:
+			return newNode.right, true
+		case newNode.left == nil && newNode.right == nil:
+			return nil, true
+		}
+	}
+	return &newNode, true
+}
+
+func longestValueMatch[T any](n *valueNode[T], addr [16]byte) (*valueNode[T], bool) {
+	var best *valueNode[T]
+	for n != nil {
+		if !prefixMatches(n.addr, n.bits, addr) {
+			break
+		}
+		if len(n.values) > 0 {
+			best = n
+		}
+		if n.bits >= unifiedBits {
+			break
+		}
+		if getBit(addr, n.bits) == 0 {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+	return best, true
+}
+
+func walkValues[T any](n *valueNode[T], fn func(netip.Prefix, T) bool) bool {
+	if n == nil {
+		return true
+	}
+	if len(n.values) > 0 {
+		sources := make([]string, 0, len(n.values))
+		for source := range n.values {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+		prefix := unifiedToPrefix(n.addr, n.bits)
+		for _, source := range sources {
+			if !fn(prefix, n.values[source]) {
+				return false
+			}
+		}
+	}
+	if !walkValues(n.left, fn) {
+		return false
+	}
+	return walkValues(n.right, fn)
+}
+
+func copyValues[T any](values map[string]T) map[string]T {
+	out := make(map[string]T, len(values)+1)
+	for k, v := range values {
+		out[k] = v
+	}
+	return out
+}
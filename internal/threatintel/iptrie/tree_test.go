@@ -0,0 +1,82 @@
+package iptrie
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestTree_LookupLongestPrefix(t *testing.T) {
+	tree := NewTree[string]()
+	if err := tree.Insert("10.0.0.0/8", "broad"); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := tree.Insert("10.1.0.0/16", "narrow"); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	tests := []struct {
+		ip     string
+		want   string
+		wantOk bool
+	}{
+		{ip: "10.1.2.3", want: "narrow", wantOk: true},
+		{ip: "10.2.0.0", want: "broad", wantOk: true},
+		{ip: "192.168.1.1", want: "", wantOk: false},
+	}
+	for _, tt := range tests {
+		got, ok := tree.LookupLongestPrefix(tt.ip)
+		if ok != tt.wantOk || got != tt.want {
+			t.Errorf("LookupLongestPrefix(%s) = (%q, %v), want (%q, %v)", tt.ip, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestTree_SourceAwareRemove(t *testing.T) {
+	tree := NewTree[Entry]()
+	if err := tree.InsertFrom("1.2.3.0/24", "spamhaus", Entry{Source: "spamhaus", Reason: "drop list"}); err != nil {
+		t.Fatalf("InsertFrom failed: %v", err)
+	}
+	if err := tree.InsertFrom("1.2.3.0/24", "firehol", Entry{Source: "firehol", Reason: "level1"}); err != nil {
+		t.Fatalf("InsertFrom failed: %v", err)
+	}
+
+	if _, ok := tree.LookupLongestPrefix("1.2.3.4"); !ok {
+		t.Fatal("expected CIDR to be present after both sources inserted it")
+	}
+
+	if err := tree.RemoveFrom("1.2.3.0/24", "spamhaus"); err != nil {
+		t.Fatalf("RemoveFrom failed: %v", err)
+	}
+	entry, ok := tree.LookupLongestPrefix("1.2.3.4")
+	if !ok {
+		t.Fatal("expected CIDR to still be present after removing only one source")
+	}
+	if entry.Source != "firehol" {
+		t.Errorf("expected remaining entry to belong to firehol, got %q", entry.Source)
+	}
+
+	if err := tree.RemoveFrom("1.2.3.0/24", "firehol"); err != nil {
+		t.Fatalf("RemoveFrom failed: %v", err)
+	}
+	if _, ok := tree.LookupLongestPrefix("1.2.3.4"); ok {
+		t.Fatal("expected CIDR to be gone once every source removed it")
+	}
+}
+
+func TestTree_Walk(t *testing.T) {
+	tree := NewTree[int]()
+	tree.Insert("10.0.0.0/8", 1)
+	tree.Insert("192.168.0.0/16", 2)
+
+	seen := make(map[string]int)
+	tree.Walk(func(prefix netip.Prefix, v int) bool {
+		seen[prefix.String()] = v
+		return true
+	})
+	if len(seen) != 2 {
+		t.Fatalf("expected 2 entries, got %d: %v", len(seen), seen)
+	}
+	if seen["10.0.0.0/8"] != 1 || seen["192.168.0.0/16"] != 2 {
+		t.Errorf("unexpected walk results: %v", seen)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/netip"
 	"strings"
 )
 
@@ -55,7 +56,7 @@ func (a *AbuseIPDB) DefaultParams() map[string]string {
 	}
 }
 
-func (a *AbuseIPDB) Fetch(params map[string]string) ([]string, error) {
+func (a *AbuseIPDB) Fetch(params map[string]string) ([]netip.Prefix, error) {
 	baseURL := params["baseURL"]
 	if baseURL == "" {
 		baseURL = defaultBaseURL
@@ -65,7 +66,7 @@ func (a *AbuseIPDB) Fetch(params map[string]string) ([]string, error) {
 	if len(sources) == 0 {
 		return nil, fmt.Errorf("source is required")
 	}
-	results := make([]string, 0)
+	results := make([]netip.Prefix, 0)
 	errs := make([]error, 0)
 	for _, source := range sources {
 		requestURL := ""
@@ -92,7 +93,9 @@ func (a *AbuseIPDB) Fetch(params map[string]string) ([]string, error) {
 			if line == "" || strings.HasPrefix(line, "#") {
 				continue
 			}
-			results = append(results, line)
+			if prefix, ok := ParseIndicator(line); ok {
+				results = append(results, prefix)
+			}
 		}
 	}
 	if len(results) > 0 {
@@ -100,3 +103,7 @@ func (a *AbuseIPDB) Fetch(params map[string]string) ([]string, error) {
 	}
 	return nil, errors.Join(errs...)
 }
+
+func init() {
+	Register(&AbuseIPDB{})
+}
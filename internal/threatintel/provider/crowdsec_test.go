@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestCrowdSec_FetchIncremental(t *testing.T) {
+	var startupSeen []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "test-key" {
+			t.Errorf("missing or wrong X-Api-Key header: %q", r.Header.Get("X-Api-Key"))
+		}
+		startupSeen = append(startupSeen, r.URL.Query().Get("startup"))
+		resp := crowdSecStreamResponse{
+			New: []crowdSecDecision{
+				{Value: "1.2.3.4", Type: "ban", Scope: "Ip", Origin: "capi"},
+				{Value: "2001:db8::/32", Type: "ban", Scope: "range", Origin: "capi"},
+				{Value: "example.com", Type: "ban", Scope: "as", Origin: "capi"},
+			},
+			Deleted: []crowdSecDecision{
+				{Value: "5.6.7.8", Type: "ban", Scope: "ip", Origin: "capi"},
+			},
+		}
+		data, _ := json.Marshal(resp)
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	c := &CrowdSec{}
+	params := c.DefaultParams()
+	params["api_url"] = server.URL
+	params["api_key"] = "test-key"
+	params["_data_dir"] = t.TempDir()
+
+	added, removed, err := c.FetchIncremental(params)
+	if err != nil {
+		t.Fatalf("FetchIncremental() error = %v", err)
+	}
+	if len(added) != 2 {
+		t.Errorf("added = %d entries, want 2 (ip+range, excluding the as-scoped decision)", len(added))
+	}
+	if len(removed) != 1 {
+		t.Errorf("removed = %d entries, want 1", len(removed))
+	}
+
+	if _, _, err := c.FetchIncremental(params); err != nil {
+		t.Fatalf("second FetchIncremental() error = %v", err)
+	}
+	if len(startupSeen) != 2 || startupSeen[0] != "true" || startupSeen[1] != "false" {
+		t.Errorf("startup query values = %v, want [true false]", startupSeen)
+	}
+}
+
+func TestCrowdSecScopeSet(t *testing.T) {
+	tests := []struct {
+		scope string
+		want  []string
+	}{
+		{"", []string{"ip", "range"}},
+		{"ip", []string{"ip"}},
+		{"ip,range", []string{"ip", "range"}},
+		{" IP , Range ", []string{"ip", "range"}},
+	}
+	for _, tt := range tests {
+		set := crowdSecScopeSet(tt.scope)
+		for _, want := range tt.want {
+			if !set[want] {
+				t.Errorf("crowdSecScopeSet(%q) missing %q", tt.scope, want)
+			}
+		}
+		if len(set) != len(tt.want) {
+			t.Errorf("crowdSecScopeSet(%q) = %v, want %v", tt.scope, set, tt.want)
+		}
+	}
+}
+
+func TestCrowdSec_cursorFile(t *testing.T) {
+	c := &CrowdSec{}
+	dir := t.TempDir()
+	got := c.cursorFile(map[string]string{"_data_dir": dir})
+	want := filepath.Join(dir, "crowdsec-cursor.txt")
+	if got != want {
+		t.Errorf("cursorFile() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+var emergingThreatsURL = "https://rules.emergingthreats.net/blockrules/compromised-ips.txt"
+
+type EmergingThreats struct{}
+
+func (e *EmergingThreats) Name() string {
+	return "emergingthreats"
+}
+
+func (e *EmergingThreats) Description() string {
+	return "Proofpoint's Emerging Threats compromised-ips feed lists hosts that are actively being used to launch attacks, observed by their sensor network."
+}
+
+func (e *EmergingThreats) Schedule() string {
+	return "30 4 * * *"
+}
+
+func (e *EmergingThreats) DefaultParams() map[string]string {
+	return map[string]string{
+		"url": emergingThreatsURL,
+	}
+}
+
+func (e *EmergingThreats) Fetch(params map[string]string) ([]netip.Prefix, error) {
+	url := params["url"]
+	if url == "" {
+		url = emergingThreatsURL
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body of %s: %v", url, err)
+	}
+	results := make([]netip.Prefix, 0)
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if prefix, ok := ParseIndicator(line); ok {
+			results = append(results, prefix)
+		}
+	}
+	return results, nil
+}
+
+func init() {
+	Register(&EmergingThreats{})
+}
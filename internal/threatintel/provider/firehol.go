@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+var fireholLevelURLs = map[string]string{
+	"1": "https://raw.githubusercontent.com/firehol/blocklist-ipsets/master/firehol_level1.netset",
+	"2": "https://raw.githubusercontent.com/firehol/blocklist-ipsets/master/firehol_level2.netset",
+	"3": "https://raw.githubusercontent.com/firehol/blocklist-ipsets/master/firehol_level3.netset",
+}
+
+type FireHOL struct{}
+
+func (f *FireHOL) Name() string {
+	return "firehol"
+}
+
+func (f *FireHOL) Description() string {
+	return "FireHOL levels 1-3 are IP blocklists of increasingly broad coverage: level1 is fullbogons, spammers and attackers with a very low false-positive rate, levels 2 and 3 add less-certain but still reputable sources."
+}
+
+func (f *FireHOL) Schedule() string {
+	return "30 3 * * *"
+}
+
+func (f *FireHOL) DefaultParams() map[string]string {
+	return map[string]string{
+		"levels": "1",
+	}
+}
+
+// Fetch pulls every level listed in params["levels"] (comma-separated, e.g. "1,2,3") and merges
+// their netsets. An unknown level is reported as an error but doesn't stop the other levels from
+// being fetched, the same partial-failure tolerance AbuseIPDB's multi-source Fetch uses.
+func (f *FireHOL) Fetch(params map[string]string) ([]netip.Prefix, error) {
+	if strings.TrimSpace(params["levels"]) == "" {
+		return nil, fmt.Errorf("levels is required")
+	}
+	levels := strings.Split(params["levels"], ",")
+	results := make([]netip.Prefix, 0)
+	errs := make([]error, 0)
+	for _, level := range levels {
+		level = strings.TrimSpace(level)
+		url, ok := fireholLevelURLs[level]
+		if !ok {
+			errs = append(errs, fmt.Errorf("invalid level: %s", level))
+			continue
+		}
+		resp, err := http.Get(url)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to fetch level %s: %v", level, err))
+			continue
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read body of level %s: %v", level, err))
+			continue
+		}
+		for _, line := range strings.Split(string(body), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if prefix, ok := ParseIndicator(line); ok {
+				results = append(results, prefix)
+			}
+		}
+	}
+	if len(results) > 0 {
+		return results, nil
+	}
+	return nil, errors.Join(errs...)
+}
+
+func init() {
+	Register(&FireHOL{})
+}
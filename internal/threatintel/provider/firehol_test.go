@@ -0,0 +1,36 @@
+package provider
+
+import "testing"
+
+func TestFireHOL_Fetch(t *testing.T) {
+	fireHOL := &FireHOL{}
+	ips, err := fireHOL.Fetch(fireHOL.DefaultParams())
+	if err != nil {
+		t.Errorf("failed to fetch: %v", err)
+	}
+	if len(ips) == 0 {
+		t.Errorf("no ips fetched")
+	} else {
+		t.Logf("fetched %d ips", len(ips))
+	}
+}
+
+func TestFireHOL_Fetch_MultipleLevels(t *testing.T) {
+	fireHOL := &FireHOL{}
+	ips, err := fireHOL.Fetch(map[string]string{"levels": "1,2"})
+	if err != nil {
+		t.Errorf("failed to fetch: %v", err)
+	}
+	if len(ips) == 0 {
+		t.Errorf("no ips fetched")
+	} else {
+		t.Logf("fetched %d ips", len(ips))
+	}
+}
+
+func TestFireHOL_Fetch_InvalidLevel(t *testing.T) {
+	fireHOL := &FireHOL{}
+	if _, err := fireHOL.Fetch(map[string]string{"levels": "9"}); err == nil {
+		t.Errorf("expected error for invalid level")
+	}
+}
@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"net/netip"
+	"sync"
+)
+
+// Provider is a pluggable threat-intelligence feed: something that can be scheduled, fetched
+// on demand, and turned into a set of IP/CIDR indicators.
+type Provider interface {
+	Name() string
+	Description() string
+	Schedule() string
+	DefaultParams() map[string]string
+	Fetch(params map[string]string) ([]netip.Prefix, error)
+}
+
+// IncrementalProvider is implemented by feeds that can report only what changed since their
+// last fetch (e.g. a streaming decisions API) instead of a full snapshot every time. The
+// aggregator prefers this over Provider.Fetch when a feed implements it, so it can apply
+// add/delete deltas to the feed's cached file and only rebuild the trie when something actually
+// changed, rather than rewriting and re-parsing the whole file on every poll.
+type IncrementalProvider interface {
+	Provider
+	FetchIncremental(params map[string]string) (added, removed []netip.Prefix, err error)
+}
+
+// ParseIndicator parses a single blocklist line - a bare IP or a CIDR - into a netip.Prefix, so
+// every provider validates and normalizes indicators the same way instead of reimplementing it.
+// A bare IP becomes a host prefix (/32 or /128). ok is false for blank lines, comments, or
+// anything else that isn't a valid indicator.
+func ParseIndicator(line string) (prefix netip.Prefix, ok bool) {
+	if p, err := netip.ParsePrefix(line); err == nil {
+		return p.Masked(), true
+	}
+	addr, err := netip.ParseAddr(line)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), true
+}
+
+// FormatIndicator renders prefix back to the bare-IP form feeds are usually distributed in
+// (no "/32" or "/128" suffix), so the on-disk feed cache and the API's display output read the
+// same way a hand-edited blocklist would.
+func FormatIndicator(prefix netip.Prefix) string {
+	if prefix.Bits() == prefix.Addr().BitLen() {
+		return prefix.Addr().String()
+	}
+	return prefix.String()
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Provider)
+)
+
+// Register adds a provider to the global registry. Concrete providers call this from an
+// init() function so the aggregator can discover them without importing each type by name.
+func Register(p Provider) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[p.Name()] = p
+}
+
+// Get looks up a registered provider by name.
+func Get(name string) (Provider, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	p, ok := registry[name]
+	return p, ok
+}
+
+// List returns every registered provider, in no particular order.
+func List() []Provider {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	providers := make([]Provider, 0, len(registry))
+	for _, p := range registry {
+		providers = append(providers, p)
+	}
+	return providers
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/netip"
 	"strings"
 )
 
@@ -33,8 +34,8 @@ func (s *Spamhaus) DefaultParams() map[string]string {
 	return map[string]string{}
 }
 
-func (s *Spamhaus) Fetch(params map[string]string) ([]string, error) {
-	results := make([]string, 0)
+func (s *Spamhaus) Fetch(params map[string]string) ([]netip.Prefix, error) {
+	results := make([]netip.Prefix, 0)
 	errs := make([]error, 0)
 	for _, url := range dropURLs {
 		resp, err := http.Get(url)
@@ -54,8 +55,10 @@ func (s *Spamhaus) Fetch(params map[string]string) ([]string, error) {
 			if line == "" || strings.HasPrefix(line, ";") {
 				continue
 			}
-			ip := strings.Split(line, ";")[0]
-			results = append(results, ip)
+			ip := strings.TrimSpace(strings.Split(line, ";")[0])
+			if prefix, ok := ParseIndicator(ip); ok {
+				results = append(results, prefix)
+			}
 		}
 	}
 	if len(results) > 0 {
@@ -63,3 +66,7 @@ func (s *Spamhaus) Fetch(params map[string]string) ([]string, error) {
 	}
 	return nil, errors.Join(errs...)
 }
+
+func init() {
+	Register(&Spamhaus{})
+}
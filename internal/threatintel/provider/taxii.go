@@ -0,0 +1,291 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const taxiiMediaType = "application/taxii+json;version=2.1"
+
+// taxiiDiscovery is the subset of a TAXII 2.1 discovery response (GET /taxii2/) this provider
+// needs: which API root to send collection requests to.
+type taxiiDiscovery struct {
+	Title    string   `json:"title"`
+	Default  string   `json:"default"`
+	APIRoots []string `json:"api_roots"`
+}
+
+// taxiiEnvelope is a TAXII 2.1 object envelope - the body of a collection's /objects/ response.
+type taxiiEnvelope struct {
+	Objects []taxiiIndicator `json:"objects"`
+	More    bool             `json:"more"`
+	Next    string           `json:"next"`
+}
+
+// taxiiIndicator is the subset of a STIX 2.1 Indicator SDO this provider cares about.
+type taxiiIndicator struct {
+	Type        string `json:"type"`
+	PatternType string `json:"pattern_type"`
+	Pattern     string `json:"pattern"`
+	Created     string `json:"created"`
+	ValidUntil  string `json:"valid_until"`
+}
+
+// ipPatternRe pulls ipv4-addr/ipv6-addr comparisons out of a STIX pattern, e.g.
+// "[ipv4-addr:value = '1.2.3.4' OR ipv6-addr:value = '2001:db8::/32']".
+var ipPatternRe = regexp.MustCompile(`(ipv4-addr|ipv6-addr):value\s*=\s*'([^']+)'`)
+
+// TAXII polls a TAXII 2.1 server for STIX 2.1 indicator objects and extracts the plain IPs/CIDRs
+// referenced by their patterns, so any STIX/TAXII-speaking sharing community (MISP-TAXII, OTX,
+// ISACs) can be plugged in without writing a dedicated provider per source.
+type TAXII struct{}
+
+func (t *TAXII) Name() string {
+	return "taxii"
+}
+
+func (t *TAXII) Description() string {
+	return "Generic STIX/TAXII 2.1 client: polls a collection for indicator objects and extracts IPv4/IPv6 addresses from their patterns."
+}
+
+func (t *TAXII) Schedule() string {
+	return "*/15 * * * *"
+}
+
+func (t *TAXII) DefaultParams() map[string]string {
+	return map[string]string{
+		"discovery_url": "",
+		"collection_id": "",
+		"username":      "",
+		"password":      "",
+		"bearer_token":  "",
+		"added_after":   "",
+		"pattern_types": "ipv4-addr,ipv6-addr",
+	}
+}
+
+// Fetch performs a one-shot pull of every indicator the collection currently has (from
+// params["added_after"] onward, or everything if that's unset). Routine scheduled syncs go
+// through FetchIncremental instead, since the aggregator prefers it when available.
+func (t *TAXII) Fetch(params map[string]string) ([]netip.Prefix, error) {
+	results, _, err := t.poll(params, params["added_after"])
+	return results, err
+}
+
+// FetchIncremental polls only indicators created after the last persisted added_after cursor
+// (params["_data_dir"]), so routine polls only pay for what's new. TAXII doesn't model deletions
+// the way a decision stream does, so removed is always empty.
+func (t *TAXII) FetchIncremental(params map[string]string) (added, removed []netip.Prefix, err error) {
+	cursorFile := t.cursorFile(params)
+	addedAfter := params["added_after"]
+	if data, readErr := os.ReadFile(cursorFile); readErr == nil {
+		if cursor := strings.TrimSpace(string(data)); cursor != "" {
+			addedAfter = cursor
+		}
+	}
+
+	results, newCursor, err := t.poll(params, addedAfter)
+	if err != nil {
+		return nil, nil, err
+	}
+	if newCursor != "" {
+		if err := os.WriteFile(cursorFile, []byte(newCursor), 0644); err != nil {
+			return nil, nil, fmt.Errorf("failed to persist cursor: %v", err)
+		}
+	}
+	return results, nil, nil
+}
+
+// poll resolves the collection's objects URL via TAXII discovery, walks every page of indicators
+// added after addedAfter, and returns the extracted prefixes plus the newest "created" timestamp
+// seen, for the caller to persist as the next addedAfter.
+func (t *TAXII) poll(params map[string]string, addedAfter string) (results []netip.Prefix, newCursor string, err error) {
+	discoveryURL := strings.TrimSuffix(params["discovery_url"], "/")
+	collectionID := params["collection_id"]
+	if discoveryURL == "" || collectionID == "" {
+		return nil, "", fmt.Errorf("discovery_url and collection_id are required")
+	}
+
+	apiRoot, err := t.discoverAPIRoot(params, discoveryURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	patternTypes := strings.Split(params["pattern_types"], ",")
+	objURL := fmt.Sprintf("%s/collections/%s/objects/?match[type]=indicator&limit=100", apiRoot, collectionID)
+	if addedAfter != "" {
+		objURL += "&added_after=" + addedAfter
+	}
+
+	for objURL != "" {
+		var envelope taxiiEnvelope
+		next, err := t.getEnvelope(params, objURL, &envelope)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, obj := range envelope.Objects {
+			if obj.Type != "indicator" {
+				continue
+			}
+			if obj.ValidUntil != "" && t.expired(obj.ValidUntil) {
+				continue
+			}
+			results = append(results, extractIPPatterns(obj.Pattern, patternTypes)...)
+			if obj.Created > newCursor {
+				newCursor = obj.Created
+			}
+		}
+		objURL = next
+	}
+	return results, newCursor, nil
+}
+
+func (t *TAXII) discoverAPIRoot(params map[string]string, discoveryURL string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, discoveryURL+"/taxii2/", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to build discovery request: %v", err)
+	}
+	req.Header.Set("Accept", taxiiMediaType)
+	t.authorize(params, req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to discover TAXII server: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status from TAXII discovery: %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read discovery response: %v", err)
+	}
+	var discovery taxiiDiscovery
+	if err := json.Unmarshal(body, &discovery); err != nil {
+		return "", fmt.Errorf("failed to parse discovery response: %v", err)
+	}
+	apiRoot := discovery.Default
+	if apiRoot == "" && len(discovery.APIRoots) > 0 {
+		apiRoot = discovery.APIRoots[0]
+	}
+	if apiRoot == "" {
+		return "", fmt.Errorf("TAXII discovery returned no api_roots")
+	}
+	return strings.TrimSuffix(apiRoot, "/"), nil
+}
+
+// getEnvelope fetches one page of url into out, and returns the URL of the next page, if any.
+// Some TAXII servers surface the next-page cursor as a "Next" response header rather than in the
+// envelope body, so both are checked, with the header taking precedence.
+func (t *TAXII) getEnvelope(params map[string]string, url string, out *taxiiEnvelope) (next string, err error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to build request: %v", err)
+	}
+	req.Header.Set("Accept", taxiiMediaType)
+	t.authorize(params, req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status from %s: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body: %v", err)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return "", fmt.Errorf("failed to parse TAXII envelope: %v", err)
+	}
+
+	if header := resp.Header.Get("Next"); header != "" {
+		return appendNextParam(url, header), nil
+	}
+	if out.More && out.Next != "" {
+		return appendNextParam(url, out.Next), nil
+	}
+	return "", nil
+}
+
+func appendNextParam(url, next string) string {
+	if strings.Contains(url, "?") {
+		return url + "&next=" + next
+	}
+	return url + "?next=" + next
+}
+
+func (t *TAXII) authorize(params map[string]string, req *http.Request) {
+	if token := params["bearer_token"]; token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return
+	}
+	if params["username"] != "" {
+		req.SetBasicAuth(params["username"], params["password"])
+	}
+}
+
+func (t *TAXII) expired(validUntil string) bool {
+	ts, err := time.Parse(time.RFC3339, validUntil)
+	if err != nil {
+		return false
+	}
+	return ts.Before(time.Now())
+}
+
+func (t *TAXII) cursorFile(params map[string]string) string {
+	dir := params["_data_dir"]
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "taxii-"+sanitizeFilename(params["collection_id"])+"-cursor.txt")
+}
+
+// sanitizeFilename keeps a collection ID usable as part of a filename regardless of what
+// characters the TAXII server happens to use for its IDs (UUIDs are safe, but the spec doesn't
+// require them).
+func sanitizeFilename(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
+
+// extractIPPatterns pulls every ipv4-addr/ipv6-addr value comparison out of a STIX pattern and
+// returns the ones whose object type is in allowedTypes as parsed prefixes.
+func extractIPPatterns(pattern string, allowedTypes []string) []netip.Prefix {
+	allowed := make(map[string]bool, len(allowedTypes))
+	for _, at := range allowedTypes {
+		if at = strings.TrimSpace(at); at != "" {
+			allowed[at] = true
+		}
+	}
+	var results []netip.Prefix
+	for _, m := range ipPatternRe.FindAllStringSubmatch(pattern, -1) {
+		if len(allowed) > 0 && !allowed[m[1]] {
+			continue
+		}
+		if prefix, ok := ParseIndicator(m[2]); ok {
+			results = append(results, prefix)
+		}
+	}
+	return results
+}
+
+func init() {
+	Register(&TAXII{})
+}
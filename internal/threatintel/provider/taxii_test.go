@@ -0,0 +1,110 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTAXII_Fetch(t *testing.T) {
+	mux := http.NewServeMux()
+	var apiRoot string
+	mux.HandleFunc("/taxii2/", func(w http.ResponseWriter, r *http.Request) {
+		data, _ := json.Marshal(taxiiDiscovery{APIRoots: []string{apiRoot}})
+		w.Write(data)
+	})
+	page1 := true
+	mux.HandleFunc("/api1/collections/coll-1/objects/", func(w http.ResponseWriter, r *http.Request) {
+		if page1 {
+			page1 = false
+			w.Header().Set("Next", "cursor-2")
+			data, _ := json.Marshal(taxiiEnvelope{
+				Objects: []taxiiIndicator{
+					{Type: "indicator", Pattern: "[ipv4-addr:value = '1.2.3.4']", Created: "2026-01-01T00:00:00Z"},
+					{Type: "indicator", Pattern: "[domain-name:value = 'evil.example']", Created: "2026-01-01T00:01:00Z"},
+				},
+			})
+			w.Write(data)
+			return
+		}
+		if !strings.Contains(r.URL.RawQuery, "next=cursor-2") {
+			t.Errorf("second page request missing next=cursor-2: %s", r.URL.RawQuery)
+		}
+		data, _ := json.Marshal(taxiiEnvelope{
+			Objects: []taxiiIndicator{
+				{Type: "indicator", Pattern: "[ipv6-addr:value = '2001:db8::/32' OR ipv4-addr:value = '5.6.7.8']", Created: "2026-01-02T00:00:00Z"},
+				{Type: "indicator", Pattern: "[ipv4-addr:value = '9.9.9.9']", Created: "2020-01-01T00:00:00Z", ValidUntil: "2021-01-01T00:00:00Z"},
+			},
+		})
+		w.Write(data)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	apiRoot = server.URL + "/api1/"
+
+	taxii := &TAXII{}
+	params := taxii.DefaultParams()
+	params["discovery_url"] = server.URL
+	params["collection_id"] = "coll-1"
+
+	results, err := taxii.Fetch(params)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	// expects 1.2.3.4, 2001:db8::/32 and 5.6.7.8 - not the domain-name indicator or the expired one
+	if len(results) != 3 {
+		t.Fatalf("results = %d entries, want 3: %v", len(results), results)
+	}
+}
+
+func TestTAXII_FetchIncrementalPersistsCursor(t *testing.T) {
+	var addedAfterSeen []string
+	mux := http.NewServeMux()
+	var apiRoot string
+	mux.HandleFunc("/taxii2/", func(w http.ResponseWriter, r *http.Request) {
+		data, _ := json.Marshal(taxiiDiscovery{APIRoots: []string{apiRoot}})
+		w.Write(data)
+	})
+	mux.HandleFunc("/api1/collections/coll-1/objects/", func(w http.ResponseWriter, r *http.Request) {
+		addedAfterSeen = append(addedAfterSeen, r.URL.Query().Get("added_after"))
+		data, _ := json.Marshal(taxiiEnvelope{
+			Objects: []taxiiIndicator{
+				{Type: "indicator", Pattern: "[ipv4-addr:value = '1.1.1.1']", Created: "2026-01-01T00:00:00Z"},
+			},
+		})
+		w.Write(data)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	apiRoot = server.URL + "/api1/"
+
+	taxii := &TAXII{}
+	params := taxii.DefaultParams()
+	params["discovery_url"] = server.URL
+	params["collection_id"] = "coll-1"
+	params["_data_dir"] = t.TempDir()
+
+	if _, _, err := taxii.FetchIncremental(params); err != nil {
+		t.Fatalf("first FetchIncremental() error = %v", err)
+	}
+	if _, _, err := taxii.FetchIncremental(params); err != nil {
+		t.Fatalf("second FetchIncremental() error = %v", err)
+	}
+	if len(addedAfterSeen) != 2 || addedAfterSeen[0] != "" || addedAfterSeen[1] != "2026-01-01T00:00:00Z" {
+		t.Errorf("added_after values = %v, want [\"\" \"2026-01-01T00:00:00Z\"]", addedAfterSeen)
+	}
+}
+
+func TestExtractIPPatterns(t *testing.T) {
+	results := extractIPPatterns("[ipv4-addr:value = '1.2.3.4' OR ipv6-addr:value = '2001:db8::/32']", []string{"ipv4-addr", "ipv6-addr"})
+	if len(results) != 2 {
+		t.Fatalf("extractIPPatterns() = %d entries, want 2: %v", len(results), results)
+	}
+
+	v4Only := extractIPPatterns("[ipv4-addr:value = '1.2.3.4' OR ipv6-addr:value = '2001:db8::/32']", []string{"ipv4-addr"})
+	if len(v4Only) != 1 {
+		t.Fatalf("extractIPPatterns() with ipv4-addr filter = %d entries, want 1: %v", len(v4Only), v4Only)
+	}
+}
@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+var torExitListURL = "https://www.dan.me.uk/torlist/"
+
+// TorExitList lists current Tor exit node IPs from dan.me.uk. Operators who want to treat
+// anonymized traffic as a policy signal, rather than a security requirement, enable it
+// alongside the abuse-focused feeds.
+type TorExitList struct{}
+
+func (t *TorExitList) Name() string {
+	return "tor-exit"
+}
+
+func (t *TorExitList) Description() string {
+	return "dan.me.uk's list of currently active Tor exit nodes, refreshed upstream every 30 minutes."
+}
+
+func (t *TorExitList) Schedule() string {
+	return "*/30 * * * *"
+}
+
+func (t *TorExitList) DefaultParams() map[string]string {
+	return map[string]string{
+		"url": torExitListURL,
+	}
+}
+
+func (t *TorExitList) Fetch(params map[string]string) ([]netip.Prefix, error) {
+	url := params["url"]
+	if url == "" {
+		url = torExitListURL
+	}
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body of %s: %v", url, err)
+	}
+	results := make([]netip.Prefix, 0)
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if prefix, ok := ParseIndicator(line); ok {
+			results = append(results, prefix)
+		}
+	}
+	return results, nil
+}
+
+func init() {
+	Register(&TorExitList{})
+}
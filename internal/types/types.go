@@ -32,7 +32,10 @@ func (protocol IPProtocol) String() string {
 	return fmt.Sprintf("%d", protocol)
 }
 
-type PacketInfo struct {
+// PacketWire mirrors the eBPF program's packet_info struct byte-for-byte; EBPFManager decodes a
+// perf record straight into it with binary.Read, so field order, types and sizes here must track
+// the C struct exactly.
+type PacketWire struct {
 	SrcIP     [4]byte
 	DstIP     [4]byte
 	SrcIPv6   [16]byte
@@ -47,6 +50,14 @@ type PacketInfo struct {
 	MatchType MatchType
 }
 
+type PacketInfo struct {
+	PacketWire
+	// Interface is the name of the NIC the packet was captured on. It's set by EBPFManager after
+	// decoding PacketWire, not part of the eBPF program's wire layout, so it must never be read
+	// via binary.Read.
+	Interface string
+}
+
 type Packet struct {
 	Timestamp int64
 	SrcMAC    string
@@ -61,4 +72,15 @@ type Packet struct {
 	EthType   EthernetType
 	IPProto   IPProtocol
 	MatchType MatchType
+	// AllowReason is set when the allow-list matched the packet's source ("allow_ip" or
+	// "allow_name"), so metrics can distinguish "passed because allowed" from "passed because
+	// no rule matched at all". Empty when the allow-list wasn't consulted or didn't match.
+	AllowReason string
+	// ThreatCategory is the name of the first threat-intel feed listing the source IP, set
+	// before policy rules are evaluated so a rule's Expr can reference it (e.g.
+	// `threat_category == "tor-exit"`). Empty if the source isn't on any feed.
+	ThreatCategory string
+	// Interface is the NIC the packet was captured on, copied from PacketInfo so the firewall
+	// ACL layer (which matches on it) doesn't need the raw PacketInfo passed around separately.
+	Interface string
 }
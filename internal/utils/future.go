@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Result is what a task submitted to a FuturePool resolves to. Err is set when the worker
+// function returns an error, PanicVal when it panics instead - the two are mutually exclusive,
+// and a panic is recovered rather than taking the worker down. Duration is wall-clock time spent
+// inside the worker function, for callers tracking per-task latency.
+type Result[R any] struct {
+	Value    R
+	Err      error
+	PanicVal any
+	Duration time.Duration
+}
+
+// TaskFunc is the work a FuturePool runs for each submitted payload.
+type TaskFunc[T any, R any] func(context.Context, T) (R, error)
+
+// futureTiers is how many ElasticPoolPri priority tiers a FuturePool spreads its submissions
+// across. It's an internal dispatch detail, not a caller-visible limit: SubmitTask accepts any
+// int priority and maps it onto this many tiers (see priorityTier), so two submissions only tie
+// if their priorities collapse onto the same tier.
+const futureTiers = 16
+
+// futureTask is one submitted unit of work: its payload, its submission ctx, and the id its
+// Result is filed under in the owning FuturePool's pending map.
+type futureTask[T any] struct {
+	id      uint64
+	payload T
+	ctx     context.Context
+}
+
+// pendingTask is the future side of a submitted task: done is closed once result is set, so any
+// number of wait()/WaitFor callers can observe it without racing each other.
+type pendingTask[R any] struct {
+	done   chan struct{}
+	result Result[R]
+}
+
+// FuturePool runs TaskFunc work over an ElasticPoolPri - the same priority-tiered elastic pool
+// internal/utils already provides - and lets callers wait on an individual submission's Result.
+// It's the request/response counterpart to ElasticPool: ElasticPool fires work at a
+// producer-driven, elastically-scaled worker pool and never hands the caller anything back,
+// while FuturePool is for call sites that need the answer (or at least to know the task
+// finished) and so accept a fixed worker count instead.
+type FuturePool[T any, R any] struct {
+	pool      *ElasticPoolPri[*futureTask[T]]
+	pending   sync.Map // uint64 -> *pendingTask[R]
+	nextID    atomic.Uint64
+	worker    TaskFunc[T, R]
+	closeOnce sync.Once
+}
+
+// NewFuturePool starts workers goroutines draining tasks in priority order (see SubmitTask) and
+// running fn for each. logger may be nil, matching ElasticPool's convention of defaulting to a
+// discarding logger when the caller doesn't care about diagnostics.
+func NewFuturePool[T any, R any](workers int, fn TaskFunc[T, R], logger logrus.FieldLogger) *FuturePool[T, R] {
+	if workers <= 0 {
+		workers = 1
+	}
+	p := &FuturePool[T, R]{worker: fn}
+	p.pool = NewElasticPoolPri[*futureTask[T]](PoolConfig{
+		MinWorkers: int32(workers),
+		MaxWorkers: int32(workers),
+		Logger:     logger,
+	}, futureTiers)
+	p.pool.SetProcessor(p.runTask)
+	// workers is a fixed count (MinWorkers == MaxWorkers), so Start can't fail validating it;
+	// the only other failure mode, a nil processor, can't happen since SetProcessor runs above.
+	_ = p.pool.Start()
+	return p
+}
+
+// priorityTier maps a SubmitTask priority (higher runs first) onto one of ElasticPoolPri's tiers
+// (tier 0 drained first), clamping out-of-range priorities to the pool's highest/lowest tier
+// instead of panicking on an index out of bounds.
+func priorityTier(priority int) int {
+	tier := futureTiers - 1 - priority
+	if tier < 0 {
+		return 0
+	}
+	if tier >= futureTiers {
+		return futureTiers - 1
+	}
+	return tier
+}
+
+// SubmitTask enqueues payload at priority (higher runs first among tasks waiting in the queue)
+// and returns its id plus a wait function the caller can invoke, any number of times and from any
+// number of goroutines, to block for the Result. If ctx is canceled before the task completes,
+// wait returns a Result whose Err is ctx.Err() without leaking the worker goroutine - the queued
+// task is simply left to run to completion (and its Result discarded) on the worker's own time,
+// since the TaskFunc itself has no way to abort mid-execution.
+func (p *FuturePool[T, R]) SubmitTask(ctx context.Context, payload T, priority int) (id uint64, wait func() Result[R]) {
+	id = p.nextID.Add(1)
+	pt := &pendingTask[R]{done: make(chan struct{})}
+	p.pending.Store(id, pt)
+
+	p.pool.Submit(priorityTier(priority), &futureTask[T]{id: id, payload: payload, ctx: ctx})
+
+	wait = func() Result[R] {
+		select {
+		case <-pt.done:
+			return pt.result
+		case <-ctx.Done():
+			return Result[R]{Err: ctx.Err()}
+		}
+	}
+	return id, wait
+}
+
+// WritePrometheus renders the underlying ElasticPoolPri's task/queue/panic metrics under name, so
+// a FuturePool-backed resolver (e.g. the PTR lookup pool) is visible on a /metrics endpoint the
+// same way the packet pool's ElasticPool.WritePrometheus is.
+func (p *FuturePool[T, R]) WritePrometheus(w io.Writer, name string) error {
+	return p.pool.WritePrometheus(w, name)
+}
+
+// WaitFor blocks until every task in ids has either completed or had its own SubmitTask ctx
+// canceled, or until waitCtx is canceled, and returns their results in the same order as ids.
+// An id never submitted to this pool resolves to an error Result; completed tasks are not removed,
+// so a finished id keeps resolving to its Result.
+func (p *FuturePool[T, R]) WaitFor(waitCtx context.Context, ids ...uint64) []Result[R] {
+	results := make([]Result[R], len(ids))
+	for i, id := range ids {
+		v, ok := p.pending.Load(id)
+		if !ok {
+			results[i] = Result[R]{Err: fmt.Errorf("future_pool: unknown task id %d", id)}
+			continue
+		}
+		pt := v.(*pendingTask[R])
+		select {
+		case <-pt.done:
+			results[i] = pt.result
+		case <-waitCtx.Done():
+			results[i] = Result[R]{Err: waitCtx.Err()}
+		}
+	}
+	return results
+}
+
+// runTask is the ElasticPoolPri processor: it runs the registered TaskFunc against t's payload,
+// recovering a panic into Result.PanicVal rather than letting it take the worker down, and files
+// the Result under t.id for SubmitTask's wait()/WaitFor to pick up.
+func (p *FuturePool[T, R]) runTask(t *futureTask[T]) {
+	v, ok := p.pending.Load(t.id)
+	if !ok {
+		return
+	}
+	pt := v.(*pendingTask[R])
+
+	start := time.Now()
+	var res Result[R]
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				res.PanicVal = r
+			}
+		}()
+		res.Value, res.Err = p.worker(t.ctx, t.payload)
+	}()
+	res.Duration = time.Since(start)
+
+	pt.result = res
+	close(pt.done)
+}
+
+// Close stops every worker once its current task (if any) finishes; queued-but-not-yet-started
+// tasks are dropped, so any outstanding wait()/WaitFor for them blocks until its own ctx is
+// canceled.
+func (p *FuturePool[T, R]) Close() error {
+	p.closeOnce.Do(func() {
+		_ = p.pool.Close()
+	})
+	return nil
+}
@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFuturePoolSubmitAndWait(t *testing.T) {
+	pool := NewFuturePool[int, int](2, func(_ context.Context, n int) (int, error) {
+		return n * 2, nil
+	}, nil)
+	defer pool.Close()
+
+	_, wait := pool.SubmitTask(context.Background(), 21, 0)
+	res := wait()
+	if res.Err != nil {
+		t.Fatalf("unexpected error: %v", res.Err)
+	}
+	if res.Value != 42 {
+		t.Errorf("Value = %d, want 42", res.Value)
+	}
+}
+
+func TestFuturePoolPropagatesWorkerError(t *testing.T) {
+	wantErr := errors.New("boom")
+	pool := NewFuturePool[int, int](1, func(_ context.Context, n int) (int, error) {
+		return 0, wantErr
+	}, nil)
+	defer pool.Close()
+
+	_, wait := pool.SubmitTask(context.Background(), 1, 0)
+	res := wait()
+	if !errors.Is(res.Err, wantErr) {
+		t.Errorf("Err = %v, want %v", res.Err, wantErr)
+	}
+}
+
+func TestFuturePoolRecoversPanic(t *testing.T) {
+	pool := NewFuturePool[int, int](1, func(_ context.Context, n int) (int, error) {
+		panic("worker exploded")
+	}, nil)
+	defer pool.Close()
+
+	_, wait := pool.SubmitTask(context.Background(), 1, 0)
+	res := wait()
+	if res.PanicVal == nil {
+		t.Fatal("expected PanicVal to be populated")
+	}
+	if res.PanicVal != "worker exploded" {
+		t.Errorf("PanicVal = %v, want %q", res.PanicVal, "worker exploded")
+	}
+
+	// the pool must keep serving tasks after a worker panic
+	_, wait2 := pool.SubmitTask(context.Background(), 1, 0)
+	if wait2().PanicVal == nil {
+		t.Error("pool should still accept and run tasks after a panic")
+	}
+}
+
+func TestFuturePoolWaitCanceled(t *testing.T) {
+	release := make(chan struct{})
+	pool := NewFuturePool[int, int](1, func(_ context.Context, n int) (int, error) {
+		<-release
+		return n, nil
+	}, nil)
+	defer func() {
+		close(release)
+		pool.Close()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, wait := pool.SubmitTask(ctx, 1, 0)
+	cancel()
+
+	res := wait()
+	if !errors.Is(res.Err, context.Canceled) {
+		t.Errorf("Err = %v, want context.Canceled", res.Err)
+	}
+}
+
+func TestFuturePoolPriorityOrder(t *testing.T) {
+	var mu sync.Mutex
+	var order []int
+
+	blockerStarted := make(chan struct{})
+	release := make(chan struct{})
+	pool := NewFuturePool[int, struct{}](1, func(_ context.Context, n int) (struct{}, error) {
+		if n == -1 {
+			close(blockerStarted)
+			<-release
+			return struct{}{}, nil
+		}
+		mu.Lock()
+		order = append(order, n)
+		mu.Unlock()
+		return struct{}{}, nil
+	}, nil)
+	defer pool.Close()
+
+	// occupy the single worker so the next three submissions queue up and can be reordered by
+	// priority before any of them run
+	_, waitBlocker := pool.SubmitTask(context.Background(), -1, 0)
+	<-blockerStarted
+
+	_, waitLow := pool.SubmitTask(context.Background(), 1, 1)
+	_, waitHigh := pool.SubmitTask(context.Background(), 2, 10)
+	_, waitMid := pool.SubmitTask(context.Background(), 3, 5)
+
+	close(release)
+	waitBlocker()
+	waitHigh()
+	waitMid()
+	waitLow()
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []int{2, 3, 1}
+	if len(order) != len(want) {
+		t.Fatalf("order = %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Errorf("order = %v, want %v", order, want)
+			break
+		}
+	}
+}
+
+func TestFuturePoolWaitFor(t *testing.T) {
+	pool := NewFuturePool[int, int](2, func(_ context.Context, n int) (int, error) {
+		return n + 1, nil
+	}, nil)
+	defer pool.Close()
+
+	id1, _ := pool.SubmitTask(context.Background(), 1, 0)
+	id2, _ := pool.SubmitTask(context.Background(), 2, 0)
+
+	results := pool.WaitFor(context.Background(), id1, id2, 999)
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if results[0].Value != 2 || results[1].Value != 3 {
+		t.Errorf("results = %+v, want values 2 and 3", results)
+	}
+	if results[2].Err == nil {
+		t.Error("expected an error for an unknown task id")
+	}
+}
+
+func TestFuturePoolConcurrentSubmitters(t *testing.T) {
+	pool := NewFuturePool[int, int](4, func(_ context.Context, n int) (int, error) {
+		return n * n, nil
+	}, nil)
+	defer pool.Close()
+
+	const n = 100
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, wait := pool.SubmitTask(context.Background(), i, 0)
+			if res := wait(); res.Value != i*i {
+				t.Errorf("Value = %d, want %d", res.Value, i*i)
+			}
+		}(i)
+	}
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for concurrent submitters")
+	}
+}
@@ -1,166 +1,611 @@
-package utils
-
-import (
-	"fmt"
-	"log"
-	"runtime"
-	"sync/atomic"
-	"time"
-)
-
-type TaskProducer[T any] func(func(T))
-
-type WorkerFunc[T any] func(T)
-
-type ElasticPool[T any] struct {
-	taskQueue   chan T
-	done        chan struct{}
-	workerCount *atomic.Int32
-	producer    TaskProducer[T]
-	processor   WorkerFunc[T]
-	config      PoolConfig
-	lastScale   atomic.Value
-}
-
-type PoolConfig struct {
-	QueueSize     int
-	MinWorkers    int32
-	MaxWorkers    int32
-	ScaleInterval time.Duration
-	IdleTimeout   time.Duration
-	BackoffTime   time.Duration
-}
-
-func NewElasticPool[T any](config PoolConfig) *ElasticPool[T] {
-	if config.QueueSize == 0 {
-		config.QueueSize = 1024
-	}
-	if config.MinWorkers == 0 {
-		config.MinWorkers = 1
-	}
-	if config.MaxWorkers == 0 {
-		config.MaxWorkers = int32(runtime.NumCPU())
-	}
-	if config.ScaleInterval == 0 {
-		config.ScaleInterval = 100 * time.Millisecond
-	}
-	if config.IdleTimeout == 0 {
-		config.IdleTimeout = 10 * time.Second
-	}
-	if config.BackoffTime == 0 {
-		config.BackoffTime = 10 * time.Millisecond
-	}
-
-	p := &ElasticPool[T]{
-		taskQueue:   make(chan T, config.QueueSize),
-		done:        make(chan struct{}),
-		workerCount: &atomic.Int32{},
-		config:      config,
-	}
-	p.lastScale.Store(time.Now())
-	return p
-}
-
-func (p *ElasticPool[T]) SetProducer(producer TaskProducer[T]) {
-	p.producer = producer
-}
-
-func (p *ElasticPool[T]) SetProcessor(processor WorkerFunc[T]) {
-	p.processor = processor
-}
-
-func (p *ElasticPool[T]) Start() error {
-	if p.producer == nil {
-		return fmt.Errorf("producer not registered")
-	}
-	if p.processor == nil {
-		return fmt.Errorf("processor not registered")
-	}
-	for i := int32(0); i < p.config.MinWorkers; i++ {
-		go p.startWorker()
-	}
-	go p.startProducer()
-	go p.startMonitor()
-	return nil
-}
-
-func (p *ElasticPool[T]) startProducer() {
-
-	p.producer(func(data T) {
-		select {
-		case <-p.done:
-			return
-		case p.taskQueue <- data:
-			return
-		}
-	})
-}
-
-func (p *ElasticPool[T]) startWorker() {
-	p.workerCount.Add(1)
-	defer p.workerCount.Add(-1)
-
-	idleTimeout := time.NewTimer(p.config.IdleTimeout)
-	defer idleTimeout.Stop()
-
-	for {
-		select {
-		case <-p.done:
-			return
-		case data, ok := <-p.taskQueue:
-			if !ok {
-				return
-			}
-
-			if !idleTimeout.Stop() {
-				select {
-				case <-idleTimeout.C:
-				default:
-				}
-			}
-			idleTimeout.Reset(p.config.IdleTimeout)
-			func() {
-				defer func() {
-					if r := recover(); r != nil {
-						log.Printf("Worker recovered from panic: %v", r)
-					}
-				}()
-				p.processor(data)
-			}()
-		case <-idleTimeout.C:
-			if p.workerCount.Load() > p.config.MinWorkers {
-				return
-			}
-			idleTimeout.Reset(p.config.IdleTimeout)
-		}
-	}
-}
-
-func (p *ElasticPool[T]) startMonitor() {
-	ticker := time.NewTicker(p.config.ScaleInterval)
-	defer ticker.Stop()
-
-	var queueLen int
-	var currentWorkers int32
-
-	for {
-		select {
-		case <-p.done:
-			return
-		case <-ticker.C:
-			queueLen = len(p.taskQueue)
-			if queueLen > p.config.QueueSize/2 {
-				currentWorkers = p.workerCount.Load()
-				if currentWorkers < p.config.MaxWorkers {
-					go p.startWorker()
-				}
-			}
-		}
-	}
-}
-
-func (p *ElasticPool[T]) Close() error {
-	close(p.done)
-	close(p.taskQueue)
-	return nil
-}
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type TaskProducer[T any] func(func(T))
+
+// KeyedTaskProducer is like TaskProducer, but the submit callback also takes a routing key (e.g.
+// a packet 5-tuple hash) so every task sharing a key lands on the same shard and is processed in
+// submission order relative to the others sharing it. Set with SetKeyedProducer instead of
+// SetProducer when per-key ordering matters; a pool only ever has one producer registered.
+type KeyedTaskProducer[T any] func(func(T, uint64))
+
+type WorkerFunc[T any] func(T)
+
+// queuedItem wraps a producer-submitted payload with the time it entered its shard, so a worker
+// can report queue-wait latency to PoolMetrics once it picks the item up.
+type queuedItem[T any] struct {
+	data       T
+	enqueuedAt time.Time
+}
+
+// shard is one of ElasticPool's per-worker task queues. Its home worker pushes and pops LIFO for
+// cache locality (the most recently queued item is the most likely to still be hot), while idle
+// workers steal FIFO from the tail end so a steal takes a victim's coldest work rather than
+// racing its owner for the item it's about to pop itself.
+type shard[T any] struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	items  []queuedItem[T]
+	cap    int
+	closed bool
+}
+
+func newShard[T any](capacity int) *shard[T] {
+	s := &shard[T]{cap: capacity}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// push appends item, blocking while the shard is at capacity until either room frees up or the
+// shard is closed, in which case it returns false without queuing item.
+func (s *shard[T]) push(item queuedItem[T]) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.items) >= s.cap && !s.closed {
+		s.cond.Wait()
+	}
+	if s.closed {
+		return false
+	}
+	s.items = append(s.items, item)
+	s.cond.Signal()
+	return true
+}
+
+// tryPush is push without blocking: it returns false immediately if the shard is already at
+// capacity or closed, instead of waiting for room.
+func (s *shard[T]) tryPush(item queuedItem[T]) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || len(s.items) >= s.cap {
+		return false
+	}
+	s.items = append(s.items, item)
+	s.cond.Signal()
+	return true
+}
+
+// pushCtx is push, but also gives up and returns false if ctx is done before room frees up.
+func (s *shard[T]) pushCtx(ctx context.Context, item queuedItem[T]) bool {
+	stopWatch := make(chan struct{})
+	defer close(stopWatch)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.cond.Broadcast()
+		case <-stopWatch:
+		}
+	}()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.items) >= s.cap && !s.closed && ctx.Err() == nil {
+		s.cond.Wait()
+	}
+	if s.closed || ctx.Err() != nil {
+		return false
+	}
+	s.items = append(s.items, item)
+	s.cond.Signal()
+	return true
+}
+
+// popLIFO removes and returns the most recently pushed item, or ok=false if the shard is empty.
+func (s *shard[T]) popLIFO() (item queuedItem[T], ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.items)
+	if n == 0 {
+		return item, false
+	}
+	item = s.items[n-1]
+	s.items[n-1] = queuedItem[T]{}
+	s.items = s.items[:n-1]
+	s.cond.Signal()
+	return item, true
+}
+
+// steal removes and returns the oldest queued item, or ok=false if the shard is empty.
+func (s *shard[T]) steal() (item queuedItem[T], ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.items) == 0 {
+		return item, false
+	}
+	item = s.items[0]
+	s.items[0] = queuedItem[T]{}
+	s.items = s.items[1:]
+	s.cond.Signal()
+	return item, true
+}
+
+func (s *shard[T]) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items)
+}
+
+func (s *shard[T]) capacity() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cap
+}
+
+// setCap changes the shard's capacity in place and wakes any pusher blocked waiting for room, so
+// a live QueueSize increase takes effect immediately without recreating the shard or touching
+// whatever is already queued.
+func (s *shard[T]) setCap(capacity int) {
+	s.mu.Lock()
+	s.cap = capacity
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+func (s *shard[T]) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+type ElasticPool[T any] struct {
+	shards        []*shard[T]
+	rr            atomic.Uint64
+	scaleDown     chan struct{}
+	done          chan struct{}
+	workerCount   *atomic.Int32
+	producer      TaskProducer[T]
+	keyedProducer KeyedTaskProducer[T]
+	processor     WorkerFunc[T]
+	config        atomic.Pointer[PoolConfig]
+	lastScale     atomic.Value
+	metrics       *PoolMetrics
+	logger        logrus.FieldLogger
+	objPool       *sync.Pool
+	objReset      func(T)
+}
+
+// PoolOption configures an ElasticPool at construction time, beyond what PoolConfig's plain
+// fields cover.
+type PoolOption[T any] func(*ElasticPool[T])
+
+// WithObjectPool backs the pool's payloads with a sync.Pool seeded by newFn. Producers call Get()
+// to obtain a reused T instead of allocating one, and runTask calls reset on it and returns it to
+// the pool immediately after the processor finishes handling it - normally or via a recovered
+// panic. A T handed out by Get() is only valid for the duration of a single task: the processor
+// must not retain it past its own call, since it may be reused (and mutated) for another task the
+// moment it's Put back. Intended for payload types that are themselves pointers (e.g.
+// *types.PacketInfo), so reset can zero the pointee in place.
+func WithObjectPool[T any](newFn func() T, reset func(T)) PoolOption[T] {
+	return func(p *ElasticPool[T]) {
+		p.objPool = &sync.Pool{New: func() any { return newFn() }}
+		p.objReset = reset
+	}
+}
+
+// Get returns a pooled T for a producer to populate before submitting it. It panics if the pool
+// wasn't constructed with WithObjectPool.
+func (p *ElasticPool[T]) Get() T {
+	return p.objPool.Get().(T)
+}
+
+type PoolConfig struct {
+	QueueSize     int
+	MinWorkers    int32
+	MaxWorkers    int32
+	ScaleInterval time.Duration
+	IdleTimeout   time.Duration
+	// BackoffTime is how long an idle worker waits between poll attempts once its home shard and
+	// every shard it tried stealing from came up empty.
+	BackoffTime time.Duration
+	// Logger receives pool diagnostics (e.g. a worker panic); defaults to a discarding logger
+	// when unset, so callers not configuring logging don't have to pass one.
+	Logger logrus.FieldLogger
+
+	// HighWatermark and LowWatermark bound worker utilization (0-1, measured as a rolling EWMA
+	// of busy-worker time per ScaleInterval). The monitor scales up once utilization stays above
+	// HighWatermark for ScaleUpAfter consecutive intervals, and signals one worker to exit once
+	// it stays below LowWatermark for ScaleDownAfter consecutive intervals. HighWatermark == 0
+	// (the zero value) disables utilization-based scaling entirely, leaving the queue-length
+	// heuristic below as the only scale-up signal and IdleTimeout as the only scale-down one -
+	// existing callers that don't set these fields keep today's behavior unchanged.
+	HighWatermark  float64
+	LowWatermark   float64
+	ScaleUpAfter   int
+	ScaleDownAfter int
+}
+
+func NewElasticPool[T any](config PoolConfig, opts ...PoolOption[T]) *ElasticPool[T] {
+	if config.QueueSize == 0 {
+		config.QueueSize = 1024
+	}
+	if config.MinWorkers == 0 {
+		config.MinWorkers = 1
+	}
+	if config.MaxWorkers == 0 {
+		config.MaxWorkers = int32(runtime.NumCPU())
+	}
+	if config.ScaleInterval == 0 {
+		config.ScaleInterval = 100 * time.Millisecond
+	}
+	if config.IdleTimeout == 0 {
+		config.IdleTimeout = 10 * time.Second
+	}
+	if config.BackoffTime == 0 {
+		config.BackoffTime = 10 * time.Millisecond
+	}
+	if config.HighWatermark > 0 {
+		if config.LowWatermark == 0 {
+			config.LowWatermark = config.HighWatermark / 3
+		}
+		if config.ScaleUpAfter == 0 {
+			config.ScaleUpAfter = 3
+		}
+		if config.ScaleDownAfter == 0 {
+			config.ScaleDownAfter = 5
+		}
+	}
+	logger := config.Logger
+	if logger == nil {
+		discard := logrus.New()
+		discard.SetOutput(io.Discard)
+		logger = discard
+	}
+
+	numShards := runtime.GOMAXPROCS(0)
+	if numShards < 1 {
+		numShards = 1
+	}
+	shardCap := config.QueueSize / numShards
+	if shardCap < 1 {
+		shardCap = 1
+	}
+	shards := make([]*shard[T], numShards)
+	for i := range shards {
+		shards[i] = newShard[T](shardCap)
+	}
+
+	p := &ElasticPool[T]{
+		shards:      shards,
+		scaleDown:   make(chan struct{}, 1),
+		done:        make(chan struct{}),
+		workerCount: &atomic.Int32{},
+		metrics:     &PoolMetrics{},
+		logger:      logger.WithField("component", "pool"),
+	}
+	p.config.Store(&config)
+	p.lastScale.Store(time.Now())
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+func (p *ElasticPool[T]) SetProducer(producer TaskProducer[T]) {
+	p.producer = producer
+}
+
+// SetKeyedProducer registers a producer that supplies a routing key alongside each task, so
+// same-key tasks are always handled by the same shard and therefore run in submission order
+// relative to one another. Mutually exclusive with SetProducer.
+func (p *ElasticPool[T]) SetKeyedProducer(producer KeyedTaskProducer[T]) {
+	p.keyedProducer = producer
+}
+
+func (p *ElasticPool[T]) SetProcessor(processor WorkerFunc[T]) {
+	p.processor = processor
+}
+
+// Config returns a copy of the pool's current PoolConfig, for callers that need to build another
+// pool matching its settings (e.g. EBPFManager's per-interface pools) or inspect live bounds
+// after a Reconfigure.
+func (p *ElasticPool[T]) Config() PoolConfig {
+	return *p.config.Load()
+}
+
+// Reconfigure atomically swaps in new MinWorkers/MaxWorkers/QueueSize bounds without draining or
+// recreating the pool's shards - whatever is already queued is left untouched. Fields left at
+// their zero value keep the pool's current setting instead of resetting to nothing, so a caller
+// only needs to pass what it's actually changing. If MinWorkers rises, workers are started
+// immediately to reach it rather than waiting for the next scaling-monitor tick.
+func (p *ElasticPool[T]) Reconfigure(cfg PoolConfig) {
+	current := *p.config.Load()
+	next := current
+	if cfg.MinWorkers > 0 {
+		next.MinWorkers = cfg.MinWorkers
+	}
+	if cfg.MaxWorkers > 0 {
+		next.MaxWorkers = cfg.MaxWorkers
+	}
+	if cfg.QueueSize > 0 && cfg.QueueSize != current.QueueSize {
+		next.QueueSize = cfg.QueueSize
+		shardCap := cfg.QueueSize / len(p.shards)
+		if shardCap < 1 {
+			shardCap = 1
+		}
+		for _, s := range p.shards {
+			s.setCap(shardCap)
+		}
+	}
+	p.config.Store(&next)
+
+	for n := p.workerCount.Load(); n < next.MinWorkers; n++ {
+		go p.startWorker(p.nextShard())
+	}
+}
+
+// Processor returns the WorkerFunc registered with SetProcessor, or nil if none has been set yet.
+func (p *ElasticPool[T]) Processor() WorkerFunc[T] {
+	return p.processor
+}
+
+// Metrics returns the pool's PoolMetrics, for callers that want a Stats() snapshot or to expose
+// WritePrometheus on an HTTP endpoint.
+func (p *ElasticPool[T]) Metrics() *PoolMetrics {
+	return p.metrics
+}
+
+func (p *ElasticPool[T]) Start() error {
+	if p.producer == nil && p.keyedProducer == nil {
+		return fmt.Errorf("producer not registered")
+	}
+	if p.processor == nil {
+		return fmt.Errorf("processor not registered")
+	}
+	for i := int32(0); i < p.config.Load().MinWorkers; i++ {
+		go p.startWorker(p.nextShard())
+	}
+	go p.startProducer()
+	go p.startMonitor()
+	return nil
+}
+
+// nextShard round-robins across shards, for assigning a new worker's home shard and for routing
+// submissions from a keyless TaskProducer.
+func (p *ElasticPool[T]) nextShard() int {
+	return int(p.rr.Add(1) % uint64(len(p.shards)))
+}
+
+func (p *ElasticPool[T]) startProducer() {
+	if p.keyedProducer != nil {
+		p.keyedProducer(func(data T, key uint64) {
+			p.enqueue(int(key%uint64(len(p.shards))), data)
+		})
+		return
+	}
+	p.producer(func(data T) {
+		p.enqueue(p.nextShard(), data)
+	})
+}
+
+func (p *ElasticPool[T]) enqueue(idx int, data T) {
+	item := queuedItem[T]{data: data, enqueuedAt: time.Now()}
+	if p.shards[idx].push(item) {
+		p.metrics.tasksSubmitted.Add(1)
+	} else {
+		p.metrics.tasksDropped.Add(1)
+	}
+}
+
+// TrySubmit enqueues data without blocking, returning false (and counting the task as dropped)
+// if the target shard is already full, so a producer that can't afford to stall behind a full
+// queue can shed load instead. Bypasses SetProducer/SetKeyedProducer; a pool can mix both a
+// registered producer and direct TrySubmit/SubmitWithContext calls.
+func (p *ElasticPool[T]) TrySubmit(data T) bool {
+	item := queuedItem[T]{data: data, enqueuedAt: time.Now()}
+	if p.shards[p.nextShard()].tryPush(item) {
+		p.metrics.tasksSubmitted.Add(1)
+		return true
+	}
+	p.metrics.tasksDropped.Add(1)
+	return false
+}
+
+// SubmitWithContext enqueues data, blocking until it's accepted or ctx is done, whichever comes
+// first. Returns ctx.Err() if ctx ends the wait, or an error if the pool is closed.
+func (p *ElasticPool[T]) SubmitWithContext(ctx context.Context, data T) error {
+	item := queuedItem[T]{data: data, enqueuedAt: time.Now()}
+	if !p.shards[p.nextShard()].pushCtx(ctx, item) {
+		p.metrics.tasksDropped.Add(1)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("pool closed")
+	}
+	p.metrics.tasksSubmitted.Add(1)
+	return nil
+}
+
+// queueLen returns the total number of tasks currently queued across all shards.
+func (p *ElasticPool[T]) queueLen() int {
+	total := 0
+	for _, s := range p.shards {
+		total += s.len()
+	}
+	return total
+}
+
+// totalCapacity returns the combined capacity of all shards.
+func (p *ElasticPool[T]) totalCapacity() int {
+	total := 0
+	for _, s := range p.shards {
+		total += s.capacity()
+	}
+	return total
+}
+
+// stealFrom tries a bounded number of random victim shards other than home, returning the first
+// stolen item found.
+func (p *ElasticPool[T]) stealFrom(home int) (queuedItem[T], bool) {
+	n := len(p.shards)
+	if n <= 1 {
+		return queuedItem[T]{}, false
+	}
+	attempts := n - 1
+	if attempts > 4 {
+		attempts = 4
+	}
+	start := rand.Intn(n)
+	for i := 0; i < attempts; i++ {
+		idx := (start + i) % n
+		if idx == home {
+			continue
+		}
+		if item, ok := p.shards[idx].steal(); ok {
+			return item, true
+		}
+	}
+	return queuedItem[T]{}, false
+}
+
+func (p *ElasticPool[T]) startWorker(home int) {
+	// RUSAGE_THREAD only reports the calling OS thread's usage, so this goroutine must stay on
+	// one OS thread for the rest of its life for the CPU-time deltas in runTask to mean anything.
+	// The thread is torn down (not returned to the scheduler's pool) once this goroutine returns,
+	// per runtime.LockOSThread's documented behavior - an accepted cost of accurate per-worker
+	// CPU accounting.
+	runtime.LockOSThread()
+	p.workerCount.Add(1)
+	defer p.workerCount.Add(-1)
+
+	poll := time.NewTicker(p.config.Load().BackoffTime)
+	defer poll.Stop()
+	idleSince := time.Now()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-p.scaleDown:
+			if p.workerCount.Load() > p.config.Load().MinWorkers {
+				return
+			}
+		default:
+		}
+
+		item, ok := p.shards[home].popLIFO()
+		if !ok {
+			item, ok = p.stealFrom(home)
+		}
+		if ok {
+			idleSince = time.Now()
+			p.runTask(item)
+			continue
+		}
+
+		if time.Since(idleSince) > p.config.Load().IdleTimeout && p.workerCount.Load() > p.config.Load().MinWorkers {
+			return
+		}
+
+		select {
+		case <-p.done:
+			return
+		case <-p.scaleDown:
+			if p.workerCount.Load() > p.config.Load().MinWorkers {
+				return
+			}
+		case <-poll.C:
+		}
+	}
+}
+
+// runTask executes item's payload, recovering a panic rather than letting it take the worker
+// down, and records CPU time, wall duration and queue-wait latency to p.metrics regardless of
+// whether the processor panicked.
+func (p *ElasticPool[T]) runTask(item queuedItem[T]) {
+	queueWait := time.Since(item.enqueuedAt)
+	wallStart := time.Now()
+	cpuBefore, _ := rusageThreadNs()
+
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				p.metrics.panics.Add(1)
+				p.logger.Errorf("worker recovered from panic: %v", r)
+			}
+		}()
+		p.processor(item.data)
+	}()
+
+	cpuAfter, _ := rusageThreadNs()
+	p.metrics.record(time.Duration(cpuAfter-cpuBefore), time.Since(wallStart), queueWait)
+
+	if p.objPool != nil {
+		if p.objReset != nil {
+			p.objReset(item.data)
+		}
+		p.objPool.Put(item.data)
+	}
+}
+
+func (p *ElasticPool[T]) startMonitor() {
+	ticker := time.NewTicker(p.config.Load().ScaleInterval)
+	defer ticker.Stop()
+
+	var currentWorkers int32
+	var prevWallNs int64
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			cfg := p.config.Load()
+			currentWorkers = p.workerCount.Load()
+			depth := p.queueLen()
+			p.metrics.observeQueueDepth(depth)
+			if depth > p.totalCapacity()/2 && currentWorkers < cfg.MaxWorkers {
+				go p.startWorker(p.nextShard())
+			}
+
+			if cfg.HighWatermark <= 0 {
+				continue
+			}
+			wallNs := p.metrics.wallTimeNs.Load()
+			deltaWallNs := wallNs - prevWallNs
+			prevWallNs = wallNs
+
+			var sample float64
+			if currentWorkers > 0 {
+				intervalNs := cfg.ScaleInterval.Nanoseconds() * int64(currentWorkers)
+				if intervalNs > 0 {
+					sample = float64(deltaWallNs) / float64(intervalNs)
+					if sample > 1 {
+						sample = 1
+					}
+				}
+			}
+
+			scaleUp, scaleDown := p.metrics.evaluateScale(sample, cfg.HighWatermark, cfg.LowWatermark, cfg.ScaleUpAfter, cfg.ScaleDownAfter)
+			switch {
+			case scaleUp && currentWorkers < cfg.MaxWorkers:
+				go p.startWorker(p.nextShard())
+			case scaleDown && currentWorkers > cfg.MinWorkers:
+				select {
+				case p.scaleDown <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}
+}
+
+func (p *ElasticPool[T]) Close() error {
+	close(p.done)
+	for _, s := range p.shards {
+		s.close()
+	}
+	return nil
+}
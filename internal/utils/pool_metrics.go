@@ -0,0 +1,218 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ewmaAlpha weights the most recent utilization sample against PoolMetrics' running average;
+// higher reacts faster to bursts, lower smooths out noise.
+const ewmaAlpha = 0.3
+
+// numQueueDepthBuckets is the size of queueDepthBuckets; kept as a named constant so
+// PoolMetrics.queueDepthBucketCounts can be a fixed-size array instead of a slice that every
+// PoolMetrics{} zero value would need to separately allocate.
+const numQueueDepthBuckets = 5
+
+// queueDepthBuckets are the cumulative (Prometheus "le") upper bounds the monitor sorts each
+// ScaleInterval's queueLen() sample into, giving a rough histogram of how full the pool's queue
+// tends to run without having to retain every individual sample.
+var queueDepthBuckets = [numQueueDepthBuckets]float64{0, 10, 50, 200, 1000}
+
+// PoolMetrics accumulates per-task timing for an ElasticPool: CPU time spent inside the
+// processor, wall-clock duration, queue-wait latency, and a rolling utilization EWMA the monitor
+// uses to decide when to scale. CPU time comes from RUSAGE_THREAD deltas around each processor
+// call, which only means what it says if the calling goroutine stays pinned to one OS thread for
+// the call - see the runtime.LockOSThread() in ElasticPool.startWorker.
+type PoolMetrics struct {
+	tasksProcessed atomic.Int64
+	tasksSubmitted atomic.Int64
+	tasksDropped   atomic.Int64
+	panics         atomic.Int64
+	cpuTimeNs      atomic.Int64
+	wallTimeNs     atomic.Int64
+	queueWaitNs    atomic.Int64
+
+	queueDepthSamples      atomic.Int64
+	queueDepthSum          atomic.Int64
+	queueDepthBucketCounts [numQueueDepthBuckets]atomic.Int64
+
+	mu              sync.Mutex
+	utilizationEWMA float64
+	aboveHighStreak int
+	belowLowStreak  int
+}
+
+// PoolStats is a point-in-time snapshot of PoolMetrics' accumulated and rolling values.
+type PoolStats struct {
+	TasksProcessed int64
+	TasksSubmitted int64
+	TasksDropped   int64
+	Panics         int64
+	AvgCPUTime     time.Duration
+	AvgWallTime    time.Duration
+	AvgQueueWait   time.Duration
+	AvgQueueDepth  float64
+	Utilization    float64
+}
+
+func (m *PoolMetrics) record(cpu, wall, queueWait time.Duration) {
+	m.tasksProcessed.Add(1)
+	m.cpuTimeNs.Add(cpu.Nanoseconds())
+	m.wallTimeNs.Add(wall.Nanoseconds())
+	m.queueWaitNs.Add(queueWait.Nanoseconds())
+}
+
+// observeQueueDepth folds a queueLen() sample into the running sum/count and the cumulative
+// depth-histogram buckets, so WritePrometheus can expose it as a standard Prometheus histogram.
+func (m *PoolMetrics) observeQueueDepth(depth int) {
+	m.queueDepthSamples.Add(1)
+	m.queueDepthSum.Add(int64(depth))
+	for i, bound := range queueDepthBuckets {
+		if float64(depth) <= bound {
+			m.queueDepthBucketCounts[i].Add(1)
+		}
+	}
+}
+
+// Stats returns a snapshot of the metrics accumulated so far.
+func (m *PoolMetrics) Stats() PoolStats {
+	n := m.tasksProcessed.Load()
+	stats := PoolStats{
+		TasksProcessed: n,
+		TasksSubmitted: m.tasksSubmitted.Load(),
+		TasksDropped:   m.tasksDropped.Load(),
+		Panics:         m.panics.Load(),
+	}
+	if n > 0 {
+		stats.AvgCPUTime = time.Duration(m.cpuTimeNs.Load() / n)
+		stats.AvgWallTime = time.Duration(m.wallTimeNs.Load() / n)
+		stats.AvgQueueWait = time.Duration(m.queueWaitNs.Load() / n)
+	}
+	if samples := m.queueDepthSamples.Load(); samples > 0 {
+		stats.AvgQueueDepth = float64(m.queueDepthSum.Load()) / float64(samples)
+	}
+	m.mu.Lock()
+	stats.Utilization = m.utilizationEWMA
+	m.mu.Unlock()
+	return stats
+}
+
+// observeUtilization folds the latest interval's busy-worker fraction into the EWMA.
+func (m *PoolMetrics) observeUtilization(sample float64) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.utilizationEWMA = ewmaAlpha*sample + (1-ewmaAlpha)*m.utilizationEWMA
+	return m.utilizationEWMA
+}
+
+// evaluateScale folds sample into the utilization EWMA and reports whether the pool's monitor
+// should scale up or down, given the configured watermarks and streak requirements. Utilization
+// moving out of a watermark's zone resets that zone's streak, so a single noisy tick can't by
+// itself trigger a scaling decision.
+func (m *PoolMetrics) evaluateScale(sample, highWatermark, lowWatermark float64, scaleUpAfter, scaleDownAfter int) (scaleUp, scaleDown bool) {
+	utilization := m.observeUtilization(sample)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case utilization > highWatermark:
+		m.aboveHighStreak++
+		m.belowLowStreak = 0
+		if m.aboveHighStreak >= scaleUpAfter {
+			m.aboveHighStreak = 0
+			scaleUp = true
+		}
+	case utilization < lowWatermark:
+		m.belowLowStreak++
+		m.aboveHighStreak = 0
+		if m.belowLowStreak >= scaleDownAfter {
+			m.belowLowStreak = 0
+			scaleDown = true
+		}
+	default:
+		m.aboveHighStreak = 0
+		m.belowLowStreak = 0
+	}
+	return scaleUp, scaleDown
+}
+
+// WritePrometheus renders the pool's metrics in Prometheus text exposition format under the
+// given metric name prefix, following the same hand-rolled style as
+// metrics.MetricsCollector.WritePrometheus.
+func (p *ElasticPool[T]) WritePrometheus(w io.Writer, name string) error {
+	return writePoolPrometheus(w, name, p.metrics, p.workerCount.Load())
+}
+
+// writePoolPrometheus renders metrics in Prometheus text exposition format under name, shared by
+// ElasticPool and ElasticPoolPri since both accumulate into a *PoolMetrics the same way and only
+// differ in how workers is tracked.
+func writePoolPrometheus(w io.Writer, name string, metrics *PoolMetrics, workers int32) error {
+	stats := metrics.Stats()
+
+	fmt.Fprintf(w, "# HELP %s_tasks_processed_total Total tasks processed by this pool.\n", name)
+	fmt.Fprintf(w, "# TYPE %s_tasks_processed_total counter\n", name)
+	fmt.Fprintf(w, "%s_tasks_processed_total %d\n", name, stats.TasksProcessed)
+
+	fmt.Fprintf(w, "# HELP %s_tasks_submitted_total Total tasks accepted into this pool's queue.\n", name)
+	fmt.Fprintf(w, "# TYPE %s_tasks_submitted_total counter\n", name)
+	fmt.Fprintf(w, "%s_tasks_submitted_total %d\n", name, stats.TasksSubmitted)
+
+	fmt.Fprintf(w, "# HELP %s_tasks_dropped_total Total tasks rejected due to a full queue, a closed pool, or a cancelled SubmitWithContext.\n", name)
+	fmt.Fprintf(w, "# TYPE %s_tasks_dropped_total counter\n", name)
+	fmt.Fprintf(w, "%s_tasks_dropped_total %d\n", name, stats.TasksDropped)
+
+	fmt.Fprintf(w, "# HELP %s_panics_total Total processor panics recovered by this pool's workers.\n", name)
+	fmt.Fprintf(w, "# TYPE %s_panics_total counter\n", name)
+	fmt.Fprintf(w, "%s_panics_total %d\n", name, stats.Panics)
+
+	metrics.writeQueueDepthHistogram(w, name)
+
+	fmt.Fprintf(w, "# HELP %s_workers Current number of live worker goroutines.\n", name)
+	fmt.Fprintf(w, "# TYPE %s_workers gauge\n", name)
+	fmt.Fprintf(w, "%s_workers %d\n", name, workers)
+
+	fmt.Fprintf(w, "# HELP %s_utilization Rolling EWMA of busy-worker fraction, used as the scale signal.\n", name)
+	fmt.Fprintf(w, "# TYPE %s_utilization gauge\n", name)
+	fmt.Fprintf(w, "%s_utilization %g\n", name, stats.Utilization)
+
+	fmt.Fprintf(w, "# HELP %s_cpu_seconds_avg Average per-task CPU time (RUSAGE_THREAD).\n", name)
+	fmt.Fprintf(w, "# TYPE %s_cpu_seconds_avg gauge\n", name)
+	fmt.Fprintf(w, "%s_cpu_seconds_avg %g\n", name, stats.AvgCPUTime.Seconds())
+
+	fmt.Fprintf(w, "# HELP %s_wall_seconds_avg Average per-task wall-clock duration.\n", name)
+	fmt.Fprintf(w, "# TYPE %s_wall_seconds_avg gauge\n", name)
+	fmt.Fprintf(w, "%s_wall_seconds_avg %g\n", name, stats.AvgWallTime.Seconds())
+
+	fmt.Fprintf(w, "# HELP %s_queue_wait_seconds_avg Average time a task spent queued before a worker picked it up.\n", name)
+	fmt.Fprintf(w, "# TYPE %s_queue_wait_seconds_avg gauge\n", name)
+	fmt.Fprintf(w, "%s_queue_wait_seconds_avg %g\n", name, stats.AvgQueueWait.Seconds())
+	return nil
+}
+
+// writeQueueDepthHistogram renders the queue-depth samples as a standard Prometheus histogram:
+// cumulative per-bucket counts, a +Inf bucket, _sum and _count.
+func (m *PoolMetrics) writeQueueDepthHistogram(w io.Writer, name string) {
+	fmt.Fprintf(w, "# HELP %s_queue_depth Distribution of queued-task count sampled once per ScaleInterval.\n", name)
+	fmt.Fprintf(w, "# TYPE %s_queue_depth histogram\n", name)
+	for i, bound := range queueDepthBuckets {
+		fmt.Fprintf(w, "%s_queue_depth_bucket{le=\"%g\"} %d\n", name, bound, m.queueDepthBucketCounts[i].Load())
+	}
+	fmt.Fprintf(w, "%s_queue_depth_bucket{le=\"+Inf\"} %d\n", name, m.queueDepthSamples.Load())
+	fmt.Fprintf(w, "%s_queue_depth_sum %d\n", name, m.queueDepthSum.Load())
+	fmt.Fprintf(w, "%s_queue_depth_count %d\n", name, m.queueDepthSamples.Load())
+}
+
+// rusageThreadNs returns the calling OS thread's total (user+system) CPU time so far, in
+// nanoseconds. Only meaningful when the calling goroutine is locked to its OS thread.
+func rusageThreadNs() (int64, error) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_THREAD, &ru); err != nil {
+		return 0, err
+	}
+	return (ru.Utime.Sec+ru.Stime.Sec)*int64(time.Second) + (ru.Utime.Usec+ru.Stime.Usec)*int64(time.Microsecond), nil
+}
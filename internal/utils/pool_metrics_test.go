@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestElasticPoolMetricsStats(t *testing.T) {
+	config := PoolConfig{
+		QueueSize:     100,
+		MinWorkers:    1,
+		MaxWorkers:    2,
+		ScaleInterval: 50 * time.Millisecond,
+		IdleTimeout:   200 * time.Millisecond,
+	}
+	pool := NewElasticPool[int](config)
+
+	var processed atomic.Int32
+	pool.SetProcessor(func(task int) {
+		processed.Add(1)
+		time.Sleep(5 * time.Millisecond)
+	})
+	pool.SetProducer(func(submit func(int)) {
+		for i := 0; i < 10; i++ {
+			submit(i)
+		}
+	})
+
+	if err := pool.Start(); err != nil {
+		t.Fatalf("Failed to start pool: %v", err)
+	}
+	defer pool.Close()
+
+	deadline := time.After(2 * time.Second)
+	for processed.Load() < 10 {
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for tasks to process")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	stats := pool.Metrics().Stats()
+	if stats.TasksProcessed != 10 {
+		t.Errorf("TasksProcessed = %d, want 10", stats.TasksProcessed)
+	}
+	if stats.AvgWallTime < 5*time.Millisecond {
+		t.Errorf("AvgWallTime = %v, want >= 5ms", stats.AvgWallTime)
+	}
+}
+
+func TestElasticPoolWritePrometheus(t *testing.T) {
+	pool := NewElasticPool[int](PoolConfig{MinWorkers: 1, MaxWorkers: 1})
+	pool.SetProcessor(func(task int) {})
+	pool.SetProducer(func(submit func(int)) { submit(1) })
+	if err := pool.Start(); err != nil {
+		t.Fatalf("Failed to start pool: %v", err)
+	}
+	defer pool.Close()
+
+	deadline := time.After(2 * time.Second)
+	for pool.Metrics().Stats().TasksProcessed < 1 {
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for task to process")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pool.WritePrometheus(&buf, "ebpf_firewall_packet_pool"); err != nil {
+		t.Fatalf("WritePrometheus() error = %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"ebpf_firewall_packet_pool_tasks_processed_total",
+		"ebpf_firewall_packet_pool_tasks_submitted_total",
+		"ebpf_firewall_packet_pool_tasks_dropped_total",
+		"ebpf_firewall_packet_pool_panics_total",
+		"ebpf_firewall_packet_pool_queue_depth_bucket",
+		"ebpf_firewall_packet_pool_workers",
+		"ebpf_firewall_packet_pool_utilization",
+		"ebpf_firewall_packet_pool_cpu_seconds_avg",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("WritePrometheus() output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestElasticPoolTrySubmitAndSubmitWithContext(t *testing.T) {
+	pool := NewElasticPool[int](PoolConfig{QueueSize: 2, MinWorkers: 0, MaxWorkers: 1})
+	pool.SetProcessor(func(task int) {})
+
+	for i := 0; i < len(pool.shards); i++ {
+		// fill every shard directly so TrySubmit's round-robin target is guaranteed full
+		pool.shards[i].tryPush(queuedItem[int]{})
+		for pool.shards[i].tryPush(queuedItem[int]{}) {
+		}
+	}
+
+	if pool.TrySubmit(1) {
+		t.Error("expected TrySubmit to report false once every shard is full")
+	}
+	if dropped := pool.Metrics().Stats().TasksDropped; dropped == 0 {
+		t.Error("expected TasksDropped to be incremented by the failed TrySubmit")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pool.SubmitWithContext(ctx, 1); err == nil {
+		t.Error("expected SubmitWithContext to return an error once its deadline passes against a full pool")
+	}
+}
+
+func TestElasticPoolMetricsQueueDepthHistogram(t *testing.T) {
+	m := &PoolMetrics{}
+	m.observeQueueDepth(5)
+	m.observeQueueDepth(30)
+
+	stats := m.Stats()
+	if stats.AvgQueueDepth != 17.5 {
+		t.Errorf("AvgQueueDepth = %v, want 17.5", stats.AvgQueueDepth)
+	}
+
+	var buf bytes.Buffer
+	m.writeQueueDepthHistogram(&buf, "test_pool")
+	out := buf.String()
+	if !strings.Contains(out, `test_pool_queue_depth_bucket{le="10"} 1`) {
+		t.Errorf("expected le=10 bucket to count only the depth-5 sample:\n%s", out)
+	}
+	if !strings.Contains(out, `test_pool_queue_depth_bucket{le="50"} 2`) {
+		t.Errorf("expected le=50 bucket to be cumulative and count both samples:\n%s", out)
+	}
+	if !strings.Contains(out, "test_pool_queue_depth_count 2") {
+		t.Errorf("expected queue_depth_count to be 2:\n%s", out)
+	}
+}
+
+func TestPoolMetricsEvaluateScale(t *testing.T) {
+	// highWatermark is set low enough that the EWMA of a constant 0.9 sample clears it on every
+	// tick, isolating the streak-counting behavior from the EWMA's own ramp-up curve.
+	m := &PoolMetrics{}
+	if scaleUp, _ := m.evaluateScale(0.9, 0.05, 0.0, 3, 3); scaleUp {
+		t.Error("expected no scale-up on the first above-watermark tick")
+	}
+	if scaleUp, _ := m.evaluateScale(0.9, 0.05, 0.0, 3, 3); scaleUp {
+		t.Error("expected no scale-up on the second above-watermark tick")
+	}
+	scaleUp, _ := m.evaluateScale(0.9, 0.05, 0.0, 3, 3)
+	if !scaleUp {
+		t.Error("expected scale-up on the third consecutive above-watermark tick")
+	}
+
+	// symmetric case: a constant low sample keeps the EWMA under lowWatermark throughout, so
+	// scale-down should trigger after exactly scaleDownAfter ticks.
+	m = &PoolMetrics{}
+	if _, scaleDown := m.evaluateScale(0.1, 1.0, 0.2, 3, 2); scaleDown {
+		t.Error("expected no scale-down on the first below-watermark tick")
+	}
+	if _, scaleDown := m.evaluateScale(0.1, 1.0, 0.2, 3, 2); !scaleDown {
+		t.Error("expected scale-down on the second consecutive below-watermark tick")
+	}
+}
@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ElasticPoolPri is a priority-tiered variant of ElasticPool: every worker drains tier 0 (e.g.
+// active-attack IP handling) completely before falling through to tier 1, tier 2, and so on, so
+// higher-priority work is never left waiting behind a lower-priority backlog (scanning-feed
+// ingestion, say). It gives up ElasticPool's per-worker sharding and work-stealing - priority
+// ordering across the whole pool matters more here than per-shard cache locality - but otherwise
+// reports metrics the same way. It scales up on queue length as ElasticPool does; PoolConfig's
+// HighWatermark/LowWatermark/ScaleUpAfter/ScaleDownAfter are not used, so extra workers exit only
+// through IdleTimeout.
+type ElasticPoolPri[T any] struct {
+	tiers       []*shard[T]
+	done        chan struct{}
+	scaleDown   chan struct{}
+	workerCount *atomic.Int32
+	processor   WorkerFunc[T]
+	config      atomic.Pointer[PoolConfig]
+	metrics     *PoolMetrics
+	logger      logrus.FieldLogger
+}
+
+// NewElasticPoolPri builds a priority pool with numPriorities tiers, where priority 0 is drained
+// ahead of every other tier. cfg is the same PoolConfig ElasticPool takes; QueueSize is split
+// evenly across tiers instead of across shards, since each tier here is a single queue rather
+// than a sharded one.
+func NewElasticPoolPri[T any](cfg PoolConfig, numPriorities int) *ElasticPoolPri[T] {
+	if numPriorities < 1 {
+		numPriorities = 1
+	}
+	if cfg.QueueSize == 0 {
+		cfg.QueueSize = 1024
+	}
+	if cfg.MinWorkers == 0 {
+		cfg.MinWorkers = 1
+	}
+	if cfg.MaxWorkers == 0 {
+		cfg.MaxWorkers = int32(runtime.NumCPU())
+	}
+	if cfg.ScaleInterval == 0 {
+		cfg.ScaleInterval = 100 * time.Millisecond
+	}
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = 10 * time.Second
+	}
+	if cfg.BackoffTime == 0 {
+		cfg.BackoffTime = 10 * time.Millisecond
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		discard := logrus.New()
+		discard.SetOutput(io.Discard)
+		logger = discard
+	}
+
+	tierCap := cfg.QueueSize / numPriorities
+	if tierCap < 1 {
+		tierCap = 1
+	}
+	tiers := make([]*shard[T], numPriorities)
+	for i := range tiers {
+		tiers[i] = newShard[T](tierCap)
+	}
+
+	p := &ElasticPoolPri[T]{
+		tiers:       tiers,
+		done:        make(chan struct{}),
+		scaleDown:   make(chan struct{}, 1),
+		workerCount: &atomic.Int32{},
+		metrics:     &PoolMetrics{},
+		logger:      logger.WithField("component", "pool_pri"),
+	}
+	p.config.Store(&cfg)
+	return p
+}
+
+func (p *ElasticPoolPri[T]) SetProcessor(processor WorkerFunc[T]) {
+	p.processor = processor
+}
+
+// Metrics returns the pool's PoolMetrics, for a Stats() snapshot or WritePrometheus on an HTTP
+// endpoint.
+func (p *ElasticPoolPri[T]) Metrics() *PoolMetrics {
+	return p.metrics
+}
+
+// WritePrometheus renders the pool's metrics in Prometheus text exposition format under name,
+// the same as ElasticPool.WritePrometheus.
+func (p *ElasticPoolPri[T]) WritePrometheus(w io.Writer, name string) error {
+	return writePoolPrometheus(w, name, p.metrics, p.workerCount.Load())
+}
+
+func (p *ElasticPoolPri[T]) clampPriority(priority int) int {
+	if priority < 0 {
+		return 0
+	}
+	if priority >= len(p.tiers) {
+		return len(p.tiers) - 1
+	}
+	return priority
+}
+
+// Submit enqueues data at priority (0 highest), blocking while that tier's queue is full.
+func (p *ElasticPoolPri[T]) Submit(priority int, data T) {
+	item := queuedItem[T]{data: data, enqueuedAt: time.Now()}
+	if p.tiers[p.clampPriority(priority)].push(item) {
+		p.metrics.tasksSubmitted.Add(1)
+	} else {
+		p.metrics.tasksDropped.Add(1)
+	}
+}
+
+// TrySubmit enqueues data at priority without blocking, returning false (and counting the task
+// as dropped) if that tier is already full.
+func (p *ElasticPoolPri[T]) TrySubmit(priority int, data T) bool {
+	item := queuedItem[T]{data: data, enqueuedAt: time.Now()}
+	if p.tiers[p.clampPriority(priority)].tryPush(item) {
+		p.metrics.tasksSubmitted.Add(1)
+		return true
+	}
+	p.metrics.tasksDropped.Add(1)
+	return false
+}
+
+func (p *ElasticPoolPri[T]) Start() error {
+	if p.processor == nil {
+		return fmt.Errorf("processor not registered")
+	}
+	for i := int32(0); i < p.config.Load().MinWorkers; i++ {
+		go p.startWorker()
+	}
+	go p.startMonitor()
+	return nil
+}
+
+// popNext returns the highest-priority queued item available, checking tier 0 before falling
+// through to lower tiers, so a worker never picks up lower-priority work while higher-priority
+// work is waiting.
+func (p *ElasticPoolPri[T]) popNext() (queuedItem[T], bool) {
+	for _, tier := range p.tiers {
+		if item, ok := tier.popLIFO(); ok {
+			return item, true
+		}
+	}
+	return queuedItem[T]{}, false
+}
+
+func (p *ElasticPoolPri[T]) queueLen() int {
+	total := 0
+	for _, t := range p.tiers {
+		total += t.len()
+	}
+	return total
+}
+
+func (p *ElasticPoolPri[T]) totalCapacity() int {
+	total := 0
+	for _, t := range p.tiers {
+		total += t.capacity()
+	}
+	return total
+}
+
+func (p *ElasticPoolPri[T]) startWorker() {
+	runtime.LockOSThread()
+	p.workerCount.Add(1)
+	defer p.workerCount.Add(-1)
+
+	poll := time.NewTicker(p.config.Load().BackoffTime)
+	defer poll.Stop()
+	idleSince := time.Now()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-p.scaleDown:
+			if p.workerCount.Load() > p.config.Load().MinWorkers {
+				return
+			}
+		default:
+		}
+
+		item, ok := p.popNext()
+		if ok {
+			idleSince = time.Now()
+			p.runTask(item)
+			continue
+		}
+
+		if time.Since(idleSince) > p.config.Load().IdleTimeout && p.workerCount.Load() > p.config.Load().MinWorkers {
+			return
+		}
+
+		select {
+		case <-p.done:
+			return
+		case <-p.scaleDown:
+			if p.workerCount.Load() > p.config.Load().MinWorkers {
+				return
+			}
+		case <-poll.C:
+		}
+	}
+}
+
+func (p *ElasticPoolPri[T]) runTask(item queuedItem[T]) {
+	queueWait := time.Since(item.enqueuedAt)
+	wallStart := time.Now()
+	cpuBefore, _ := rusageThreadNs()
+
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				p.metrics.panics.Add(1)
+				p.logger.Errorf("worker recovered from panic: %v", r)
+			}
+		}()
+		p.processor(item.data)
+	}()
+
+	cpuAfter, _ := rusageThreadNs()
+	p.metrics.record(time.Duration(cpuAfter-cpuBefore), time.Since(wallStart), queueWait)
+}
+
+func (p *ElasticPoolPri[T]) startMonitor() {
+	ticker := time.NewTicker(p.config.Load().ScaleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			cfg := p.config.Load()
+			depth := p.queueLen()
+			p.metrics.observeQueueDepth(depth)
+			currentWorkers := p.workerCount.Load()
+			if depth > p.totalCapacity()/2 && currentWorkers < cfg.MaxWorkers {
+				go p.startWorker()
+			}
+		}
+	}
+}
+
+func (p *ElasticPoolPri[T]) Close() error {
+	close(p.done)
+	for _, t := range p.tiers {
+		t.close()
+	}
+	return nil
+}
@@ -226,17 +226,66 @@ func TestElasticPool_ConfigValidation(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			pool := NewElasticPool[int](tt.config)
 
-			if tt.config.QueueSize == 0 && cap(pool.taskQueue) != 1024 {
-				t.Errorf("Expected default queue size 1024, got %d", cap(pool.taskQueue))
+			if tt.config.QueueSize == 0 && pool.config.Load().QueueSize != 1024 {
+				t.Errorf("Expected default queue size 1024, got %d", pool.config.Load().QueueSize)
 			}
 
-			if tt.config.MinWorkers == 0 && pool.config.MinWorkers != 1 {
-				t.Errorf("Expected default min workers 1, got %d", pool.config.MinWorkers)
+			if tt.config.MinWorkers == 0 && pool.config.Load().MinWorkers != 1 {
+				t.Errorf("Expected default min workers 1, got %d", pool.config.Load().MinWorkers)
 			}
 		})
 	}
 }
 
+func TestElasticPool_Reconfigure(t *testing.T) {
+	config := PoolConfig{
+		QueueSize:     10,
+		MinWorkers:    1,
+		MaxWorkers:    2,
+		ScaleInterval: 50 * time.Millisecond,
+		IdleTimeout:   200 * time.Millisecond,
+		BackoffTime:   5 * time.Millisecond,
+	}
+
+	pool := NewElasticPool[int](config)
+	pool.SetProcessor(func(task int) { time.Sleep(10 * time.Millisecond) })
+	pool.SetProducer(func(submit func(int)) {})
+
+	if err := pool.Start(); err != nil {
+		t.Fatalf("Failed to start pool: %v", err)
+	}
+
+	pool.Reconfigure(PoolConfig{MinWorkers: 2, MaxWorkers: 4, QueueSize: 40})
+
+	if got := pool.Config(); got.MinWorkers != 2 || got.MaxWorkers != 4 || got.QueueSize != 40 {
+		t.Errorf("Reconfigure did not apply: got %+v", got)
+	}
+
+	deadline := time.After(time.Second)
+	for pool.workerCount.Load() < 2 {
+		select {
+		case <-deadline:
+			t.Fatalf("expected worker count to reach new MinWorkers, got %d", pool.workerCount.Load())
+		default:
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// QueueSize is split evenly across shards, rounded down, with at least 1 per shard
+	wantCap := 40 / len(pool.shards)
+	if wantCap < 1 {
+		wantCap = 1
+	}
+	wantCap *= len(pool.shards)
+	if got := pool.totalCapacity(); got != wantCap {
+		t.Errorf("expected total shard capacity %d after QueueSize 40, got %d", wantCap, got)
+	}
+
+	if err := pool.Close(); err != nil {
+		t.Fatalf("Failed to close pool: %v", err)
+	}
+}
+
 func TestElasticPool_StressTest(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping stress test in short mode")
@@ -708,6 +757,44 @@ func BenchmarkComplexCalculations(b *testing.B) {
 		})
 	}
 
+	// SingleChannelPool is a minimal stand-in for ElasticPool's pre-sharding design: one shared
+	// buffered channel feeding every worker, with no LIFO locality or work-stealing. Comparing it
+	// against the sharded "ElasticPool" run below shows what the per-shard queues buy under
+	// contention from many concurrent workers hammering a single channel.
+	b.Run("SingleChannelPool", func(b *testing.B) {
+		start := time.Now()
+		taskChan := make(chan int, 10000)
+		var wg sync.WaitGroup
+		workers := runtime.NumCPU() * 2
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range taskChan {
+					complexCalculation()
+				}
+			}()
+		}
+
+		for i := 0; i < totalTasks; i++ {
+			taskChan <- i
+		}
+		close(taskChan)
+		wg.Wait()
+
+		duration := time.Since(start)
+		memAfter := getMemStats()
+		results["SingleChannelPool"] = struct {
+			duration  time.Duration
+			opsPerSec float64
+			memStats  runtime.MemStats
+		}{
+			duration:  duration,
+			opsPerSec: float64(totalTasks) / duration.Seconds(),
+			memStats:  memAfter,
+		}
+	})
+
 	b.Run("ElasticPool", func(b *testing.B) {
 		config := PoolConfig{
 			QueueSize:     10000,
@@ -744,7 +831,7 @@ func BenchmarkComplexCalculations(b *testing.B) {
 			case <-deadline:
 				b.Fatal("Timeout waiting for tasks to complete")
 			case <-ticker.C:
-				if len(pool.taskQueue) == 0 {
+				if pool.queueLen() == 0 {
 					duration := time.Since(start)
 					memAfter := getMemStats()
 					results["ElasticPool"] = struct {
@@ -779,3 +866,83 @@ func BenchmarkComplexCalculations(b *testing.B) {
 		)
 	}
 }
+
+// benchEvent stands in for a payload like *types.PacketInfo: a small fixed-size struct that's
+// cheap to process but, allocated fresh per event at high rates, generates a lot of GC pressure.
+type benchEvent struct {
+	data [64]byte
+	seq  int
+}
+
+// BenchmarkObjectPooling compares GC pressure across a synthetic 1M-event stream with and without
+// WithObjectPool, demonstrating the Alloc/NumGC reduction it buys for allocation-heavy payload
+// types such as *types.PacketInfo.
+func BenchmarkObjectPooling(b *testing.B) {
+	const events = 1_000_000
+
+	run := func(b *testing.B, withPool bool) (allocDelta uint64, gcDelta uint32) {
+		config := PoolConfig{
+			QueueSize:     10000,
+			MinWorkers:    int32(runtime.NumCPU()),
+			MaxWorkers:    int32(runtime.NumCPU()),
+			ScaleInterval: 10 * time.Millisecond,
+			IdleTimeout:   10 * time.Millisecond,
+			BackoffTime:   10 * time.Millisecond,
+		}
+
+		var pool *ElasticPool[*benchEvent]
+		if withPool {
+			pool = NewElasticPool[*benchEvent](config, WithObjectPool(
+				func() *benchEvent { return &benchEvent{} },
+				func(e *benchEvent) { *e = benchEvent{} },
+			))
+		} else {
+			pool = NewElasticPool[*benchEvent](config)
+		}
+
+		var processed atomic.Int64
+		pool.SetProcessor(func(e *benchEvent) {
+			_ = e.seq
+			processed.Add(1)
+		})
+		pool.SetProducer(func(submit func(*benchEvent)) {
+			for i := 0; i < events; i++ {
+				var e *benchEvent
+				if withPool {
+					e = pool.Get()
+					e.seq = i
+				} else {
+					e = &benchEvent{seq: i}
+				}
+				submit(e)
+			}
+		})
+
+		var before runtime.MemStats
+		runtime.ReadMemStats(&before)
+
+		if err := pool.Start(); err != nil {
+			b.Fatalf("Failed to start pool: %v", err)
+		}
+		for processed.Load() < events {
+			time.Sleep(time.Millisecond)
+		}
+		pool.Close()
+
+		var after runtime.MemStats
+		runtime.ReadMemStats(&after)
+		return after.TotalAlloc - before.TotalAlloc, after.NumGC - before.NumGC
+	}
+
+	b.Run("WithoutPool", func(b *testing.B) {
+		alloc, gc := run(b, false)
+		b.ReportMetric(float64(alloc)/float64(events), "bytes/event")
+		b.ReportMetric(float64(gc), "gc-runs")
+	})
+
+	b.Run("WithPool", func(b *testing.B) {
+		alloc, gc := run(b, true)
+		b.ReportMetric(float64(alloc)/float64(events), "bytes/event")
+		b.ReportMetric(float64(gc), "gc-runs")
+	})
+}
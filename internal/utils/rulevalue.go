@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// RuleValue wraps the (bytes, IPType) pair ParseValueToBytes produces so rule values loaded from
+// config/API and serialized back out don't have to carry around the original string or re-invoke
+// ParseValueToBytes by hand. It implements encoding.TextMarshaler/TextUnmarshaler and
+// json.Marshaler/Unmarshaler; the wire form is always the canonical text representation
+// (netip.Addr.String() for addresses, prefix.Masked().String() for CIDRs, colon-lowered MAC via
+// net.HardwareAddr.String()), never the original, possibly non-canonical, input string.
+type RuleValue struct {
+	bytes  []byte
+	ipType IPType
+}
+
+// NewRuleValue parses value via ParseValueToBytes, so validation stays in one place.
+func NewRuleValue(value string) (RuleValue, error) {
+	b, iptype, err := ParseValueToBytes(value)
+	if err != nil {
+		return RuleValue{}, err
+	}
+	return RuleValue{bytes: b, ipType: iptype}, nil
+}
+
+// Bytes returns the wire-format key bytes ParseValueToBytes produced, ready for the eBPF map
+// calls in internal/ebpf.
+func (v RuleValue) Bytes() []byte {
+	return v.bytes
+}
+
+// IPType returns the IPType tag describing how to interpret Bytes.
+func (v RuleValue) IPType() IPType {
+	return v.ipType
+}
+
+// MarshalText implements encoding.TextMarshaler, producing the canonical string form of v.
+func (v RuleValue) MarshalText() ([]byte, error) {
+	s, err := v.canonicalString()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(s), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, delegating to ParseValueToBytes so a
+// RuleValue decoded from YAML/JSON validates exactly the same way a rule entered through the API
+// would.
+func (v *RuleValue) UnmarshalText(text []byte) error {
+	b, iptype, err := ParseValueToBytes(string(text))
+	if err != nil {
+		return err
+	}
+	v.bytes = b
+	v.ipType = iptype
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler by writing the canonical string form as a JSON string.
+func (v RuleValue) MarshalJSON() ([]byte, error) {
+	text, err := v.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(text))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, accepting only a JSON string and delegating to
+// UnmarshalText.
+func (v *RuleValue) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return v.UnmarshalText([]byte(s))
+}
+
+// canonicalString renders v's bytes back into the canonical text form for its IPType - the
+// inverse of ParseValueToBytes/ParseValueToBytesWithOpts for every IPType they can produce.
+func (v RuleValue) canonicalString() (string, error) {
+	switch v.ipType {
+	case IPTypeIPv4, IPTypeIPv6:
+		addr, ok := netip.AddrFromSlice(v.bytes)
+		if !ok {
+			return "", fmt.Errorf("rule value: malformed %v bytes", v.ipType)
+		}
+		return addr.String(), nil
+	case IPTypeIPV4CIDR, IPTypeIPv6CIDR:
+		prefix, err := decodePrefixBytes(v.bytes)
+		if err != nil {
+			return "", err
+		}
+		return prefix.Masked().String(), nil
+	case IPTypeMAC:
+		return net.HardwareAddr(v.bytes).String(), nil
+	case IPTypeIPv4Range, IPTypeIPv6Range:
+		half := len(v.bytes) / 2
+		start, ok := netip.AddrFromSlice(v.bytes[:half])
+		if !ok {
+			return "", fmt.Errorf("rule value: malformed %v bytes", v.ipType)
+		}
+		end, ok := netip.AddrFromSlice(v.bytes[half:])
+		if !ok {
+			return "", fmt.Errorf("rule value: malformed %v bytes", v.ipType)
+		}
+		return fmt.Sprintf("%s-%s", start, end), nil
+	case IPTypeIPv4Port, IPTypeIPv6Port:
+		addrBytes := v.bytes[:len(v.bytes)-4]
+		addr, ok := netip.AddrFromSlice(addrBytes)
+		if !ok {
+			return "", fmt.Errorf("rule value: malformed %v bytes", v.ipType)
+		}
+		lo, hi := decodePort(v.bytes[len(addrBytes):])
+		return formatHostPort(addr.String(), addr.Is6(), lo, hi), nil
+	case IPTypeIPv4CIDRPortRange, IPTypeIPv6CIDRPortRange:
+		lo, hi := decodePort(v.bytes[len(v.bytes)-4:])
+		prefix, err := decodePrefixBytes(v.bytes[:len(v.bytes)-4])
+		if err != nil {
+			return "", err
+		}
+		return formatHostPort(prefix.Masked().String(), prefix.Addr().Is6(), lo, hi), nil
+	case IPTypeIPv6Zone, IPTypeIPv6CIDRZone:
+		return decodeZoneBytes(v.bytes, v.ipType)
+	default:
+		return "", fmt.Errorf("rule value: unsupported IPType %v", v.ipType)
+	}
+}
+
+// decodePrefixBytes is the inverse of prefixToBytes: [bits(4, little-endian)|addr].
+func decodePrefixBytes(b []byte) (netip.Prefix, error) {
+	if len(b) < 4 {
+		return netip.Prefix{}, fmt.Errorf("rule value: malformed CIDR bytes")
+	}
+	bits := int(binary.LittleEndian.Uint32(b[:4]))
+	addr, ok := netip.AddrFromSlice(b[4:])
+	if !ok {
+		return netip.Prefix{}, fmt.Errorf("rule value: malformed CIDR bytes")
+	}
+	return netip.PrefixFrom(addr, bits), nil
+}
+
+// decodePort is the inverse of putPort.
+func decodePort(b []byte) (lo, hi uint16) {
+	return binary.LittleEndian.Uint16(b[:2]), binary.LittleEndian.Uint16(b[2:4])
+}
+
+// formatHostPort renders an "addr:port" or "addr:lo-hi" pair, bracketing the address when it's
+// IPv6 so it round-trips through net.SplitHostPort the same way the original input did.
+func formatHostPort(addr string, isV6 bool, lo, hi uint16) string {
+	if isV6 {
+		addr = "[" + addr + "]"
+	}
+	if lo == hi {
+		return fmt.Sprintf("%s:%d", addr, lo)
+	}
+	return fmt.Sprintf("%s:%d-%d", addr, lo, hi)
+}
+
+// decodeZoneBytes is the inverse of encodeZonedAddr: [prefixLen(4)|addr(16)|ifindex(4)].
+func decodeZoneBytes(b []byte, ipType IPType) (string, error) {
+	if len(b) != 4+16+4 {
+		return "", fmt.Errorf("rule value: malformed zone bytes")
+	}
+	bits := int(binary.LittleEndian.Uint32(b[:4]))
+	addr, ok := netip.AddrFromSlice(b[4:20])
+	if !ok {
+		return "", fmt.Errorf("rule value: malformed zone bytes")
+	}
+	ifindex := int(binary.LittleEndian.Uint32(b[20:]))
+	zone := fmt.Sprintf("%d", ifindex)
+	if iface, err := net.InterfaceByIndex(ifindex); err == nil {
+		zone = iface.Name
+	}
+	addr = addr.WithZone(zone)
+	if ipType == IPTypeIPv6Zone {
+		return addr.String(), nil
+	}
+	// netip.Prefix.Masked() strips the zone from its result address, and netip.Prefix.String()
+	// never renders one even when present, so the zoned CIDR has to be rendered by hand from the
+	// masked address's own (zone-carrying) String().
+	masked := netip.PrefixFrom(addr.WithZone(""), bits).Masked()
+	return fmt.Sprintf("%s/%d", masked.Addr().WithZone(zone), masked.Bits()), nil
+}
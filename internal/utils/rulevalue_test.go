@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRuleValueTextRoundTrip(t *testing.T) {
+	inputs := []string{
+		"192.168.1.1",
+		"2001:db8::1",
+		"192.168.1.0/24",
+		"2001:db8::/32",
+		"00:11:22:33:44:55",
+		"192.168.1.10-192.168.1.20",
+		"10.0.0.1:443",
+		"[2001:db8::1]:8080",
+		"10.0.0.0/24:1000-2000",
+		"fe80::1%lo",
+	}
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			v, err := NewRuleValue(input)
+			if err != nil {
+				t.Fatalf("NewRuleValue(%q) error = %v", input, err)
+			}
+			text, err := v.MarshalText()
+			if err != nil {
+				t.Fatalf("MarshalText() error = %v", err)
+			}
+			var round RuleValue
+			if err := round.UnmarshalText(text); err != nil {
+				t.Fatalf("UnmarshalText(%q) error = %v", text, err)
+			}
+			if round.IPType() != v.IPType() || string(round.Bytes()) != string(v.Bytes()) {
+				t.Errorf("round trip mismatch: got %v/%v, want %v/%v", round.IPType(), round.Bytes(), v.IPType(), v.Bytes())
+			}
+		})
+	}
+}
+
+func TestRuleValueJSONRoundTrip(t *testing.T) {
+	v, err := NewRuleValue("192.168.1.0/24")
+	if err != nil {
+		t.Fatalf("NewRuleValue() error = %v", err)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if string(data) != `"192.168.1.0/24"` {
+		t.Errorf("json.Marshal() = %s, want %q", data, "192.168.1.0/24")
+	}
+	var round RuleValue
+	if err := json.Unmarshal(data, &round); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if round.IPType() != v.IPType() || string(round.Bytes()) != string(v.Bytes()) {
+		t.Errorf("round trip mismatch: got %v/%v, want %v/%v", round.IPType(), round.Bytes(), v.IPType(), v.Bytes())
+	}
+}
+
+// FuzzRuleValueRoundTrip asserts Parse -> Marshal -> Parse is idempotent for every input class
+// ParseValueToBytes accepts: once a value parses successfully, its canonical text form must
+// parse back to the identical (bytes, IPType) pair.
+func FuzzRuleValueRoundTrip(f *testing.F) {
+	seeds := []string{
+		"192.168.1.1",
+		"0.0.0.0",
+		"255.255.255.255",
+		"2001:db8::1",
+		"::",
+		"192.168.1.0/24",
+		"2001:db8::/32",
+		"00:11:22:33:44:55",
+		"192.168.1.10-192.168.1.20",
+		"2001:db8::1-2001:db8::ff",
+		"10.0.0.1:443",
+		"10.0.0.1:1000-2000",
+		"[2001:db8::1]:8080",
+		"10.0.0.0/24:1000-2000",
+		"::ffff:192.168.1.1",
+		"::ffff:192.168.1.0/120",
+		"fe80::1%lo",
+		"fe80::%lo/64",
+		"not an ip",
+	}
+	for _, s := range seeds {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		v, err := NewRuleValue(input)
+		if err != nil {
+			return
+		}
+		text, err := v.MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText(%q) error = %v", input, err)
+		}
+		var round RuleValue
+		if err := round.UnmarshalText(text); err != nil {
+			t.Fatalf("UnmarshalText(%q) (from %q) error = %v", text, input, err)
+		}
+		if round.IPType() != v.IPType() || string(round.Bytes()) != string(v.Bytes()) {
+			t.Errorf("Parse->Marshal->Parse not idempotent for %q: got %v/%v via %q, want %v/%v", input, round.IPType(), round.Bytes(), text, v.IPType(), v.Bytes())
+		}
+	})
+}
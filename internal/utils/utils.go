@@ -12,7 +12,9 @@ import (
 	"math/rand"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -39,24 +41,26 @@ var (
 		"240.0.0.0/4",
 		"255.255.255.255/32",
 	}
-	localIPNets []*net.IPNet
+	localPrefixes []netip.Prefix
 )
 
 func init() {
 	for _, ip := range localIPs {
-		_, ipNet, err := net.ParseCIDR(ip)
+		prefix, err := netip.ParsePrefix(ip)
 		if err != nil {
 			continue
 		}
-		localIPNets = append(localIPNets, ipNet)
+		localPrefixes = append(localPrefixes, prefix)
 	}
 }
 
 func IsLocalIP(ip string) bool {
-	ip = strings.TrimSpace(ip)
-	ipNet := net.ParseIP(ip)
-	for _, localIPNet := range localIPNets {
-		if localIPNet.Contains(ipNet) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return false
+	}
+	for _, prefix := range localPrefixes {
+		if prefix.Contains(addr) {
 			return true
 		}
 	}
@@ -99,11 +103,13 @@ func IsValidMAC(mac string) bool {
 }
 
 func IsValidIPv4(ip string) bool {
-	return net.ParseIP(ip) != nil && net.ParseIP(ip).To4() != nil
+	addr, err := parseStrictAddr(ip)
+	return err == nil && addr.Is4()
 }
 
 func IsValidIPv6(ip string) bool {
-	return net.ParseIP(ip) != nil && net.ParseIP(ip).To4() == nil
+	addr, err := parseStrictAddr(ip)
+	return err == nil && addr.Is6()
 }
 
 func MD5(data string) string {
@@ -125,72 +131,372 @@ const (
 	IPTypeIPv6     IPType = 3
 	IPTypeIPv6CIDR IPType = 4
 	IPTypeMAC      IPType = 5
+
+	// IPTypeIPv4Range and IPTypeIPv6Range cover address ranges such as
+	// "192.168.1.10-192.168.1.20" or "2001:db8::1-2001:db8::ff". Layout: [start|end], with
+	// start/end each 4 bytes for v4 or 16 bytes for v6.
+	IPTypeIPv4Range IPType = 6
+	IPTypeIPv6Range IPType = 7
+
+	// IPTypeIPv4Port and IPTypeIPv6Port cover "ip:port" / "ip:port-port" forms modeled on
+	// netip.AddrPort (e.g. "10.0.0.1:443", "[2001:db8::1]:8080"). Layout: [ip|portLo(2)|portHi(2)],
+	// little-endian; portLo == portHi for a single port.
+	IPTypeIPv4Port IPType = 8
+	IPTypeIPv6Port IPType = 9
+
+	// IPTypeIPv4CIDRPortRange and IPTypeIPv6CIDRPortRange cover "cidr:port-port" forms (e.g.
+	// "10.0.0.0/24:1000-2000"). Layout: [ones(4)|ip|portLo(2)|portHi(2)], all little-endian.
+	IPTypeIPv4CIDRPortRange IPType = 10
+	IPTypeIPv6CIDRPortRange IPType = 11
+
+	// IPTypeIPv6Zone and IPTypeIPv6CIDRZone cover RFC 4007 scoped addresses such as
+	// "fe80::1%eth0" or "fe80::%eth0/64", where the zone disambiguates which link the
+	// link-local address belongs to. Layout: [prefixLen(4)|addr(16)|ifindex(4)], little-endian;
+	// prefixLen is 128 for a bare address. The zone is resolved to an interface index at parse
+	// time so the eBPF side never has to do string matching on the hot path.
+	IPTypeIPv6Zone     IPType = 12
+	IPTypeIPv6CIDRZone IPType = 13
 )
 
+// ParseStringToIPType classifies value as a bare IP, CIDR or MAC address, without allocating an
+// intermediate net.IP/net.IPNet the way the pre-netip version of this function did.
 func ParseStringToIPType(value string) IPType {
 	value = strings.TrimSpace(value)
-	_, ipNet, err := net.ParseCIDR(value)
-	if err != nil {
-		ip := net.ParseIP(value)
-		if ip == nil {
-			_, err := net.ParseMAC(value)
-			if err != nil {
-				return IPTypeUnknown
-			}
-			return IPTypeMAC
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		if prefix.Addr().Is4() {
+			return IPTypeIPV4CIDR
 		}
-		if ip.To4() != nil {
+		return IPTypeIPv6CIDR
+	}
+	if addr, err := parseStrictAddr(value); err == nil {
+		if addr.Is4() {
 			return IPTypeIPv4
-		} else {
-			return IPTypeIPv6
 		}
+		return IPTypeIPv6
 	}
-	if ipNet.IP.To4() != nil {
-		return IPTypeIPV4CIDR
-	} else if ipNet.IP.To16() != nil {
-		return IPTypeIPv6CIDR
+	if _, err := net.ParseMAC(value); err == nil {
+		return IPTypeMAC
 	}
 	return IPTypeUnknown
 }
 
+// parseStrictAddr wraps netip.ParseAddr with the invariants the rest of this package relies on:
+// no zone IDs (scoped addresses are accepted only by parseZonedValue) and no
+// IPv4-mapped IPv6 addresses (they're ambiguous with plain IPv4 for map-key purposes).
+func parseStrictAddr(value string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if addr.Zone() != "" {
+		return netip.Addr{}, fmt.Errorf("zone-id addresses are not supported: %s", value)
+	}
+	if addr.Is4In6() {
+		return netip.Addr{}, fmt.Errorf("invalid address: %s", value)
+	}
+	return addr, nil
+}
+
+// parseAddrForValue parses a single address for ParseValueToBytes. Unlike parseStrictAddr, it
+// accepts IPv4-mapped IPv6 addresses ("::ffff:192.168.1.1", "::ffff:7f01:0203") and unmaps them
+// to plain IPv4: dual-stack kernels routinely present v4 flows that way once a socket is v6-only,
+// and a rule keyed on the mapped form would silently never match the v4 LPM map the eBPF side
+// actually consults.
+func parseAddrForValue(value string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if addr.Zone() != "" {
+		return netip.Addr{}, fmt.Errorf("zone-id addresses are not supported: %s", value)
+	}
+	if addr.Is4In6() {
+		return addr.Unmap(), nil
+	}
+	return addr, nil
+}
+
+// ParsePrefix parses value as a CIDR, applying the same strictness as ParseValueToBytes (no zone
+// IDs). IPv4-mapped IPv6 prefixes ("::ffff:192.168.1.0/120") are unmapped down to their IPv4
+// equivalent ("192.168.1.0/24") rather than rejected - see parseAddrForValue for why. The
+// returned prefix is masked, so its Addr is the network address rather than whatever host
+// address the caller wrote before the slash.
+func ParsePrefix(value string) (netip.Prefix, IPType, error) {
+	prefix, err := netip.ParsePrefix(strings.TrimSpace(value))
+	if err != nil {
+		return netip.Prefix{}, IPTypeUnknown, err
+	}
+	addr := prefix.Addr()
+	if addr.Zone() != "" {
+		return netip.Prefix{}, IPTypeUnknown, fmt.Errorf("zone-id addresses are not supported: %s", value)
+	}
+	switch {
+	case addr.Is4():
+		return prefix.Masked(), IPTypeIPV4CIDR, nil
+	case addr.Is4In6():
+		// The mapped prefix constant "::ffff:0:0" occupies the first 96 bits, so a prefix
+		// shorter than /96 can't unambiguously narrow to an IPv4 network.
+		if prefix.Bits() < 96 {
+			return netip.Prefix{}, IPTypeUnknown, fmt.Errorf("invalid prefix: %s", value)
+		}
+		unmapped := netip.PrefixFrom(addr.Unmap(), prefix.Bits()-96)
+		return unmapped.Masked(), IPTypeIPV4CIDR, nil
+	case addr.Is6():
+		return prefix.Masked(), IPTypeIPv6CIDR, nil
+	default:
+		return netip.Prefix{}, IPTypeUnknown, fmt.Errorf("invalid prefix: %s", value)
+	}
+}
+
+// AddrToKeyBytes returns addr's raw address bytes - 4 for IPv4, 16 for IPv6 - the same
+// comparable, allocation-free form used as the map key for hot-path rule lookups and as the
+// value written into the eBPF maps in internal/ebpf.
+func AddrToKeyBytes(addr netip.Addr) []byte {
+	return addr.AsSlice()
+}
+
+// prefixToBytes encodes prefix in this package's wire format: [bits(4, little-endian)|addr].
+func prefixToBytes(prefix netip.Prefix) []byte {
+	addrBytes := AddrToKeyBytes(prefix.Addr())
+	out := make([]byte, 4+len(addrBytes))
+	binary.LittleEndian.PutUint32(out[:4], uint32(prefix.Bits()))
+	copy(out[4:], addrBytes)
+	return out
+}
+
+// PrefixToKeyBytes is the exported form of prefixToBytes, for callers that already hold a
+// netip.Prefix (e.g. from the threat-intel aggregator) and want the same LPM_TRIE-ready wire
+// format ParseValueToBytes produces for a CIDR rule, without a round trip through its string form.
+func PrefixToKeyBytes(prefix netip.Prefix) []byte {
+	return prefixToBytes(prefix)
+}
+
+// ParseValueToBytesOpts configures ParseValueToBytesWithOpts. AllowZone controls whether
+// zone-scoped IPv6 addresses ("fe80::1%eth0") are accepted; ParseValueToBytes sets it true.
+type ParseValueToBytesOpts struct {
+	AllowZone bool
+}
+
+// ParseValueToBytes is ParseValueToBytesWithOpts with AllowZone enabled, the default for rule
+// values coming in through the API and config file.
 func ParseValueToBytes(value string) ([]byte, IPType, error) {
+	return ParseValueToBytesWithOpts(value, ParseValueToBytesOpts{AllowZone: true})
+}
+
+// ParseValueToBytesWithOpts is ParseValueToBytes with opts to opt out of newer parsing behavior -
+// e.g. ParseValueToBytesOpts{AllowZone: false} to keep rejecting zone-scoped addresses the way
+// ParseValueToBytes did before zone support was added.
+func ParseValueToBytesWithOpts(value string, opts ParseValueToBytesOpts) ([]byte, IPType, error) {
 	value = strings.TrimSpace(value)
-	// try to parse as CIDR
-	_, ipNet, err := net.ParseCIDR(value)
+	if opts.AllowZone {
+		if b, iptype, ok, err := parseZonedValue(value); ok {
+			return b, iptype, err
+		}
+	}
+	if host, portSpec, ok := splitHostPortValue(value); ok {
+		return parseHostPortValue(host, portSpec)
+	}
+	if start, end, ok := splitRangeValue(value); ok {
+		return parseRangeValue(start, end)
+	}
+	if prefix, iptype, err := ParsePrefix(value); err == nil {
+		return prefixToBytes(prefix), iptype, nil
+	}
+	if addr, err := parseAddrForValue(value); err == nil {
+		if addr.Is4() {
+			return AddrToKeyBytes(addr), IPTypeIPv4, nil
+		}
+		return AddrToKeyBytes(addr), IPTypeIPv6, nil
+	}
+	macAddr, err := net.ParseMAC(value)
 	if err != nil {
-		// try to parse as IP
-		ip := net.ParseIP(value)
-		if ip == nil {
-			// try to parse as MAC
-			macAddr, err := net.ParseMAC(value)
-			if err != nil {
-				return nil, IPTypeUnknown, fmt.Errorf("invalid value: %s", value)
-			}
+		return nil, IPTypeUnknown, fmt.Errorf("invalid value: %s", value)
+	}
+	return macAddr, IPTypeMAC, nil
+}
+
+// splitHostPortValue recognizes "ip:port", "ip:port-port" and "cidr:port-port" forms, modeled
+// on net/netip.AddrPort's bracketed-IPv6 syntax. It reports ok=false for anything that isn't
+// unambiguously a host:port pair, e.g. a bare IPv6 address (which net.SplitHostPort rejects as
+// having too many colons) or a MAC address.
+func splitHostPortValue(value string) (host, portSpec string, ok bool) {
+	host, portSpec, err := net.SplitHostPort(value)
+	if err != nil {
+		return "", "", false
+	}
+	return host, portSpec, true
+}
+
+// splitRangeValue recognizes "start-end" address ranges. It reports ok=false unless value is
+// exactly two dash-separated, parseable addresses, so it doesn't steal dash-delimited MAC
+// addresses (six groups) from the fallback parser below.
+func splitRangeValue(value string) (start, end string, ok bool) {
+	parts := strings.Split(value, "-")
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	start, end = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	if _, err := netip.ParseAddr(start); err != nil {
+		return "", "", false
+	}
+	if _, err := netip.ParseAddr(end); err != nil {
+		return "", "", false
+	}
+	return start, end, true
+}
+
+func parsePortSpec(portSpec string) (lo, hi uint16, err error) {
+	parts := strings.SplitN(portSpec, "-", 2)
+	loInt, err := strconv.Atoi(parts[0])
+	if err != nil || loInt < 1 || loInt > 65535 {
+		return 0, 0, fmt.Errorf("invalid port: %s", parts[0])
+	}
+	if len(parts) == 1 {
+		return uint16(loInt), uint16(loInt), nil
+	}
+	hiInt, err := strconv.Atoi(parts[1])
+	if err != nil || hiInt < 1 || hiInt > 65535 {
+		return 0, 0, fmt.Errorf("invalid port: %s", parts[1])
+	}
+	if loInt > hiInt {
+		return 0, 0, fmt.Errorf("port range start %d is greater than end %d", loInt, hiInt)
+	}
+	return uint16(loInt), uint16(hiInt), nil
+}
 
-			return macAddr, IPTypeMAC, nil
+func putPort(b []byte, lo, hi uint16) {
+	binary.LittleEndian.PutUint16(b[:2], lo)
+	binary.LittleEndian.PutUint16(b[2:4], hi)
+}
+
+func parseHostPortValue(host, portSpec string) ([]byte, IPType, error) {
+	lo, hi, err := parsePortSpec(portSpec)
+	if err != nil {
+		return nil, IPTypeUnknown, err
+	}
+	if prefix, iptype, err := ParsePrefix(host); err == nil {
+		prefixBytes := prefixToBytes(prefix)
+		out := make([]byte, len(prefixBytes)+4)
+		copy(out, prefixBytes)
+		putPort(out[len(prefixBytes):], lo, hi)
+		if iptype == IPTypeIPV4CIDR {
+			return out, IPTypeIPv4CIDRPortRange, nil
 		}
-		if ip.To4() != nil && len(ip) == net.IPv4len {
-			return ip.To4(), IPTypeIPv4, nil
-		} else if ip.To16() != nil && len(ip) == net.IPv6len {
-			return ip.To16(), IPTypeIPv6, nil
-		} else {
-			return nil, IPTypeUnknown, fmt.Errorf("invalid value: %s", value)
+		return out, IPTypeIPv6CIDRPortRange, nil
+	}
+	addr, err := parseStrictAddr(host)
+	if err != nil {
+		return nil, IPTypeUnknown, fmt.Errorf("invalid host: %s", host)
+	}
+	addrBytes := AddrToKeyBytes(addr)
+	out := make([]byte, len(addrBytes)+4)
+	copy(out, addrBytes)
+	putPort(out[len(addrBytes):], lo, hi)
+	if addr.Is4() {
+		return out, IPTypeIPv4Port, nil
+	}
+	return out, IPTypeIPv6Port, nil
+}
+
+func parseRangeValue(start, end string) ([]byte, IPType, error) {
+	startAddr, err := parseStrictAddr(start)
+	if err != nil {
+		return nil, IPTypeUnknown, err
+	}
+	endAddr, err := parseStrictAddr(end)
+	if err != nil {
+		return nil, IPTypeUnknown, err
+	}
+	if startAddr.Is4() != endAddr.Is4() {
+		return nil, IPTypeUnknown, fmt.Errorf("range endpoints must both be IPv4 or both be IPv6: %s-%s", start, end)
+	}
+	if startAddr.Compare(endAddr) > 0 {
+		return nil, IPTypeUnknown, fmt.Errorf("range start %s is greater than end %s", start, end)
+	}
+	startBytes, endBytes := AddrToKeyBytes(startAddr), AddrToKeyBytes(endAddr)
+	out := make([]byte, len(startBytes)+len(endBytes))
+	copy(out, startBytes)
+	copy(out[len(startBytes):], endBytes)
+	if startAddr.Is4() {
+		return out, IPTypeIPv4Range, nil
+	}
+	return out, IPTypeIPv6Range, nil
+}
+
+// parseZonedValue recognizes RFC 4007 scoped IPv6 addresses ("fe80::1%eth0") and scoped IPv6
+// CIDRs ("fe80::%eth0/64"). ok is false when value carries no zone, so the caller falls through
+// to the unscoped parsers, which reject zone-id addresses outright.
+func parseZonedValue(value string) (b []byte, iptype IPType, ok bool, err error) {
+	addrPart, bitsPart, isCIDR := strings.Cut(value, "/")
+	// A bare zoned address has no "/", so only try ParseAddr when there's none - otherwise it
+	// folds the CIDR's "/bits" suffix into the zone name.
+	if !isCIDR {
+		if addr, perr := netip.ParseAddr(value); perr == nil && addr.Zone() != "" {
+			b, iptype, err = encodeZonedAddr(addr, addr.BitLen())
+			return b, iptype, true, err
 		}
+		return nil, IPTypeUnknown, false, nil
 	}
-	ones, _ := ipNet.Mask.Size()
-	if ipNet.IP.To4() != nil && len(ipNet.IP) == net.IPv4len {
-		var bytes [8]byte
-		binary.LittleEndian.PutUint32(bytes[:4], uint32(ones))
-		copy(bytes[4:], ipNet.IP.To4())
-		return bytes[:], IPTypeIPV4CIDR, nil
-	} else if ipNet.IP.To16() != nil && len(ipNet.IP) == net.IPv6len {
-		var bytes [20]byte
-		binary.LittleEndian.PutUint32(bytes[:4], uint32(ones))
-		copy(bytes[4:], ipNet.IP.To16())
-		return bytes[:], IPTypeIPv6CIDR, nil
-	} else {
-		return nil, IPTypeUnknown, fmt.Errorf("invalid value: %s", value)
+	// netip.ParsePrefix itself rejects any zone in the address part ("IPv6 zones cannot be
+	// present in a prefix"), so a zoned CIDR has to be split and parsed by hand: the address
+	// (with its zone) and the prefix length separately.
+	addr, perr := netip.ParseAddr(addrPart)
+	if perr != nil || addr.Zone() == "" {
+		return nil, IPTypeUnknown, false, nil
+	}
+	bits, berr := strconv.Atoi(bitsPart)
+	if berr != nil || bits < 0 || bits > addr.BitLen() {
+		return nil, IPTypeUnknown, true, fmt.Errorf("invalid prefix length in %q", value)
+	}
+	// netip.Prefix.Masked() strips the zone from its result address, so it has to be
+	// re-attached from the original addr before encodeZonedAddr resolves it.
+	masked := netip.PrefixFrom(addr.WithZone(""), bits).Masked()
+	maskedAddr := masked.Addr().WithZone(addr.Zone())
+	b, iptype, err = encodeZonedAddr(maskedAddr, masked.Bits())
+	return b, iptype, true, err
+}
+
+// encodeZonedAddr resolves addr's zone to an interface index and encodes the
+// [prefixLen(4)|addr(16)|ifindex(4)] wire format IPTypeIPv6Zone/IPTypeIPv6CIDRZone use. Per RFC
+// 4007 §5, a zone only disambiguates a link-local scope, so anything else is rejected.
+func encodeZonedAddr(addr netip.Addr, bits int) ([]byte, IPType, error) {
+	if !addr.Is6() || addr.Is4In6() {
+		return nil, IPTypeUnknown, fmt.Errorf("zone-id addresses are only supported for IPv6: %s", addr)
+	}
+	if !addr.IsLinkLocalUnicast() {
+		return nil, IPTypeUnknown, fmt.Errorf("zone-id is only valid on link-local addresses: %s", addr)
+	}
+	ifindex, err := resolveZoneIndex(addr.Zone())
+	if err != nil {
+		return nil, IPTypeUnknown, err
+	}
+	out := make([]byte, 4+16+4)
+	binary.LittleEndian.PutUint32(out[:4], uint32(bits))
+	copy(out[4:20], addr.AsSlice())
+	binary.LittleEndian.PutUint32(out[20:], uint32(ifindex))
+	if bits == addr.BitLen() {
+		return out, IPTypeIPv6Zone, nil
+	}
+	return out, IPTypeIPv6CIDRZone, nil
+}
+
+// resolveZoneIndex resolves a zone name to an interface index, accepting both interface names
+// ("eth0") and the numeric ifindex form some platforms use directly as the zone.
+func resolveZoneIndex(zone string) (int, error) {
+	if n, err := strconv.Atoi(zone); err == nil {
+		if n <= 0 {
+			return 0, fmt.Errorf("invalid zone index: %s", zone)
+		}
+		return n, nil
+	}
+	if !ValidateInterface(zone) {
+		return 0, fmt.Errorf("unknown zone: %s", zone)
+	}
+	iface, err := net.InterfaceByName(zone)
+	if err != nil {
+		return 0, fmt.Errorf("unknown zone: %s", zone)
 	}
+	return iface.Index, nil
 }
 
 func GenerateRandomString(length int) string {
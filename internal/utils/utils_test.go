@@ -3,7 +3,9 @@ package utils
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"net"
+	"net/netip"
 	"strings"
 	"testing"
 )
@@ -143,6 +145,31 @@ func TestIsValidIPv6(t *testing.T) {
 	}
 }
 
+func TestParseStringToIPType(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected IPType
+	}{
+		{"IPv4", "192.168.1.1", IPTypeIPv4},
+		{"IPv6", "2001:db8::1", IPTypeIPv6},
+		{"IPv4 CIDR", "192.168.1.0/24", IPTypeIPV4CIDR},
+		{"IPv6 CIDR", "2001:db8::/32", IPTypeIPv6CIDR},
+		{"MAC address", "00:11:22:33:44:55", IPTypeMAC},
+		{"invalid", "not-an-address", IPTypeUnknown},
+		{"with surrounding spaces", " 192.168.1.1 ", IPTypeIPv4},
+		{"IPv4-mapped IPv6", "::ffff:192.168.1.1", IPTypeUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseStringToIPType(tt.value); got != tt.expected {
+				t.Errorf("ParseStringToIPType(%q) = %v, want %v", tt.value, got, tt.expected)
+			}
+		})
+	}
+}
+
 func TestParseValueToBytes(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -157,16 +184,16 @@ func TestParseValueToBytes(t *testing.T) {
 		{name: "IPv4 with spaces", input: " 192.168.1.1 ", wantBytes: nil, wantIPType: IPTypeUnknown, wantErr: true},
 		{name: "IPv4 with invalid segment", input: "192.168.1.300", wantBytes: nil, wantIPType: IPTypeUnknown, wantErr: true},
 		{name: "IPv4 with negative segment", input: "192.168.-1.1", wantBytes: nil, wantIPType: IPTypeUnknown, wantErr: true},
-		{name: "Valid IPv6", input: "2001:db8::1", wantBytes: net.ParseIP("2001:db8::1").To16(), wantIPType: IPTypeIPv6, wantErr: false},
-		{name: "IPv6 full format", input: "2001:0db8:0000:0000:0000:8a2e:0370:7334", wantBytes: net.ParseIP("2001:0db8:0000:0000:0000:8a2e:0370:7334").To16(), wantIPType: IPTypeIPv6, wantErr: false},
-		{name: "IPv6 compressed zeros", input: "::", wantBytes: net.ParseIP("::").To16(), wantIPType: IPTypeIPv6, wantErr: false},
-		{name: "IPv4 CIDR minimum prefix", input: "0.0.0.0/0", wantBytes: createIPv4CIDRBytes(0, []byte{0, 0, 0, 0}), wantIPType: IPTypeIPV4CIDR, wantErr: false},
-		{name: "IPv4 CIDR maximum prefix", input: "192.168.1.1/32", wantBytes: createIPv4CIDRBytes(32, []byte{192, 168, 1, 1}), wantIPType: IPTypeIPV4CIDR, wantErr: false},
+		{name: "Valid IPv6", input: "2001:db8::1", wantBytes: netip.MustParseAddr("2001:db8::1").AsSlice(), wantIPType: IPTypeIPv6, wantErr: false},
+		{name: "IPv6 full format", input: "2001:0db8:0000:0000:0000:8a2e:0370:7334", wantBytes: netip.MustParseAddr("2001:0db8:0000:0000:0000:8a2e:0370:7334").AsSlice(), wantIPType: IPTypeIPv6, wantErr: false},
+		{name: "IPv6 compressed zeros", input: "::", wantBytes: netip.MustParseAddr("::").AsSlice(), wantIPType: IPTypeIPv6, wantErr: false},
+		{name: "IPv4 CIDR minimum prefix", input: "0.0.0.0/0", wantBytes: createIPv4CIDRBytes(0, netip.MustParseAddr("0.0.0.0")), wantIPType: IPTypeIPV4CIDR, wantErr: false},
+		{name: "IPv4 CIDR maximum prefix", input: "192.168.1.1/32", wantBytes: createIPv4CIDRBytes(32, netip.MustParseAddr("192.168.1.1")), wantIPType: IPTypeIPV4CIDR, wantErr: false},
 		{name: "IPv4 CIDR with invalid prefix", input: "192.168.1.0/-1", wantBytes: nil, wantIPType: IPTypeUnknown, wantErr: true},
-		{name: "Valid IPv4 CIDR", input: "192.168.1.0/24", wantBytes: createIPv4CIDRBytes(24, []byte{192, 168, 1, 0}), wantIPType: IPTypeIPV4CIDR, wantErr: false},
-		{name: "Valid IPv6 CIDR", input: "2001:db8::/32", wantBytes: createIPv6CIDRBytes(32, net.ParseIP("2001:db8::").To16()), wantIPType: IPTypeIPv6CIDR, wantErr: false},
-		{name: "IPv6 CIDR minimum prefix", input: "::/0", wantBytes: createIPv6CIDRBytes(0, net.ParseIP("::").To16()), wantIPType: IPTypeIPv6CIDR, wantErr: false},
-		{name: "IPv6 CIDR maximum prefix", input: "2001:db8::1/128", wantBytes: createIPv6CIDRBytes(128, net.ParseIP("2001:db8::1").To16()), wantIPType: IPTypeIPv6CIDR, wantErr: false},
+		{name: "Valid IPv4 CIDR", input: "192.168.1.0/24", wantBytes: createIPv4CIDRBytes(24, netip.MustParseAddr("192.168.1.0")), wantIPType: IPTypeIPV4CIDR, wantErr: false},
+		{name: "Valid IPv6 CIDR", input: "2001:db8::/32", wantBytes: createIPv6CIDRBytes(32, netip.MustParseAddr("2001:db8::")), wantIPType: IPTypeIPv6CIDR, wantErr: false},
+		{name: "IPv6 CIDR minimum prefix", input: "::/0", wantBytes: createIPv6CIDRBytes(0, netip.MustParseAddr("::")), wantIPType: IPTypeIPv6CIDR, wantErr: false},
+		{name: "IPv6 CIDR maximum prefix", input: "2001:db8::1/128", wantBytes: createIPv6CIDRBytes(128, netip.MustParseAddr("2001:db8::1")), wantIPType: IPTypeIPv6CIDR, wantErr: false},
 		{name: "IPv6 CIDR with invalid prefix", input: "2001:db8::/129", wantBytes: nil, wantIPType: IPTypeUnknown, wantErr: true},
 		{name: "Valid MAC address", input: "00:11:22:33:44:55", wantBytes: []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}, wantIPType: IPTypeMAC, wantErr: false},
 		{name: "MAC address with hyphens", input: "00-11-22-33-44-55", wantBytes: []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}, wantIPType: IPTypeMAC, wantErr: false},
@@ -185,8 +212,57 @@ func TestParseValueToBytes(t *testing.T) {
 		{name: "Unicode input", input: "192.168.1.1。", wantBytes: nil, wantIPType: IPTypeUnknown, wantErr: true},
 		{name: "Very long input", input: strings.Repeat("a", 1000), wantBytes: nil, wantIPType: IPTypeUnknown, wantErr: true},
 		{name: "IPv4 with leading zeros", input: "192.168.001.001", wantBytes: nil, wantIPType: IPTypeUnknown, wantErr: true},
-		{name: "IPv4 CIDR with small prefix", input: "10.0.0.0/8", wantBytes: createIPv4CIDRBytes(8, []byte{10, 0, 0, 0}), wantIPType: IPTypeIPV4CIDR, wantErr: false},
-		{name: "IPv6 CIDR with large prefix", input: "2001:db8::/120", wantBytes: createIPv6CIDRBytes(120, net.ParseIP("2001:db8::").To16()), wantIPType: IPTypeIPv6CIDR, wantErr: false},
+		{name: "IPv4 CIDR with small prefix", input: "10.0.0.0/8", wantBytes: createIPv4CIDRBytes(8, netip.MustParseAddr("10.0.0.0")), wantIPType: IPTypeIPV4CIDR, wantErr: false},
+		{name: "IPv6 CIDR with large prefix", input: "2001:db8::/120", wantBytes: createIPv6CIDRBytes(120, netip.MustParseAddr("2001:db8::")), wantIPType: IPTypeIPv6CIDR, wantErr: false},
+		{name: "IPv4-mapped IPv6 dotted form", input: "::ffff:192.168.1.1", wantBytes: []byte{192, 168, 1, 1}, wantIPType: IPTypeIPv4, wantErr: false},
+		{name: "IPv4-mapped IPv6 hex form", input: "::ffff:7f01:0203", wantBytes: []byte{127, 1, 2, 3}, wantIPType: IPTypeIPv4, wantErr: false},
+		{name: "IPv4-mapped IPv6 CIDR", input: "::ffff:192.168.1.0/120", wantBytes: createIPv4CIDRBytes(24, netip.MustParseAddr("192.168.1.0")), wantIPType: IPTypeIPV4CIDR, wantErr: false},
+		{name: "IPv4-mapped IPv6 CIDR shorter than /96 is rejected", input: "::ffff:192.168.1.0/64", wantBytes: nil, wantIPType: IPTypeUnknown, wantErr: true},
+		{name: "IPv4-mapped IPv6 with leading zero in embedded octet", input: "::ffff:1.2.03.4", wantBytes: nil, wantIPType: IPTypeUnknown, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotBytes, gotIPType, err := ParseValueToBytes(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseValueToBytes() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if gotIPType != tt.wantIPType {
+				t.Errorf("ParseValueToBytes() gotIPType = %v, want %v", gotIPType, tt.wantIPType)
+			}
+			if !bytes.Equal(gotBytes, tt.wantBytes) {
+				t.Errorf("ParseValueToBytes() gotBytes = %v, want %v", gotBytes, tt.wantBytes)
+			}
+		})
+	}
+}
+
+func TestParseValueToBytesRangesAndPorts(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		wantBytes  []byte
+		wantIPType IPType
+		wantErr    bool
+	}{
+		{name: "IPv4 range", input: "192.168.1.10-192.168.1.20", wantBytes: createRangeBytes([]byte{192, 168, 1, 10}, []byte{192, 168, 1, 20}), wantIPType: IPTypeIPv4Range, wantErr: false},
+		{name: "IPv4 range single-address", input: "10.0.0.1-10.0.0.1", wantBytes: createRangeBytes([]byte{10, 0, 0, 1}, []byte{10, 0, 0, 1}), wantIPType: IPTypeIPv4Range, wantErr: false},
+		{name: "IPv4 range reversed", input: "192.168.1.20-192.168.1.10", wantBytes: nil, wantIPType: IPTypeUnknown, wantErr: true},
+		{name: "IPv6 range", input: "2001:db8::1-2001:db8::ff", wantBytes: createRangeBytes(netip.MustParseAddr("2001:db8::1").AsSlice(), netip.MustParseAddr("2001:db8::ff").AsSlice()), wantIPType: IPTypeIPv6Range, wantErr: false},
+		{name: "mixed-family range", input: "192.168.1.1-2001:db8::1", wantBytes: nil, wantIPType: IPTypeUnknown, wantErr: true},
+
+		{name: "IPv4 with port", input: "10.0.0.1:443", wantBytes: createPortBytes([]byte{10, 0, 0, 1}, 443, 443), wantIPType: IPTypeIPv4Port, wantErr: false},
+		{name: "IPv4 with port range", input: "10.0.0.1:1000-2000", wantBytes: createPortBytes([]byte{10, 0, 0, 1}, 1000, 2000), wantIPType: IPTypeIPv4Port, wantErr: false},
+		{name: "bracketed IPv6 with port", input: "[2001:db8::1]:8080", wantBytes: createPortBytes(netip.MustParseAddr("2001:db8::1").AsSlice(), 8080, 8080), wantIPType: IPTypeIPv6Port, wantErr: false},
+		{name: "IPv4 CIDR with port range", input: "10.0.0.0/24:1000-2000", wantBytes: createCIDRPortBytes(24, []byte{10, 0, 0, 0}, 1000, 2000), wantIPType: IPTypeIPv4CIDRPortRange, wantErr: false},
+		{name: "bracketed IPv6 CIDR with port range", input: "[2001:db8::/32]:1000-2000", wantBytes: createCIDRPortBytes(32, netip.MustParseAddr("2001:db8::").AsSlice(), 1000, 2000), wantIPType: IPTypeIPv6CIDRPortRange, wantErr: false},
+		{name: "port out of range", input: "10.0.0.1:70000", wantBytes: nil, wantIPType: IPTypeUnknown, wantErr: true},
+		{name: "port zero", input: "10.0.0.1:0", wantBytes: nil, wantIPType: IPTypeUnknown, wantErr: true},
+		{name: "reversed port range", input: "10.0.0.1:2000-1000", wantBytes: nil, wantIPType: IPTypeUnknown, wantErr: true},
+		{name: "unbracketed IPv6 with port is rejected as ambiguous", input: "2001:db8::1:99999", wantBytes: nil, wantIPType: IPTypeUnknown, wantErr: true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -208,16 +284,156 @@ func TestParseValueToBytes(t *testing.T) {
 	}
 }
 
-func createIPv4CIDRBytes(ones int, ip []byte) []byte {
+func TestParseValueToBytesZoned(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		wantBytes  []byte
+		wantIPType IPType
+		wantErr    bool
+		opts       *ParseValueToBytesOpts
+	}{
+		{name: "zone by interface name", input: "fe80::1%lo", wantBytes: createZoneBytes(128, netip.MustParseAddr("fe80::1"), 1), wantIPType: IPTypeIPv6Zone, wantErr: false},
+		{name: "zone by numeric ifindex", input: "fe80::1%1", wantBytes: createZoneBytes(128, netip.MustParseAddr("fe80::1"), 1), wantIPType: IPTypeIPv6Zone, wantErr: false},
+		{name: "zoned CIDR", input: "fe80::%lo/64", wantBytes: createZoneBytes(64, netip.MustParseAddr("fe80::"), 1), wantIPType: IPTypeIPv6CIDRZone, wantErr: false},
+		{name: "unknown zone name", input: "fe80::1%nosuchiface0", wantBytes: nil, wantIPType: IPTypeUnknown, wantErr: true},
+		{name: "zone on non-link-local address is rejected", input: "2001:db8::1%lo", wantBytes: nil, wantIPType: IPTypeUnknown, wantErr: true},
+		{name: "AllowZone false rejects zoned address", input: "fe80::1%lo", wantBytes: nil, wantIPType: IPTypeUnknown, wantErr: true, opts: &ParseValueToBytesOpts{AllowZone: false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotBytes []byte
+			var gotIPType IPType
+			var err error
+			if tt.opts != nil {
+				gotBytes, gotIPType, err = ParseValueToBytesWithOpts(tt.input, *tt.opts)
+			} else {
+				gotBytes, gotIPType, err = ParseValueToBytes(tt.input)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseValueToBytes() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if gotIPType != tt.wantIPType {
+				t.Errorf("ParseValueToBytes() gotIPType = %v, want %v", gotIPType, tt.wantIPType)
+			}
+			if !bytes.Equal(gotBytes, tt.wantBytes) {
+				t.Errorf("ParseValueToBytes() gotBytes = %v, want %v", gotBytes, tt.wantBytes)
+			}
+		})
+	}
+}
+
+func createZoneBytes(bits int, addr netip.Addr, ifindex uint32) []byte {
+	out := make([]byte, 4+16+4)
+	binary.LittleEndian.PutUint32(out[:4], uint32(bits))
+	copy(out[4:20], addr.AsSlice())
+	binary.LittleEndian.PutUint32(out[20:], ifindex)
+	return out
+}
+
+func createRangeBytes(start, end []byte) []byte {
+	out := make([]byte, 0, len(start)+len(end))
+	out = append(out, start...)
+	out = append(out, end...)
+	return out
+}
+
+func createPortBytes(ip []byte, lo, hi uint16) []byte {
+	out := make([]byte, len(ip)+4)
+	copy(out, ip)
+	binary.LittleEndian.PutUint16(out[len(ip):], lo)
+	binary.LittleEndian.PutUint16(out[len(ip)+2:], hi)
+	return out
+}
+
+func createCIDRPortBytes(ones int, ip []byte, lo, hi uint16) []byte {
+	out := make([]byte, 4+len(ip)+4)
+	binary.LittleEndian.PutUint32(out[:4], uint32(ones))
+	copy(out[4:], ip)
+	binary.LittleEndian.PutUint16(out[4+len(ip):], lo)
+	binary.LittleEndian.PutUint16(out[4+len(ip)+2:], hi)
+	return out
+}
+
+func createIPv4CIDRBytes(ones int, addr netip.Addr) []byte {
 	var bytes [8]byte
 	binary.LittleEndian.PutUint32(bytes[:4], uint32(ones))
-	copy(bytes[4:], ip)
+	copy(bytes[4:], addr.AsSlice())
 	return bytes[:]
 }
 
-func createIPv6CIDRBytes(ones int, ip []byte) []byte {
+func createIPv6CIDRBytes(ones int, addr netip.Addr) []byte {
 	var bytes [20]byte
 	binary.LittleEndian.PutUint32(bytes[:4], uint32(ones))
-	copy(bytes[4:], ip)
+	copy(bytes[4:], addr.AsSlice())
 	return bytes[:]
 }
+
+// legacyParseValueToBytes is the net.IP-based implementation ParseValueToBytes used to have,
+// kept here only so BenchmarkParseValueToBytes can show the win from switching to net/netip.
+func legacyParseValueToBytes(value string) ([]byte, IPType, error) {
+	value = strings.TrimSpace(value)
+	_, ipNet, err := net.ParseCIDR(value)
+	if err != nil {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			macAddr, err := net.ParseMAC(value)
+			if err != nil {
+				return nil, IPTypeUnknown, fmt.Errorf("invalid value: %s", value)
+			}
+			return macAddr, IPTypeMAC, nil
+		}
+		if ip.To4() != nil && len(ip) == net.IPv4len {
+			return ip.To4(), IPTypeIPv4, nil
+		} else if ip.To16() != nil && len(ip) == net.IPv6len {
+			return ip.To16(), IPTypeIPv6, nil
+		}
+		return nil, IPTypeUnknown, fmt.Errorf("invalid value: %s", value)
+	}
+	ones, _ := ipNet.Mask.Size()
+	if ipNet.IP.To4() != nil && len(ipNet.IP) == net.IPv4len {
+		var b [8]byte
+		binary.LittleEndian.PutUint32(b[:4], uint32(ones))
+		copy(b[4:], ipNet.IP.To4())
+		return b[:], IPTypeIPV4CIDR, nil
+	} else if ipNet.IP.To16() != nil && len(ipNet.IP) == net.IPv6len {
+		var b [20]byte
+		binary.LittleEndian.PutUint32(b[:4], uint32(ones))
+		copy(b[4:], ipNet.IP.To16())
+		return b[:], IPTypeIPv6CIDR, nil
+	}
+	return nil, IPTypeUnknown, fmt.Errorf("invalid value: %s", value)
+}
+
+// cidrRuleset generates n distinct, deterministic IPv4 CIDR rules for the benchmarks below.
+func cidrRuleset(n int) []string {
+	rules := make([]string, n)
+	for i := 0; i < n; i++ {
+		rules[i] = fmt.Sprintf("10.%d.%d.%d/24", (i>>16)&0xff, (i>>8)&0xff, i&0xff)
+	}
+	return rules
+}
+
+func BenchmarkParseValueToBytesLegacy(b *testing.B) {
+	rules := cidrRuleset(100_000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := legacyParseValueToBytes(rules[i%len(rules)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseValueToBytesNetip(b *testing.B) {
+	rules := cidrRuleset(100_000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := ParseValueToBytes(rules[i%len(rules)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
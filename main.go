@@ -10,9 +10,14 @@ import (
 	"runtime"
 	"time"
 
+	"github.com/sirupsen/logrus"
+
 	"github.com/danger-dream/ebpf-firewall/internal/config"
 	"github.com/danger-dream/ebpf-firewall/internal/ebpf"
+	"github.com/danger-dream/ebpf-firewall/internal/events"
+	"github.com/danger-dream/ebpf-firewall/internal/logging"
 	"github.com/danger-dream/ebpf-firewall/internal/metrics"
+	"github.com/danger-dream/ebpf-firewall/internal/notify"
 	"github.com/danger-dream/ebpf-firewall/internal/processor"
 	"github.com/danger-dream/ebpf-firewall/internal/server"
 	"github.com/danger-dream/ebpf-firewall/internal/types"
@@ -23,45 +28,60 @@ import (
 var Static embed.FS
 
 func main() {
+	// config.Init itself has no logger to report to yet, so bootstrap failures stay on the
+	// standard library's log until internal/logging.New can build the configured one.
 	if err := config.Init(); err != nil {
 		log.Fatalf("Failed to initialize config: %v", err)
 	}
+	config.WatchConfig()
 	config := config.GetConfig()
 	data, _ := json.MarshalIndent(config, "", "  ")
-	log.Printf("Current configuration:\n%s", string(data))
+
+	logger, err := logging.New(config.Logging)
+	if err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	logger.Infof("Current configuration:\n%s", string(data))
 
 	pool := utils.NewElasticPool[*types.PacketInfo](utils.PoolConfig{
 		QueueSize:  1024,
 		MinWorkers: 3,
 		MaxWorkers: int32(runtime.NumCPU() * 2),
-	})
-
-	collector := metrics.NewMetricsCollector()
-	ebpfManager := ebpf.NewEBPFManager(pool)
-
-	processor, err := processor.NewProcessor(pool, ebpfManager, collector)
+		Logger:     logger,
+	}, utils.WithObjectPool(
+		func() *types.PacketInfo { return &types.PacketInfo{} },
+		func(pi *types.PacketInfo) { *pi = types.PacketInfo{} },
+	))
+
+	notifier := newNotifier(config.Notify, logger)
+	bus := events.NewEventBus()
+	collector := metrics.NewMetricsCollector(notifier, bus, logger)
+	ebpfManager := ebpf.NewEBPFManager(pool, logger)
+
+	processor, err := processor.NewProcessor(pool, ebpfManager, collector, notifier, bus, logger)
 	if err != nil {
-		log.Fatalf("failed to start processor: %v", err)
+		logger.Fatalf("failed to start processor: %v", err)
 	}
 
 	if err := ebpfManager.Start(); err != nil {
-		log.Fatalf("failed to start eBPF manager: %v", err)
+		logger.Fatalf("failed to start eBPF manager: %v", err)
 	}
 
 	pool.Start()
 
-	appServer := server.New(ebpfManager, collector, processor)
+	appServer := server.New(ebpfManager, collector, processor, notifier, bus, logger)
+	appServer.ServePrometheusMetrics()
 
 	// priority: Try to serve local static files first
 	distPath := filepath.Join(config.DataDir, "dist")
 	if info, err := os.Stat(distPath); err == nil && info.IsDir() {
-		log.Printf("Using local static files from: %s", distPath)
+		logger.Infof("Using local static files from: %s", distPath)
 		appServer.ServeStaticDirectory(distPath)
 	} else {
 		if os.IsNotExist(err) {
-			log.Printf("Local static directory not found, using embedded files")
+			logger.Info("Local static directory not found, using embedded files")
 		} else {
-			log.Printf("Error accessing local static directory: %v, falling back to embedded files", err)
+			logger.Warnf("Error accessing local static directory: %v, falling back to embedded files", err)
 		}
 		appServer.ServeEmbeddedFiles(Static)
 	}
@@ -79,23 +99,47 @@ func main() {
 	signal.Notify(stop, os.Interrupt)
 	select {
 	case err := <-errChan:
-		log.Printf("server start failed: %v", err)
+		logger.Errorf("server start failed: %v", err)
 	case <-stop:
-		log.Println("shutting down application...")
+		logger.Info("shutting down application...")
+	}
+	closeWithTimeout("appServer", appServer.Close, time.Second, logger)
+	closeWithTimeout("ebpfManager", ebpfManager.Close, time.Second, logger)
+	closeWithTimeout("processor", processor.Close, time.Second, logger)
+	closeWithTimeout("pool", pool.Close, time.Second, logger)
+	closeWithTimeout("collector", collector.Close, time.Second, logger)
+	notifier.Close()
+}
+
+// newNotifier wires up the configured outbound webhook sinks
+func newNotifier(cfg config.NotifyConfig, logger logrus.FieldLogger) *notify.Notifier {
+	notifier := notify.NewNotifier(logger)
+	for _, sinkCfg := range cfg.Sinks {
+		timeout := time.Duration(sinkCfg.TimeoutSeconds) * time.Second
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		var sink notify.Sink
+		switch sinkCfg.Type {
+		case "splunk_hec":
+			sink = notify.NewSplunkHECSink(sinkCfg.URL, sinkCfg.Token, timeout)
+		case "generic":
+			sink = notify.NewGenericSink(sinkCfg.URL, timeout)
+		default:
+			logger.WithField("sink_type", sinkCfg.Type).Warn("notify: skipping sink with unknown type")
+			continue
+		}
+		notifier.AddSink(sink, sinkCfg.EventTypes, sinkCfg.BatchSize, 0)
 	}
-	closeWithTimeout("appServer", appServer.Close, time.Second)
-	closeWithTimeout("ebpfManager", ebpfManager.Close, time.Second)
-	closeWithTimeout("processor", processor.Close, time.Second)
-	closeWithTimeout("pool", pool.Close, time.Second)
-	closeWithTimeout("collector", collector.Close, time.Second)
+	return notifier
 }
 
-func closeWithTimeout(name string, fn func() error, timeout time.Duration) {
+func closeWithTimeout(name string, fn func() error, timeout time.Duration, logger logrus.FieldLogger) {
 	done := make(chan struct{})
 	go func() {
 		start := time.Now()
 		fn()
-		log.Printf("Component %s closed in %v", name, time.Since(start))
+		logger.WithField("component", name).Infof("closed in %v", time.Since(start))
 		close(done)
 	}()
 
@@ -103,6 +147,6 @@ func closeWithTimeout(name string, fn func() error, timeout time.Duration) {
 	case <-done:
 		return
 	case <-time.After(timeout):
-		log.Printf("Warning: %s close timeout after %v", name, timeout)
+		logger.WithField("component", name).Warnf("close timeout after %v", timeout)
 	}
 }
@@ -0,0 +1,72 @@
+package promptclient
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// Client is a connection to a firewall's prompt socket. Requests delivers incoming Requests as
+// they arrive; Respond answers one by ID. A single Client can have many Requests in flight at
+// once - nothing about the protocol requires answering them in order.
+type Client struct {
+	conn      net.Conn
+	enc       *json.Encoder
+	encMu     sync.Mutex
+	requests  chan Request
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Dial connects to the Unix socket at path and starts reading Requests in the background.
+func Dial(path string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("promptclient: dial %s: %w", path, err)
+	}
+	c := &Client{
+		conn:     conn,
+		enc:      json.NewEncoder(conn),
+		requests: make(chan Request, 16),
+		done:     make(chan struct{}),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+func (c *Client) readLoop() {
+	defer close(c.requests)
+	dec := json.NewDecoder(bufio.NewReader(c.conn))
+	for {
+		var req Request
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		select {
+		case c.requests <- req:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Requests returns the channel of incoming prompt requests. It's closed once the connection to
+// the server is lost, so a range loop over it ends cleanly on disconnect.
+func (c *Client) Requests() <-chan Request {
+	return c.requests
+}
+
+// Respond answers a Request by ID. It's safe to call concurrently.
+func (c *Client) Respond(resp Response) error {
+	c.encMu.Lock()
+	defer c.encMu.Unlock()
+	return c.enc.Encode(resp)
+}
+
+// Close releases the underlying connection.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return c.conn.Close()
+}
@@ -0,0 +1,51 @@
+// Package promptclient is a small client for the firewall's interactive prompt socket: a Unix
+// domain socket (configured as threat_intel.prompt.socket_path) that the processor writes
+// Requests to and reads Responses from, newline-delimited JSON in both directions. A GUI or CLI
+// wrapper links against this package instead of reimplementing the wire format.
+package promptclient
+
+// Scope controls how long a Response is remembered once the processor receives it: Once is
+// consulted for this packet only, Session is cached in memory until TTL elapses (or the process
+// restarts), and Permanent is cached forever and promoted into a BlockRule or AllowRule so it
+// survives a restart too.
+type Scope string
+
+const (
+	ScopeOnce      Scope = "once"
+	ScopeSession   Scope = "session"
+	ScopePermanent Scope = "permanent"
+)
+
+// Action is what the operator decided to do with the source IP that triggered a Request.
+type Action string
+
+const (
+	ActionAllow Action = "allow"
+	ActionDeny  Action = "deny"
+)
+
+// Request is written by the firewall to every connected client when a source IP matches a
+// monitored threat-intel feed and threat_intel.match_mode is "prompt". A client that doesn't
+// recognize a field should ignore it rather than erroring, since future releases may add more.
+type Request struct {
+	ID        string `json:"id"`
+	Timestamp int64  `json:"timestamp"`
+	SrcIP     string `json:"src_ip"`
+	DstIP     string `json:"dst_ip"`
+	SrcPort   uint16 `json:"src_port"`
+	DstPort   uint16 `json:"dst_port"`
+	Proto     uint16 `json:"proto"`
+	Country   string `json:"country"`
+	City      string `json:"city"`
+	// Feed is the name of the threat-intel feed that matched SrcIP.
+	Feed string `json:"feed"`
+}
+
+// Response answers a Request by ID. TTL is the number of seconds a Scope of "session" should be
+// cached for; it's ignored for "once" (never cached) and "permanent" (cached forever).
+type Response struct {
+	ID     string `json:"id"`
+	Scope  Scope  `json:"scope"`
+	Action Action `json:"action"`
+	TTL    int64  `json:"ttl"`
+}